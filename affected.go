@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --affected 未指定 --match 时识别子包的标记文件
+var defaultPackageMarkers = "go.mod,package.json,Cargo.toml,pyproject.toml,pom.xml"
+
+// 找出受 git 改动影响的子包：改动的文件（相对 ref 的差异加上未跟踪文件）归属到包含它的最深一层包目录
+func affectedPackages(ctx context.Context, pkgs []string, ref string) ([]string, error) {
+	type pkg struct{ dir, abs string }
+	var list []pkg
+	changed := make(map[string]bool) // 改动文件的绝对路径
+	tops := make(map[string]bool)
+	for _, dir := range pkgs {
+		abs, err := realPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, pkg{dir, abs})
+		top, err := gitOutput(ctx, dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, fmt.Errorf("目录 %s 不在 git 仓库中: %w", dir, err)
+		}
+		if tops[top] {
+			continue
+		}
+		tops[top] = true
+		diff, err := gitOutput(ctx, top, "diff", "--name-only", ref)
+		if err != nil {
+			return nil, err
+		}
+		untracked, err := gitOutput(ctx, top, "ls-files", "--others", "--exclude-standard")
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range strings.Fields(diff + "\n" + untracked) {
+			changed[filepath.Join(top, filepath.FromSlash(f))] = true
+		}
+	}
+
+	affected := make(map[string]bool)
+	for file := range changed {
+		best := -1
+		for i, p := range list {
+			if isWithin(file, p.abs) && (best < 0 || len(p.abs) > len(list[best].abs)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			affected[list[best].dir] = true
+		}
+	}
+	var out []string
+	for _, p := range list {
+		if affected[p.dir] {
+			out = append(out, p.dir)
+		}
+	}
+	return out, nil
+}
+
+// 绝对路径并解析符号链接，与 git 输出的仓库根目录保持一致
+func realPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// file 是否位于 dir 之内
+func isWithin(file, dir string) bool {
+	return strings.HasPrefix(file, dir+string(os.PathSeparator))
+}
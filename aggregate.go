@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --aggregate 时不实时显示输出，结束后按目录对比
+var aggregateOutput bool
+
+// 聚合模式下收集的一个目录的输出，超过 buffer_memory 后转存到临时文件；
+// 对比和显示时只看去掉首尾空白的部分，写入时记下它的范围
+type capturedOutput struct {
+	mu      sync.Mutex
+	buf     spillBuffer
+	started bool
+	start   int64 // 第一个非空白字符的位置
+	end     int64 // 最后一个非空白字符之后的位置
+	nl      int   // 已写入的换行数
+	startNL int   // start 之前的换行数
+	endNL   int   // end 之前的换行数
+}
+
+func (c *capturedOutput) add(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := strings.IndexFunc(line, isNotSpace); i >= 0 {
+		if !c.started {
+			c.started, c.start, c.startNL = true, c.buf.size+int64(i), c.nl
+		}
+		j := strings.LastIndexFunc(line, isNotSpace)
+		_, n := utf8.DecodeRuneInString(line[j:])
+		c.end, c.endNL = c.buf.size+int64(j+n), c.nl
+	}
+	_, _ = io.WriteString(&c.buf, line)
+	_, _ = c.buf.Write([]byte{'\n'})
+	c.nl++
+}
+
+func isNotSpace(r rune) bool { return !unicode.IsSpace(r) }
+
+// 去掉首尾空白后的输出的哈希，用于对比；没有输出时为空
+func (c *capturedOutput) digest() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		return ""
+	}
+	h := sha256.New()
+	_, _ = io.Copy(h, c.buf.section(c.start, c.end-c.start))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 显示用的输出：多行时为第一行和其余行数
+func (c *capturedOutput) summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		return ""
+	}
+	first, _ := bufio.NewReader(c.buf.section(c.start, c.end-c.start)).ReadString('\n')
+	first = strings.TrimSuffix(first, "\n")
+	if extra := c.endNL - c.startNL; extra > 0 {
+		return fmt.Sprintf("%s (+%d 行)", first, extra)
+	}
+	return first
+}
+
+func (c *capturedOutput) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Close()
+}
+
+// 打印各目录输出的对比表：以成功目录中出现最多的输出为准，不同的目录标记 *
+func printAggregate(w io.Writer, targets []*target, results []*dirResult) {
+	status := make(map[string]string)
+	for _, r := range results {
+		if _, seen := status[r.Dir]; !seen || okStatus(status[r.Dir]) {
+			status[r.Dir] = r.Status
+		}
+	}
+	counts := make(map[string]int)
+	digests := make(map[*target]string, len(targets))
+	var majority string
+	for _, t := range targets {
+		digests[t] = t.captured.digest()
+		if !okStatus(status[t.Dir]) {
+			continue
+		}
+		v := digests[t]
+		counts[v]++
+		if counts[v] > counts[majority] {
+			majority = v
+		}
+	}
+
+	fmt.Fprintln(w, "\n===== 输出对比 =====")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DIR\t%s\tOUTPUT\n", plainCell("DIFF"))
+	differ := 0
+	for _, t := range targets {
+		mark := plainCell("")
+		if !okStatus(status[t.Dir]) || digests[t] != majority {
+			mark = colorize("33", "*")
+			differ++
+		}
+		shown := t.captured.summary()
+		_ = t.captured.Close()
+		if !okStatus(status[t.Dir]) {
+			shown = colorStatus(status[t.Dir]) + " " + shown
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", t.Dir, mark, shown)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d 种不同输出，%d 个目录与多数（%d 个目录）不同\n", len(counts), differ, counts[majority])
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// --bench N：整批目录依次执行 N 轮，每轮使用与 b 相同的调度顺序和并发设置；
+// 返回每轮的结果和墙钟耗时，运行被取消时提前结束
+func runBench(ctx context.Context, cancel context.CancelCauseFunc, b *batch, concurrency, n int) ([][]*dirResult, []time.Duration) {
+	var rounds [][]*dirResult
+	var walls []time.Duration
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		logger.Info(fmt.Sprintf("基准测试第 %d/%d 轮", i+1, n), "phase", "bench", "round", i+1)
+		round := newBatch(b.targets, b.chain, concurrency, b.failFast)
+		round.order, round.throttle, round.failures = b.order, b.throttle, b.failures
+		start := time.Now()
+		round.start(ctx, cancel)
+		round.wait()
+		rounds = append(rounds, round.results())
+		walls = append(walls, time.Since(start))
+	}
+	return rounds, walls
+}
+
+// 一组耗时的统计
+type durationStats struct {
+	Min, Median, Max, Stddev time.Duration
+}
+
+func newDurationStats(ds []time.Duration) durationStats {
+	if len(ds) == 0 {
+		return durationStats{}
+	}
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+	var mean float64
+	for _, d := range sorted {
+		mean += float64(d)
+	}
+	mean /= float64(len(sorted))
+	var variance float64
+	for _, d := range sorted {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	return durationStats{
+		Min:    sorted[0],
+		Median: median,
+		Max:    sorted[len(sorted)-1],
+		Stddev: time.Duration(math.Sqrt(variance / float64(len(sorted)))),
+	}
+}
+
+// 打印每个目录（组链的总耗时，只统计成功的轮次）和每轮墙钟耗时（(wall) 行）的统计
+func printBenchReport(w io.Writer, targets []*target, rounds [][]*dirResult, walls []time.Duration) {
+	fmt.Fprintf(w, "\n===== 基准测试（%d 轮）=====\n", len(rounds))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIR\tRUNS\tFAIL\tMIN\tMEDIAN\tMAX\tSTDDEV")
+	row := func(name string, runs, failed int, ds []time.Duration) {
+		if len(ds) == 0 {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t-\t-\t-\t-\n", name, runs, failed)
+			return
+		}
+		s := newDurationStats(ds)
+		r := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", name, runs, failed, r(s.Min), r(s.Median), r(s.Max), r(s.Stddev))
+	}
+	for _, t := range targets {
+		var ds []time.Duration
+		failed := 0
+		for _, results := range rounds {
+			var total time.Duration
+			ok := true
+			for _, res := range results {
+				if res.Dir == t.Dir {
+					total += res.Duration
+					ok = ok && res.succeeded()
+				}
+			}
+			if ok {
+				ds = append(ds, total)
+			} else {
+				failed++
+			}
+		}
+		row(t.Dir, len(rounds), failed, ds)
+	}
+	failedRounds := 0
+	for _, results := range rounds {
+		if slices.ContainsFunc(results, func(r *dirResult) bool { return !r.succeeded() }) {
+			failedRounds++
+		}
+	}
+	row("(wall)", len(walls), failedRounds, walls)
+	tw.Flush()
+}
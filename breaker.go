@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// max_failures / max_failure_pct：失败的目录数达到上限后停止调度剩余目录，
+// 此时多半是同一个系统性问题（网络、凭据、共享依赖），继续执行只会得到同样的失败
+type failureLimit struct {
+	Max     int     // 失败目录数上限，0 表示不限制
+	Percent float64 // 失败目录占全部目录的百分比上限，0 表示不限制
+}
+
+func parseFailureLimit(cfg *Config) (failureLimit, error) {
+	var l failureLimit
+	n, err := cfg.intSetting("", "max_failures", 0)
+	if err != nil {
+		return l, err
+	}
+	l.Max = n
+	if v, ok := cfg.Settings["max_failure_pct"]; ok {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+		if err != nil || f <= 0 || f > 100 {
+			return l, fmt.Errorf("无效的 max_failure_pct 配置 %q，需要 0 到 100 之间的百分比", v)
+		}
+		l.Percent = f
+	}
+	return l, nil
+}
+
+// 共 total 个目录、已有 failed 个失败时是否达到上限
+func (l failureLimit) reached(failed, total int) bool {
+	if l.Max > 0 && failed >= l.Max {
+		return true
+	}
+	return l.Percent > 0 && float64(failed)*100 >= l.Percent*float64(total)
+}
+
+func (l failureLimit) String() string {
+	var parts []string
+	if l.Max > 0 {
+		parts = append(parts, fmt.Sprintf("max_failures=%d", l.Max))
+	}
+	if l.Percent > 0 {
+		parts = append(parts, fmt.Sprintf("max_failure_pct=%g", l.Percent))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// 结果缓存的默认文件
+const defaultCacheFile = ".runcmd/cache.json"
+
+// 本次运行使用的结果缓存，nil 表示未启用
+var resultCacheStore *resultCache
+
+// 目录 + 组 -> 上次成功执行时的内容哈希
+type resultCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// 链中有组开启 cache 时打开缓存文件，文件不存在时从空缓存开始
+func openResultCache(cfg *Config, chain []*runOptions, disabled bool) (*resultCache, error) {
+	if disabled || !slices.ContainsFunc(chain, func(o *runOptions) bool { return o.Cache }) {
+		return nil, nil
+	}
+	path := defaultCacheFile
+	if v := cfg.Settings["cache_file"]; v != "" {
+		path = v
+	}
+	c := &resultCache{path: path, entries: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存文件 %s 失败: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		logger.Warn(fmt.Sprintf("缓存文件 %s 格式无效，已忽略: %v", path, err), "file", path)
+		c.entries = make(map[string]string)
+	}
+	return c, nil
+}
+
+func cacheKey(dir, group string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir + " [" + group + "]"
+}
+
+// 哈希与上次成功执行时一致
+func (c *resultCache) hit(dir, group, hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[cacheKey(dir, group)] == hash
+}
+
+// 记录成功执行时的哈希并写回文件
+func (c *resultCache) store(dir, group, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(dir, group)] = hash
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// 目录内容与组定义的哈希：组名、命令、shell、参数、[env] 以及参与哈希的文件内容
+func dirContentHash(ctx context.Context, dir string, opts *runOptions) (string, error) {
+	files, err := cacheFileList(ctx, dir, opts.CacheFiles)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "group %q\nshell %q\n", opts.Group, opts.Shell.String())
+	for _, parts := range [][]string{opts.When, opts.Cmds, opts.Args, opts.ConfigEnv} {
+		fmt.Fprintf(h, "%q\n", parts)
+	}
+	for _, e := range opts.Expect {
+		fmt.Fprintf(h, "%q\n", e.String())
+	}
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			// 已跟踪但被删除的文件
+			fmt.Fprintf(h, "file %q missing\n", name)
+			continue
+		}
+		fmt.Fprintf(h, "file %q\n", name)
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return "", fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 参与哈希的文件（相对目录的路径，已排序）：
+// 配置了 cache_files 时按通配符匹配；git 目录取已跟踪和未忽略的文件；否则遍历目录
+func cacheFileList(ctx context.Context, dir string, patterns []string) ([]string, error) {
+	var files []string
+	switch {
+	case len(patterns) > 0:
+		for _, p := range patterns {
+			matches, err := filepath.Glob(filepath.Join(dir, p))
+			if err != nil {
+				return nil, fmt.Errorf("无效的 cache_files 通配符 %q: %w", p, err)
+			}
+			for _, m := range matches {
+				if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+					rel, _ := filepath.Rel(dir, m)
+					files = append(files, filepath.ToSlash(rel))
+				}
+			}
+		}
+	case isGitWorkTree(ctx, dir):
+		out, err := gitOutput(ctx, dir, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range strings.Split(out, "\x00") {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+	default:
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != dir && (skipScanDirs[d.Name()] || d.Name() == ".runcmd") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				rel, _ := filepath.Rel(dir, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("遍历目录 %s 失败: %w", dir, err)
+		}
+	}
+	// 运行历史、缓存文件和目录锁本身不参与哈希
+	files = slices.DeleteFunc(files, func(f string) bool { return strings.HasPrefix(f, ".runcmd/") || f == dirLockFile })
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+func isGitWorkTree(ctx context.Context, dir string) bool {
+	_, err := gitOutput(ctx, dir, "rev-parse", "--is-inside-work-tree")
+	return err == nil
+}
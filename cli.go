@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// 子命令
+type command struct {
+	Name    string
+	Args    string // 用法中的参数说明
+	Summary string
+	Run     func(args []string) int
+}
+
+// 全部子命令，按帮助中的显示顺序
+func commands() []command {
+	return []command{
+		{"run", "[flags] <group> <dir|glob|@dirset> ...", "在目录中执行组（链）", runRun},
+		{"exec", "[flags] -- '<command>' <dir|glob|@dirset> ...", "在目录中执行一条临时命令", runExec},
+		{"list", "", "列出配置中的组", runList},
+		{"show", "<group> | <run-id>", "显示组的命令和选项，或一次历史运行的结果", runShowCommand},
+		{"validate", "", "检查配置是否有效", runValidate},
+		{"diff-config", "[flags]", "对比生效配置与内嵌默认配置", runDiffConfig},
+		{"init", "[flags]", "在当前目录生成初始配置", runInit},
+		{"completion", "bash|zsh|fish", "输出 shell 补全脚本", runCompletion},
+		{"history", "[flags]", "列出最近的运行", func(args []string) int {
+			setupColor(false, logOut)
+			return runHistory(args)
+		}},
+		{"serve", "[flags]", "启动 HTTP 服务和网页面板", runServe},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// 按第一个参数分发子命令；不是子命令时按旧的 ./runCmd [flags] <group> <dir>... 处理
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "__complete":
+		return runComplete(args[1:])
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if c, ok := findCommand(args[1]); ok {
+				return c.Run([]string{"--help"})
+			}
+		}
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	if c, ok := findCommand(args[0]); ok {
+		// 子命令出现之前的配置中可能有同名的组，旧写法 ./runCmd show <dir> 仍按组执行
+		if !configHasGroup(args[0], args[1:]) {
+			return c.Run(args[1:])
+		}
+		logger.Warn(fmt.Sprintf("组 [%s] 与子命令同名，按组执行；需要使用 %s 子命令时请给该组改名", args[0], args[0]), "group", args[0])
+	}
+	return runRun(args)
+}
+
+// 配置中是否定义了该组。args 为子命令之后的参数，其中的 --config、--profile 与
+// loadConfig 一样决定使用哪份配置和 profile；只读取配置文件，不打印日志，远程配置只看本地缓存
+func configHasGroup(name string, args []string) bool {
+	data, _ := embeddedConfig.ReadFile("config.txt")
+	cfg := parseConfig(string(data))
+	configPath, profile := scanConfigFlags(args)
+	saved := configFlag
+	configFlag = configPath
+	file, _, err := findConfigFile()
+	configFlag = saved
+	if err == nil && file != "" {
+		if override, err := readCachedConfig(file); err == nil {
+			if u := override.Settings["extends_url"]; isConfigURL(u) {
+				if base, err := readCachedConfig(u); err == nil {
+					cfg = mergeConfig(cfg, base)
+				}
+			}
+			cfg = mergeConfig(cfg, override)
+		}
+	}
+	if profile != "" {
+		_ = cfg.applyProfile(profile)
+	}
+	_, ok := cfg.Groups[name]
+	return ok
+}
+
+// 读取配置文件，http(s) 地址只读本地缓存
+func readCachedConfig(file string) (*Config, error) {
+	if isConfigURL(file) {
+		var err error
+		if file, err = configCachePath(file); err != nil {
+			return nil, err
+		}
+	}
+	return readConfigFile(file, nil)
+}
+
+// 按 flag 包的规则从子命令参数中取出 --config 和 --profile，没有给出时沿用当前的值
+func scanConfigFlags(args []string) (config, profile string) {
+	config, profile = configFlag, profileFlag
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		name, val, hasVal := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if valueFlags[name] && !hasVal && i+1 < len(args) {
+			i++
+			val = args[i]
+		}
+		switch name {
+		case "config":
+			config = val
+		case "profile":
+			profile = val
+		}
+	}
+	return config, profile
+}
+
+// 组名与子命令或区块名相同时的问题，validate 中提示
+func groupNameConflict(name string) string {
+	kind, _, _ := strings.Cut(name, "@")
+	if _, ok := findCommand(name); ok {
+		return fmt.Sprintf("组 [%s] 与子命令同名，./runCmd %s 会执行该组而不是子命令", name, name)
+	}
+	if yamlSections[kind] || strings.HasPrefix(kind, "env:") || strings.HasPrefix(kind, "dirs:") {
+		return fmt.Sprintf("组名 [%s] 与配置区块名相同，INI 配置中会被当作区块解析", name)
+	}
+	return ""
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: ./runCmd <command> [args]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.Name, c.Args, c.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "./runCmd help <command> 查看子命令的参数；省略 run 直接写 ./runCmd <group> <dir>... 同样可用")
+}
+
+// 解析子命令参数，失败或 --help 时返回退出码和 false
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
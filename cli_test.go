@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigHasGroup(t *testing.T) {
+	dir := cliWorkdir(t, "[list]\necho list\n[show@ci]\necho show\n")
+	if err := os.WriteFile(filepath.Join(dir, "other.txt"), []byte("[show]\necho other\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	savedConfig, savedProfile := configFlag, profileFlag
+	configFlag, profileFlag = "", ""
+	t.Cleanup(func() { configFlag, profileFlag = savedConfig, savedProfile })
+
+	tests := []struct {
+		name  string
+		env   string // RUNCMD_CONFIG
+		group string
+		args  []string
+		want  bool
+	}{
+		{"当前目录的配置", "", "list", nil, true},
+		{"不存在的组", "", "show", []string{"./a"}, false},
+		{"--config 指定的配置", "", "show", []string{"--config", "other.txt", "./a"}, true},
+		{"--config= 写法", "", "show", []string{"-config=other.txt"}, true},
+		{"--config 替换了当前目录的配置", "", "list", []string{"--config", "other.txt"}, false},
+		{"位置参数之后的 --config 不算", "", "show", []string{"./a", "--config", "other.txt"}, false},
+		{"RUNCMD_CONFIG", "other.txt", "show", nil, true},
+		{"--profile 中的组", "", "show", []string{"--json", "--profile", "ci"}, true},
+		{"内嵌配置中的组", "", "update", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNCMD_CONFIG", tt.env)
+			if got := configHasGroup(tt.group, tt.args); got != tt.want {
+				t.Errorf("configHasGroup(%q, %q) = %v, want %v", tt.group, tt.args, got, tt.want)
+			}
+			if configFlag != "" || profileFlag != "" {
+				t.Errorf("configHasGroup 不应修改 --config、--profile")
+			}
+		})
+	}
+}
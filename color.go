@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// 是否输出 ANSI 颜色
+var colorEnabled bool
+
+// 目录前缀使用的颜色，红绿留给 FAIL/OK
+var prefixPalette = []string{"36", "33", "35", "34", "96", "93", "95", "94"}
+
+// 每个目录分配到的颜色
+var dirColors = map[string]string{}
+
+// 根据 --no-color、NO_COLOR 环境变量和输出是否为终端决定是否启用颜色
+func setupColor(noColor bool, out io.Writer) {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		colorEnabled = false
+		return
+	}
+	f, ok := out.(*os.File)
+	colorEnabled = ok && isTerminal(f)
+}
+
+// 是否为终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// 按目标顺序给每个目录分配颜色
+func assignDirColors(targets []*target) {
+	for _, t := range targets {
+		dirColors[t.Dir] = prefixPalette[t.Index%len(prefixPalette)]
+	}
+}
+
+func colorize(code, s string) string {
+	if !colorEnabled || code == "" {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// 输出行前缀 [dir]，并发步骤的 dir#2 使用所属目录的颜色
+func prefix(label string) string {
+	code, ok := dirColors[label]
+	if !ok {
+		if i := strings.LastIndex(label, "#"); i > 0 {
+			code = dirColors[label[:i]]
+		}
+	}
+	return colorize(code, "["+label+"]")
+}
+
+// 状态标记着色：OK 绿色，CACHED 青色，FAIL/TIMEOUT 红色，其余黄色
+func colorStatus(status string) string {
+	switch status {
+	case statusOK:
+		return colorize("32", status)
+	case statusCached:
+		return colorize("36", status)
+	case statusFailed, statusTimeout:
+		return colorize("31", status)
+	}
+	return colorize("33", status)
+}
+
+// 表头等不着色的单元格补上等长的转义序列，保证 tabwriter 对齐
+func plainCell(s string) string {
+	return colorize("39", s)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 带值的参数，补全时跳过其后的值
+var valueFlags = map[string]bool{
+	"addr": true, "affected": true, "bench": true, "concurrency": true, "config": true, "dir": true, "events": true, "events-file": true, "exclude-tags": true,
+	"filter": true, "git-branch": true, "git-changed-since": true, "grep": true, "grep-v": true, "group": true, "host-concurrency": true, "hosts": true, "junit": true, "limit": true, "lock": true,
+	"log-format": true, "log-level": true, "match": true, "o": true, "output": true, "p": true, "pprof": true, "priority-file": true, "profile": true,
+	"s": true, "shell": true, "tags": true, "timeout": true,
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// runCmd completion <shell>：输出补全脚本，组名和目录集合在补全时从合并后的配置中读取
+func runCompletion(args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd completion bash|zsh|fish")
+		fmt.Fprintln(fs.Output(), "  bash: source <(./runCmd completion bash)")
+		fmt.Fprintln(fs.Output(), "  zsh:  source <(./runCmd completion zsh)")
+		fmt.Fprintln(fs.Output(), "  fish: ./runCmd completion fish | source")
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	name := filepath.Base(os.Args[0])
+	switch fs.Arg(0) {
+	case "bash":
+		fmt.Printf(bashCompletion, name)
+	case "zsh":
+		fmt.Printf(zshCompletion, name)
+	case "fish":
+		fmt.Printf(fishCompletion, name)
+	default:
+		logger.Error(fmt.Sprintf("不支持的 shell %q，可选 %s", fs.Arg(0), strings.Join(completionShells, "、")))
+		return exitUsage
+	}
+	return exitOK
+}
+
+// 补全脚本调用的隐藏子命令：参数为命令名之后已输入的各个词，最后一个是正在输入的词，每行输出一个候选
+func runComplete(args []string) int {
+	logOut = io.Discard
+	for _, c := range completeWords(args) {
+		fmt.Println(c)
+	}
+	return exitOK
+}
+
+func completeWords(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	var positional []string
+	for i := 0; i < len(words)-1; i++ {
+		w := words[i]
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			positional = append(positional, w)
+			continue
+		}
+		name, val, hasVal := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if valueFlags[name] && !hasVal && i+1 < len(words)-1 {
+			i++
+			val = words[i]
+		}
+		switch name {
+		case "config":
+			configFlag = val
+		case "profile":
+			profileFlag = val
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		return nil
+	}
+
+	var sub string
+	if len(positional) > 0 {
+		if _, ok := findCommand(positional[0]); ok || positional[0] == "help" {
+			sub, positional = positional[0], positional[1:]
+		}
+	}
+	switch {
+	case sub == "" && len(positional) == 0:
+		var names []string
+		for _, c := range commands() {
+			names = append(names, c.Name)
+		}
+		return append(filterPrefix(names, cur), completeGroups(cur)...)
+	case sub == "help" || sub == "completion":
+		if len(positional) > 0 {
+			return nil
+		}
+		if sub == "completion" {
+			return filterPrefix(completionShells, cur)
+		}
+		var names []string
+		for _, c := range commands() {
+			names = append(names, c.Name)
+		}
+		return filterPrefix(names, cur)
+	case sub == "show" && len(positional) == 0:
+		return completeGroups(cur)
+	case sub == "run" || sub == "":
+		if len(positional) == 0 {
+			return completeGroups(cur)
+		}
+		return completeTargets(cur)
+	case sub == "exec" && len(positional) > 0:
+		return completeTargets(cur)
+	}
+	return nil
+}
+
+func filterPrefix(cands []string, prefix string) []string {
+	var out []string
+	for _, c := range cands {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// 组名，支持组链：build,te 补全为 build,test
+func completeGroups(cur string) []string {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+	head, last := "", cur
+	if i := strings.LastIndex(cur, ","); i >= 0 {
+		head, last = cur[:i+1], cur[i+1:]
+	}
+	var out []string
+	for _, g := range filterPrefix(sortedKeys(cfg.Groups), last) {
+		out = append(out, head+g)
+	}
+	return out
+}
+
+// 目录参数：@dirset 或子目录（以 / 结尾，便于继续补全）
+func completeTargets(cur string) []string {
+	if strings.HasPrefix(cur, "@") {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil
+		}
+		var out []string
+		for _, name := range filterPrefix(sortedKeys(cfg.DirSets), cur[1:]) {
+			out = append(out, "@"+name)
+		}
+		return out
+	}
+	dir, base := filepath.Split(cur)
+	entries, err := os.ReadDir(filepath.Clean("./" + dir))
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), base) && (base != "" || !strings.HasPrefix(e.Name(), ".")) {
+			out = append(out, dir+e.Name()+"/")
+		}
+	}
+	return out
+}
+
+const bashCompletion = `# runCmd 的 bash 补全：source <(%[1]s completion bash)
+_runcmd() {
+    local IFS=$'\n'
+    COMPREPLY=($("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+complete -F _runcmd %[1]s ./%[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+# runCmd 的 zsh 补全：source <(%[1]s completion zsh)
+_runcmd() {
+    local -a cands dirs others
+    cands=("${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    for c in $cands; do
+        if [[ $c == */ ]]; then dirs+=$c; elif [[ -n $c ]]; then others+=$c; fi
+    done
+    (( $#others )) && compadd -- $others
+    (( $#dirs )) && compadd -S '' -- $dirs
+}
+compdef _runcmd %[1]s
+`
+
+const fishCompletion = `# runCmd 的 fish 补全：%[1]s completion fish | source
+function __runcmd_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    $tokens[1] __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c %[1]s -f -a '(__runcmd_complete)'
+`
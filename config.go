@@ -0,0 +1,822 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 命令组结构
+type Config struct {
+	Settings map[string]string
+	Groups   map[string][]string
+	Options  map[string]map[string]string // 每个组的选项，如 timeout
+	DirSets  map[string][]string          // [dirs:name] 命名目录集合
+	Vars     map[string]string            // [vars] 模板变量
+	Env      map[string]map[string]string // [env] 与 [env:group] 环境变量，全局的键为 ""
+	Notify   map[string]string            // [notify] 运行结束后的通知
+	Weights  map[string]string            // [weights] 按目录设置调度权重
+	Depends  map[string]string            // [depends_on] 目录之间的依赖，目录 = 依赖的目录列表
+	Hooks    map[string]string            // [hooks] 运行、目录、组前后执行的命令
+	DirTags  map[string][]string          // [dirs] 清单中的目录及其标签
+	Priority map[string]string            // [dirs] 清单中的 priority=N，目录 -> 调度优先级
+	Hosts    map[string]hostEntry         // [hosts] 清单中的主机及其用户、端口、标签
+	Secrets  []string                     // [secrets] 加密区块的各行（age 或 sops dotenv 格式），执行时才解密
+	Descs    map[string]string            // 组头上方紧挨着的注释，作为组的说明
+	Sources  map[string]string            // 组来自哪个配置（embedded 或外部文件名）
+	Includes []string                     // 顶层 @include 的文件路径或通配符
+	Files    []string                     // 读取过的外部配置文件，按合并顺序
+	Profiles map[string]*Config           // [settings@prod]、[deploy@prod] 等 profile 区块
+	Merge    map[string]string            // 组头的 +append / =replace，合并到下层配置的同名组时使用
+}
+
+// 外部配置中的组与下层同名组的合并方式
+const (
+	mergeReplace = "replace" // 默认：整组替换，选项和说明一并替换
+	mergeAppend  = "append"  // 命令追加到下层组之后，选项逐项覆盖
+)
+
+func newConfig() *Config {
+	return &Config{
+		Settings: make(map[string]string),
+		Groups:   make(map[string][]string),
+		Options:  make(map[string]map[string]string),
+		DirSets:  make(map[string][]string),
+		Vars:     make(map[string]string),
+		Env:      make(map[string]map[string]string),
+		Notify:   make(map[string]string),
+		Weights:  make(map[string]string),
+		Depends:  make(map[string]string),
+		Hooks:    make(map[string]string),
+		DirTags:  make(map[string][]string),
+		Priority: make(map[string]string),
+		Hosts:    make(map[string]hostEntry),
+		Descs:    make(map[string]string),
+		Sources:  make(map[string]string),
+		Profiles: make(map[string]*Config),
+		Merge:    make(map[string]string),
+	}
+}
+
+// 组头上的合并指令：+append 或 =replace
+func mergeDirective(field string) (string, bool) {
+	switch field {
+	case "+" + mergeAppend:
+		return mergeAppend, true
+	case "=" + mergeReplace:
+		return mergeReplace, true
+	}
+	return "", false
+}
+
+// 组合并到下层配置时的方式：组头指令 > merge_strategy 设置 > replace
+func (c *Config) mergeMode(group string) string {
+	if m, ok := c.Merge[group]; ok {
+		return m
+	}
+	if c.Settings["merge_strategy"] == mergeAppend {
+		return mergeAppend
+	}
+	return mergeReplace
+}
+
+// 检查 merge_strategy 设置
+func checkMergeStrategy(cfg *Config) error {
+	switch v := cfg.Settings["merge_strategy"]; v {
+	case "", mergeReplace, mergeAppend:
+		return nil
+	default:
+		return fmt.Errorf("无效的 merge_strategy 配置 %q，可选 %s、%s", v, mergeReplace, mergeAppend)
+	}
+}
+
+// 获取 profile 的区块集合，不存在时创建
+func (c *Config) profile(name string) *Config {
+	if c.Profiles[name] == nil {
+		c.Profiles[name] = newConfig()
+	}
+	return c.Profiles[name]
+}
+
+// 获取组选项，查找顺序：组头选项 > [settings] 中的 key.group > [settings] 中的 key
+func (c *Config) groupSetting(group, key string) (string, bool) {
+	if v, ok := c.Options[group][key]; ok {
+		return v, true
+	}
+	if v, ok := c.Settings[key+"."+group]; ok {
+		return v, true
+	}
+	v, ok := c.Settings[key]
+	return v, ok
+}
+
+// 解析配置内容（从字符串）
+func parseConfig(content string) *Config {
+	cfg := newConfig()
+
+	var currentGroup, currentDirSet string
+	inManifest := false      // 当前在 [dirs] 清单中
+	inSecrets := false       // 当前在 [secrets] 加密区块中
+	inHosts := false         // 当前在 [hosts] 清单中
+	var kv map[string]string // 当前 key=value 类型的区块，如 [settings]、[vars]、[env]
+	var comments []string    // 紧挨着当前行的注释，遇到组头时作为组的说明
+	sec := cfg               // 当前区块所属的配置，profile 区块为 cfg.Profiles 中的一项
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			comments = nil
+			continue
+		}
+		if c, ok := strings.CutPrefix(line, "#"); ok {
+			comments = append(comments, strings.TrimSpace(c))
+			continue
+		}
+		desc := strings.Join(comments, " ")
+		comments = nil
+
+		// 组之外的 @include 引入其他配置文件，组内的 @include 引用其他组
+		if inc, ok := strings.CutPrefix(line, "@include "); ok && currentGroup == "" && currentDirSet == "" {
+			cfg.Includes = append(cfg.Includes, strings.TrimSpace(inc))
+			continue
+		}
+
+		// 检测分组，支持 [build timeout=10m] 形式的组选项
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			fields := splitHeaderFields(strings.Trim(line, "[]"))
+			currentGroup, currentDirSet, kv, inManifest, inSecrets, inHosts = "", "", nil, false, false, false
+			if len(fields) == 0 {
+				continue
+			}
+			// [deploy@prod] 这样带 @profile 的区块只在 --profile prod 时叠加到同名区块上
+			name := fields[0]
+			sec = cfg
+			if base, profile, ok := strings.Cut(name, "@"); ok && profile != "" {
+				name, sec = base, cfg.profile(profile)
+			}
+			switch {
+			case name == "settings":
+				kv = sec.Settings
+			case name == "vars":
+				kv = sec.Vars
+			case name == "notify":
+				kv = sec.Notify
+			case name == "weights":
+				kv = sec.Weights
+			case name == "depends_on":
+				kv = sec.Depends
+			case name == "hooks":
+				kv = sec.Hooks
+			case name == "env":
+				kv = sec.envFor("")
+			case strings.HasPrefix(name, "env:"):
+				kv = sec.envFor(strings.TrimPrefix(name, "env:"))
+			case strings.HasPrefix(name, "dirs:"):
+				currentDirSet = strings.TrimPrefix(name, "dirs:")
+				sec.DirSets[currentDirSet] = []string{}
+			case name == "dirs":
+				inManifest = true
+			case name == "hosts":
+				inHosts = true
+			case name == "secrets":
+				// 同一配置中只有一个加密区块
+				inSecrets = true
+				sec.Secrets = nil
+			default:
+				currentGroup = name
+				sec.Groups[currentGroup] = []string{}
+				if desc != "" {
+					sec.Descs[currentGroup] = desc
+				}
+				for _, f := range fields[1:] {
+					if m, ok := mergeDirective(f); ok {
+						sec.Merge[currentGroup] = m
+					} else if k, v, ok := strings.Cut(f, "="); ok {
+						if sec.Options[currentGroup] == nil {
+							sec.Options[currentGroup] = make(map[string]string)
+						}
+						sec.Options[currentGroup][k] = v
+					}
+				}
+			}
+			continue
+		}
+
+		switch {
+		case currentDirSet != "":
+			sec.DirSets[currentDirSet] = append(sec.DirSets[currentDirSet], line)
+		case inSecrets:
+			sec.Secrets = append(sec.Secrets, line)
+		case inHosts:
+			host, h := parseHostLine(line)
+			sec.Hosts[host] = h
+		case inManifest:
+			dir, tags, priority := parseManifestLine(line)
+			sec.DirTags[dir] = tags
+			if priority != "" {
+				sec.Priority[dir] = priority
+			}
+		case kv != nil:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) == 2 {
+				key := strings.TrimSpace(parts[0])
+				val := strings.TrimSpace(parts[1])
+				kv[key] = val
+			}
+		case currentGroup != "":
+			sec.Groups[currentGroup] = append(sec.Groups[currentGroup], line)
+		}
+	}
+
+	return cfg
+}
+
+// 解析 [dirs] 清单中的一行：services/api  tags=go,backend priority=10
+func parseManifestLine(line string) (string, []string, string) {
+	fields := splitHeaderFields(line)
+	var tags []string
+	priority := ""
+	for _, f := range fields[1:] {
+		if v, ok := strings.CutPrefix(f, "priority="); ok {
+			priority = v
+		}
+		if v, ok := strings.CutPrefix(f, "tags="); ok {
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	return fields[0], tags, priority
+}
+
+// 拆分组头字段，值可以用双引号包含空格：[build shell="bash -euo pipefail"]
+func splitHeaderFields(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuote, has := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote, has = !inQuote, true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if has {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				has = false
+			}
+		default:
+			cur.WriteRune(r)
+			has = true
+		}
+	}
+	if has {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+// 获取 [env]（group 为空）或 [env:group] 的变量表，不存在时创建
+func (c *Config) envFor(group string) map[string]string {
+	if c.Env[group] == nil {
+		c.Env[group] = make(map[string]string)
+	}
+	return c.Env[group]
+}
+
+// 合并配置（外部覆盖默认）
+func mergeConfig(base, override *Config) *Config {
+	result := newConfig()
+
+	// base
+	for k, v := range base.Settings {
+		result.Settings[k] = v
+	}
+	for k, v := range base.Vars {
+		result.Vars[k] = v
+	}
+	for k, v := range base.Notify {
+		result.Notify[k] = v
+	}
+	for k, v := range base.Weights {
+		result.Weights[k] = v
+	}
+	for k, v := range base.Depends {
+		result.Depends[k] = v
+	}
+	for k, v := range base.Hooks {
+		result.Hooks[k] = v
+	}
+	for dir, tags := range base.DirTags {
+		result.DirTags[dir] = tags
+	}
+	for dir, prio := range base.Priority {
+		result.Priority[dir] = prio
+	}
+	for host, h := range base.Hosts {
+		result.Hosts[host] = h
+	}
+	for g, d := range base.Descs {
+		result.Descs[g] = d
+	}
+	for g, src := range base.Sources {
+		result.Sources[g] = src
+	}
+	result.Files = append(append([]string{}, base.Files...), override.Files...)
+	for name, p := range base.Profiles {
+		result.Profiles[name] = mergeConfig(newConfig(), p)
+	}
+	for name, p := range override.Profiles {
+		result.Profiles[name] = mergeConfig(result.profile(name), p)
+	}
+	for g, cmds := range base.Groups {
+		result.Groups[g] = append([]string{}, cmds...)
+	}
+	for g, m := range base.Merge {
+		result.Merge[g] = m
+	}
+	for g, opts := range base.Options {
+		result.Options[g] = copyMap(opts)
+	}
+	for g, env := range base.Env {
+		result.Env[g] = copyMap(env)
+	}
+	for name, dirs := range base.DirSets {
+		result.DirSets[name] = append([]string{}, dirs...)
+	}
+
+	result.Secrets = base.Secrets
+	if len(override.Secrets) > 0 {
+		result.Secrets = override.Secrets
+	}
+
+	// override 覆盖（组被替换时其选项一并替换；append 时追加命令、逐项覆盖选项）
+	appended := make(map[string]bool)
+	for k, v := range override.Settings {
+		result.Settings[k] = v
+	}
+	for k, v := range override.Vars {
+		result.Vars[k] = v
+	}
+	for k, v := range override.Notify {
+		result.Notify[k] = v
+	}
+	for k, v := range override.Weights {
+		result.Weights[k] = v
+	}
+	for k, v := range override.Depends {
+		result.Depends[k] = v
+	}
+	for k, v := range override.Hooks {
+		result.Hooks[k] = v
+	}
+	for dir, tags := range override.DirTags {
+		result.DirTags[dir] = tags
+	}
+	for dir, prio := range override.Priority {
+		result.Priority[dir] = prio
+	}
+	for host, h := range override.Hosts {
+		result.Hosts[host] = h
+	}
+	for g, cmds := range override.Groups {
+		if _, ok := base.Groups[g]; !ok {
+			// 下层没有的组保留合并指令，继续对更下层的配置生效（如 @include 的文件）
+			result.Groups[g] = append([]string{}, cmds...)
+			result.Sources[g] = override.Sources[g]
+			if m, ok := override.Merge[g]; ok {
+				result.Merge[g] = m
+			}
+			continue
+		}
+		if override.mergeMode(g) == mergeAppend {
+			result.Groups[g] = append(result.Groups[g], cmds...)
+			result.Sources[g] = override.Sources[g] + " (extends " + base.Sources[g] + ")"
+			appended[g] = true
+			continue
+		}
+		result.Groups[g] = append([]string{}, cmds...)
+		delete(result.Options, g)
+		delete(result.Descs, g)
+		result.Sources[g] = override.Sources[g] + " (overrides " + base.Sources[g] + ")"
+	}
+	for g, d := range override.Descs {
+		result.Descs[g] = d
+	}
+	for g, opts := range override.Options {
+		if !appended[g] || result.Options[g] == nil {
+			result.Options[g] = copyMap(opts)
+			continue
+		}
+		for k, v := range opts {
+			result.Options[g][k] = v
+		}
+	}
+	for g, env := range override.Env {
+		for k, v := range env {
+			result.envFor(g)[k] = v
+		}
+	}
+	for name, dirs := range override.DirSets {
+		result.DirSets[name] = append([]string{}, dirs...)
+	}
+
+	return result
+}
+
+// 记录全部组（含 profile 中的组）的来源
+func (c *Config) setSource(src string) {
+	for g := range c.Groups {
+		c.Sources[g] = src
+	}
+	for _, p := range c.Profiles {
+		p.setSource(src)
+	}
+}
+
+// 把 profile 叠加到基础配置上：设置、变量等按键覆盖，组的选项按键覆盖，
+// profile 中写了命令的组替换原有命令（只写选项时保留原命令）
+func (c *Config) applyProfile(name string) error {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("配置中没有 profile %q", name)
+	}
+	for _, kv := range [][2]map[string]string{
+		{c.Settings, p.Settings}, {c.Vars, p.Vars}, {c.Notify, p.Notify}, {c.Weights, p.Weights},
+		{c.Depends, p.Depends}, {c.Hooks, p.Hooks},
+	} {
+		for k, v := range kv[1] {
+			kv[0][k] = v
+		}
+	}
+	for scope, env := range p.Env {
+		for k, v := range env {
+			c.envFor(scope)[k] = v
+		}
+	}
+	for set, dirs := range p.DirSets {
+		c.DirSets[set] = append([]string{}, dirs...)
+	}
+	for dir, tags := range p.DirTags {
+		c.DirTags[dir] = tags
+	}
+	for dir, prio := range p.Priority {
+		c.Priority[dir] = prio
+	}
+	for host, h := range p.Hosts {
+		c.Hosts[host] = h
+	}
+	if len(p.Secrets) > 0 {
+		c.Secrets = p.Secrets
+	}
+	for g, cmds := range p.Groups {
+		if _, exists := c.Groups[g]; !exists || len(cmds) > 0 && p.Merge[g] != mergeAppend {
+			c.Groups[g] = append([]string{}, cmds...)
+		} else {
+			c.Groups[g] = append(c.Groups[g], cmds...)
+		}
+		c.Sources[g] = p.Sources[g] + " @" + name
+		if d, ok := p.Descs[g]; ok {
+			c.Descs[g] = d
+		}
+	}
+	for g, opts := range p.Options {
+		if c.Options[g] == nil {
+			c.Options[g] = make(map[string]string)
+		}
+		for k, v := range opts {
+			c.Options[g][k] = v
+		}
+	}
+	return nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// 按字母顺序返回 map 的键
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 解析时长，纯数字按秒处理
+func parseDuration(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// 读取时长类型的组选项/设置，未配置时返回默认值
+func (c *Config) durationSetting(group, key string, def time.Duration) (time.Duration, error) {
+	v, ok := c.groupSetting(group, key)
+	if !ok {
+		return def, nil
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("无效的 %s 配置 %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+// 读取非负整数类型的组选项/设置，未配置时返回默认值
+func (c *Config) intSetting(group, key string, def int) (int, error) {
+	v, ok := c.groupSetting(group, key)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的 %s 配置 %q", key, v)
+	}
+	return n, nil
+}
+
+// 解析字节数，支持 K/M/G 后缀（1024 进制），如 64K、1M
+func parseSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult, s = 1<<10, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1<<20, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		mult, s = 1<<30, strings.TrimSuffix(s, "G")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小 %q", v)
+	}
+	return n * mult, nil
+}
+
+// 读取字节数类型的组选项/设置，未配置时返回默认值
+func (c *Config) sizeSetting(group, key string, def int64) (int64, error) {
+	v, ok := c.groupSetting(group, key)
+	if !ok {
+		return def, nil
+	}
+	n, err := parseSize(v)
+	if err != nil {
+		return 0, fmt.Errorf("无效的 %s 配置 %q", key, v)
+	}
+	return n, nil
+}
+
+// 读取布尔类型的组选项/设置，未配置时返回默认值
+func (c *Config) boolSetting(group, key string, def bool) (bool, error) {
+	v, ok := c.groupSetting(group, key)
+	if !ok {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("无效的 %s 配置 %q", key, v)
+	}
+	return b, nil
+}
+
+// 组不存在
+var errGroupNotFound = errors.New("未找到组")
+
+// 展开要执行的组链：按命令行顺序，并把 deps 选项声明的依赖组排在前面
+func (c *Config) resolveGroupChain(names []string) ([]string, error) {
+	var chain []string
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("组依赖存在循环: %s", strings.Join(append(path, name), " -> "))
+		}
+		if _, ok := c.Groups[name]; !ok {
+			return c.groupNotFound(name)
+		}
+		visiting[name] = true
+		for _, dep := range strings.Split(c.Options[name]["deps"], ",") {
+			if dep = strings.TrimSpace(dep); dep != "" {
+				if err := visit(dep, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		chain = append(chain, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		name, err := c.matchGroup(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(chain) == 0 {
+		// "" 或 "," 这样没有组名的参数
+		return nil, fmt.Errorf("%w: 没有指定组名", errGroupNotFound)
+	}
+	return chain, nil
+}
+
+// 子组中标记父组命令位置的行，没有时父组命令在前
+const superLine = "{{super}}"
+
+// 处理组的 extends=parent：继承父组的命令、组级设置（组头选项和 key.parent）、组参数和 [env:parent]，
+// 子组自己的同名项优先；父组也可以 extends，检测循环引用
+func (c *Config) resolveExtends() error {
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var resolve func(name string, path []string) error
+	resolve = func(name string, path []string) error {
+		parent := strings.TrimSpace(c.Options[name]["extends"])
+		if done[name] || parent == "" {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("extends 存在循环: %s", strings.Join(append(path, name), " -> "))
+		}
+		if _, ok := c.Groups[parent]; !ok {
+			return fmt.Errorf("组 [%s] 继承的组 [%s] 不存在", name, parent)
+		}
+		visiting[name] = true
+		if err := resolve(parent, append(path, name)); err != nil {
+			return err
+		}
+		visiting[name] = false
+		done[name] = true
+
+		own := c.Groups[name]
+		cmds := make([]string, 0, len(own)+len(c.Groups[parent]))
+		if i := slices.Index(own, superLine); i >= 0 {
+			cmds = append(append(append(cmds, own[:i]...), c.Groups[parent]...), own[i+1:]...)
+		} else {
+			cmds = append(append(cmds, c.Groups[parent]...), own...)
+		}
+		c.Groups[name] = cmds
+
+		opts := c.Options[name]
+		for k, v := range c.Options[parent] {
+			if _, ok := opts[k]; !ok && k != "extends" && !c.hasSetting(k+"."+name) {
+				opts[k] = v
+			}
+		}
+		// 父组在 [settings] 中的 key.parent 也按组头选项继承
+		for k, v := range c.Settings {
+			base, g, ok := strings.Cut(k, ".")
+			if _, set := opts[base]; ok && g == parent && !set && !c.hasSetting(base+"."+name) {
+				opts[base] = v
+			}
+		}
+		if vars := c.Env[parent]; len(vars) > 0 {
+			if c.Env[name] == nil {
+				c.Env[name] = make(map[string]string)
+			}
+			for k, v := range vars {
+				if _, ok := c.Env[name][k]; !ok {
+					c.Env[name][k] = v
+				}
+			}
+		}
+		if _, ok := c.Descs[name]; !ok && c.Descs[parent] != "" {
+			c.Descs[name] = c.Descs[parent]
+		}
+		return nil
+	}
+
+	for _, name := range sortedKeys(c.Groups) {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) hasSetting(key string) bool {
+	_, ok := c.Settings[key]
+	return ok
+}
+
+// 展开组内的 @include other-group 行，递归处理并检测循环引用
+func (c *Config) expandIncludes() error {
+	expanded := make(map[string][]string, len(c.Groups))
+	visiting := make(map[string]bool)
+
+	var expand func(name string, path []string) ([]string, error)
+	expand = func(name string, path []string) ([]string, error) {
+		if cmds, ok := expanded[name]; ok {
+			return cmds, nil
+		}
+		if visiting[name] {
+			return nil, fmt.Errorf("@include 存在循环: %s", strings.Join(append(path, name), " -> "))
+		}
+		visiting[name] = true
+		var out []string
+		for _, line := range c.Groups[name] {
+			target, ok := strings.CutPrefix(line, "@include ")
+			if !ok {
+				out = append(out, line)
+				continue
+			}
+			target = strings.TrimSpace(target)
+			if _, exists := c.Groups[target]; !exists {
+				return nil, fmt.Errorf("组 [%s] 引用的组 [%s] 不存在", name, target)
+			}
+			cmds, err := expand(target, append(path, name))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, cmds...)
+		}
+		visiting[name] = false
+		expanded[name] = out
+		return out, nil
+	}
+
+	for _, name := range sortedKeys(c.Groups) {
+		if _, err := expand(name, nil); err != nil {
+			return err
+		}
+	}
+	c.Groups = expanded
+	return nil
+}
+
+// 读取外部配置文件并合并其中 @include 的文件：被包含的文件按出现顺序（通配符按文件名排序）先合并，
+// 当前文件最后合并，同名的组和设置以当前文件为准；相对路径相对于当前文件所在目录
+func readConfigFile(path string, stack []string) (*Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("@include 存在循环: %s", strings.Join(append(stack, abs), " -> "))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	own, err := parseConfigFile(path, string(data))
+	if err != nil {
+		return nil, err
+	}
+	own.setSource(path)
+	own.Files = []string{path}
+
+	cfg := newConfig()
+	for _, inc := range own.Includes {
+		pattern := inc
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("%s: 无效的 @include 通配符 %q: %w", path, inc, err)
+			}
+			if len(matches) == 0 {
+				logger.Warn(fmt.Sprintf("%s: @include %s 没有匹配到任何文件", path, inc), "config", path)
+			}
+		}
+		for _, m := range matches {
+			included, err := readConfigFile(m, append(stack, abs))
+			if err != nil {
+				return nil, fmt.Errorf("%s: @include %s: %w", path, inc, err)
+			}
+			cfg = mergeConfig(cfg, included)
+		}
+	}
+	return mergeConfig(cfg, own), nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:    "组、组选项与说明",
+			content: "# 构建\n[build timeout=10m]\ngo build ./...\n\n# 与 test 之间隔着空行\n\n[test]\ngo test ./...\n",
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Groups["build"]; !reflect.DeepEqual(got, []string{"go build ./..."}) {
+					t.Errorf("build = %q", got)
+				}
+				if got := cfg.Options["build"]["timeout"]; got != "10m" {
+					t.Errorf("build timeout = %q", got)
+				}
+				if got := cfg.Groups["test"]; !reflect.DeepEqual(got, []string{"go test ./..."}) {
+					t.Errorf("test = %q", got)
+				}
+				if got := cfg.Descs["build"]; got != "构建" {
+					t.Errorf("build desc = %q", got)
+				}
+				if _, ok := cfg.Descs["test"]; ok {
+					t.Errorf("空行之后的组不应有说明")
+				}
+			},
+		},
+		{
+			name:    "settings、vars 与 env",
+			content: "[settings]\nconcurrency = 3\n[vars]\nIMAGE=app\n[env]\nA = 1\n[env:build]\nB = 2\n",
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Settings["concurrency"]; got != "3" {
+					t.Errorf("concurrency = %q", got)
+				}
+				if got := cfg.Vars["IMAGE"]; got != "app" {
+					t.Errorf("IMAGE = %q", got)
+				}
+				if got := cfg.Env[""]["A"]; got != "1" {
+					t.Errorf("A = %q", got)
+				}
+				if got := cfg.Env["build"]["B"]; got != "2" {
+					t.Errorf("B = %q", got)
+				}
+			},
+		},
+		{
+			name:    "顶层 @include",
+			content: "@include team.txt\n@include ci/*.txt\n[build]\n@include lint\n",
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg.Includes, []string{"team.txt", "ci/*.txt"}) {
+					t.Errorf("includes = %q", cfg.Includes)
+				}
+				// 组内的 @include 引用其他组，不算文件
+				if got := cfg.Groups["build"]; !reflect.DeepEqual(got, []string{"@include lint"}) {
+					t.Errorf("build = %q", got)
+				}
+			},
+		},
+		{
+			name:    "profile 区块",
+			content: "[settings]\nconcurrency = 3\n[settings@prod]\nconcurrency = 1\n",
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Settings["concurrency"]; got != "3" {
+					t.Errorf("concurrency = %q", got)
+				}
+				if got := cfg.Profiles["prod"].Settings["concurrency"]; got != "1" {
+					t.Errorf("prod concurrency = %q", got)
+				}
+			},
+		},
+		{
+			name:    "合并指令",
+			content: "[build +append]\nmake\n[lint =replace]\nlint\n[test]\ngo test\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Merge["build"] != mergeAppend || cfg.Merge["lint"] != mergeReplace {
+					t.Errorf("merge = %v", cfg.Merge)
+				}
+				if _, ok := cfg.Merge["test"]; ok {
+					t.Errorf("test 没有合并指令")
+				}
+				if _, ok := cfg.Options["build"]["+append"]; ok {
+					t.Errorf("合并指令不应作为组选项")
+				}
+			},
+		},
+		{
+			name:    "hosts 清单",
+			content: "[hosts]\nweb1 user=deploy port=2222 tags=web,eu\n",
+			check: func(t *testing.T, cfg *Config) {
+				want := hostEntry{User: "deploy", Port: "2222", Tags: []string{"web", "eu"}}
+				if got := cfg.Hosts["web1"]; !reflect.DeepEqual(got, want) {
+					t.Errorf("web1 = %+v", got)
+				}
+			},
+		},
+		{
+			name:    "目录集合",
+			content: "[dirs:web]\napps/web\napps/api\n",
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.DirSets["web"]; !reflect.DeepEqual(got, []string{"apps/web", "apps/api"}) {
+					t.Errorf("web = %q", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, parseConfig(tt.content))
+		})
+	}
+}
+
+func TestReadConfigFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("team/a.txt", "[settings]\nconcurrency = 2\n[build]\nmake a\n[lint]\nlint a\n")
+	write("team/b.txt", "[build]\nmake b\n")
+	main := write("config.txt", "@include team/*.txt\n[settings]\nshell = sh\n[lint]\nlint own\n")
+
+	cfg, err := readConfigFile(main, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 被包含的文件按文件名顺序先合并，当前文件最后合并
+	if got := cfg.Groups["build"]; !reflect.DeepEqual(got, []string{"make b"}) {
+		t.Errorf("build = %q", got)
+	}
+	if got := cfg.Groups["lint"]; !reflect.DeepEqual(got, []string{"lint own"}) {
+		t.Errorf("lint = %q", got)
+	}
+	if cfg.Settings["concurrency"] != "2" || cfg.Settings["shell"] != "sh" {
+		t.Errorf("settings = %v", cfg.Settings)
+	}
+
+	write("x.txt", "@include y.txt\n")
+	write("y.txt", "@include x.txt\n")
+	if _, err := readConfigFile(filepath.Join(dir, "x.txt"), nil); err == nil || !strings.Contains(err.Error(), "循环") {
+		t.Errorf("循环 @include 应报错，得到 %v", err)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	content := "[settings]\nconcurrency = 3\n[env]\nSTAGE = dev\n" +
+		"[deploy timeout=10m]\n./deploy.sh\n[build]\nmake\n" +
+		"[settings@prod]\nconcurrency = 1\n[env@prod]\nSTAGE = prod\n" +
+		"[deploy@prod timeout=30m]\n[build@prod]\nmake release\n"
+	tests := []struct {
+		name    string
+		profile string
+		wantErr bool
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:    "叠加设置、环境与组",
+			profile: "prod",
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Settings["concurrency"]; got != "1" {
+					t.Errorf("concurrency = %q", got)
+				}
+				if got := cfg.Env[""]["STAGE"]; got != "prod" {
+					t.Errorf("STAGE = %q", got)
+				}
+				// 只写选项的组保留原命令
+				if got := cfg.Groups["deploy"]; !reflect.DeepEqual(got, []string{"./deploy.sh"}) {
+					t.Errorf("deploy = %q", got)
+				}
+				if got := cfg.Options["deploy"]["timeout"]; got != "30m" {
+					t.Errorf("deploy timeout = %q", got)
+				}
+				if got := cfg.Groups["build"]; !reflect.DeepEqual(got, []string{"make release"}) {
+					t.Errorf("build = %q", got)
+				}
+			},
+		},
+		{
+			name:    "未知的 profile",
+			profile: "staging",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseConfig(content)
+			err := cfg.applyProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		override  string
+		group     string
+		wantCmds  []string
+		wantOpts  map[string]string
+		wantSetts map[string]string
+	}{
+		{
+			name:      "默认整组替换",
+			base:      "[settings]\nconcurrency = 3\nshell = bash\n[build timeout=10m]\nmake\n",
+			override:  "[settings]\nconcurrency = 1\n[build]\nmake all\n",
+			group:     "build",
+			wantCmds:  []string{"make all"},
+			wantOpts:  nil,
+			wantSetts: map[string]string{"concurrency": "1", "shell": "bash"},
+		},
+		{
+			name:     "+append 追加命令并逐项覆盖选项",
+			base:     "[build timeout=10m retries=2]\nmake\n",
+			override: "[build +append timeout=1m]\nmake install\n",
+			group:    "build",
+			wantCmds: []string{"make", "make install"},
+			wantOpts: map[string]string{"timeout": "1m", "retries": "2"},
+		},
+		{
+			name:     "merge_strategy=append",
+			base:     "[build]\nmake\n",
+			override: "[settings]\nmerge_strategy = append\n[build]\nmake install\n",
+			group:    "build",
+			wantCmds: []string{"make", "make install"},
+		},
+		{
+			name:     "=replace 优先于 merge_strategy",
+			base:     "[build]\nmake\n",
+			override: "[settings]\nmerge_strategy = append\n[build =replace]\nmake install\n",
+			group:    "build",
+			wantCmds: []string{"make install"},
+		},
+		{
+			name:     "下层没有的组",
+			base:     "[build]\nmake\n",
+			override: "[lint]\ngolangci-lint run\n",
+			group:    "lint",
+			wantCmds: []string{"golangci-lint run"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mergeConfig(parseConfig(tt.base), parseConfig(tt.override))
+			if got := cfg.Groups[tt.group]; !reflect.DeepEqual(got, tt.wantCmds) {
+				t.Errorf("cmds = %q, want %q", got, tt.wantCmds)
+			}
+			if got := cfg.Options[tt.group]; len(got) != 0 || len(tt.wantOpts) != 0 {
+				if !reflect.DeepEqual(got, tt.wantOpts) {
+					t.Errorf("options = %v, want %v", got, tt.wantOpts)
+				}
+			}
+			for k, want := range tt.wantSetts {
+				if got := cfg.Settings[k]; got != want {
+					t.Errorf("settings[%s] = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveGroupChain(t *testing.T) {
+	cfg := parseConfig("[pull]\ngit pull\n[build deps=pull]\nmake\n[test deps=build]\nmake test\n[a deps=b]\na\n[b deps=a]\nb\n")
+	tests := []struct {
+		args    string
+		want    []string
+		wantErr error
+	}{
+		{args: "test", want: []string{"pull", "build", "test"}},
+		{args: "build,pull", want: []string{"pull", "build"}},
+		{args: " pull , build ", want: []string{"pull", "build"}},
+		{args: "nope", wantErr: errGroupNotFound},
+		{args: "", wantErr: errGroupNotFound},
+		{args: ",", wantErr: errGroupNotFound},
+		{args: " , ", wantErr: errGroupNotFound},
+	}
+	for _, tt := range tests {
+		got, err := cfg.resolveGroupChain(strings.Split(tt.args, ","))
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("resolveGroupChain(%q) err = %v, want %v", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolveGroupChain(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+	if _, err := cfg.resolveGroupChain([]string{"a"}); err == nil || !strings.Contains(err.Error(), "循环") {
+		t.Errorf("循环依赖应报错，得到 %v", err)
+	}
+}
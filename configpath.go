@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 各目录中依次查找的配置文件名
+var externalConfigFiles = []string{"config.txt", "config.yaml", "config.yml"}
+
+// --config 指定的配置文件和 --profile 选择的 profile，各子命令共用（-s 见 overrides.go）
+var configFlag, profileFlag string
+
+func addConfigFlag(fs *flag.FlagSet) {
+	fs.StringVar(&configFlag, "config", configFlag, "配置文件路径，默认按查找顺序使用第一个存在的配置")
+	fs.StringVar(&profileFlag, "profile", profileFlag, "叠加 [settings@name]、[group@name] 等 profile 区块")
+	fs.Var(&settingFlags, "s", "覆盖设置 key=value（key.group 只覆盖该组），可重复，优先于配置文件")
+}
+
+// 按顺序查找外部配置，返回路径和来源说明；都没有时返回空路径，只使用内嵌配置：
+//
+//  1. --config 指定的文件或 http(s) 地址（见 fetchConfig）
+//  2. 环境变量 RUNCMD_CONFIG
+//  3. 当前目录的 config.txt / config.yaml / config.yml
+//  4. 当前所在 git 仓库根目录下的同名文件
+//  5. $XDG_CONFIG_HOME/runcmd/（默认 ~/.config/runcmd/）下的同名文件
+//
+// 前两项显式指定的文件不存在时报错
+func findConfigFile() (string, string, error) {
+	if configFlag != "" {
+		return explicitConfig(configFlag, "--config")
+	}
+	if v := os.Getenv("RUNCMD_CONFIG"); v != "" {
+		return explicitConfig(v, "RUNCMD_CONFIG")
+	}
+	if name, ok := firstConfigIn("."); ok {
+		return name, "当前目录", nil
+	}
+	if root, ok := gitRoot(); ok {
+		if name, ok := firstConfigIn(root); ok {
+			return name, "git 仓库根目录", nil
+		}
+	}
+	if dir, ok := userConfigDir(); ok {
+		if name, ok := firstConfigIn(filepath.Join(dir, "runcmd")); ok {
+			return name, "用户配置目录", nil
+		}
+	}
+	return "", "", nil
+}
+
+// $XDG_CONFIG_HOME，未设置时为 ~/.config（各平台一致）
+func userConfigDir() (string, bool) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(home, ".config"), true
+}
+
+func explicitConfig(path, from string) (string, string, error) {
+	if isConfigURL(path) {
+		return path, from, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", fmt.Errorf("%s 指定的配置文件不可用: %w", from, err)
+	}
+	if info.IsDir() {
+		return "", "", fmt.Errorf("%s 指定的配置 %s 是目录", from, path)
+	}
+	return path, from, nil
+}
+
+func firstConfigIn(dir string) (string, bool) {
+	for _, name := range externalConfigFiles {
+		path := name
+		if dir != "." {
+			path = filepath.Join(dir, name)
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// 从当前目录向上查找包含 .git 的目录；当前目录本身就是根目录时不算，避免重复查找
+func gitRoot() (string, bool) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for dir := wd; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, dir != wd
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
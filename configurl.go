@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 下载远程配置的超时，超时后使用缓存
+const configFetchTimeout = 10 * time.Second
+
+func isConfigURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// 远程配置的本地缓存：$XDG_CACHE_HOME/runcmd/config/（默认 ~/.cache）下按 URL 的哈希命名，
+// 保留原扩展名以区分 YAML；旁边的 .etag 文件记录服务器返回的 ETag
+func configCachePath(rawURL string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	ext := ".txt"
+	if u, err := url.Parse(rawURL); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	return filepath.Join(dir, "runcmd", "config", hex.EncodeToString(sum[:8])+ext), nil
+}
+
+// 下载远程配置并返回本地缓存路径。带上次的 ETag 请求，304 时直接用缓存；
+// 新内容解析失败时保留旧缓存并报错；网络不可用时有缓存就用缓存。
+// 环境变量 RUNCMD_CONFIG_TOKEN 作为 Bearer token 发送，只用于 https://
+func fetchConfig(rawURL string) (string, error) {
+	token := os.Getenv("RUNCMD_CONFIG_TOKEN")
+	if token != "" && !strings.HasPrefix(rawURL, "https://") {
+		return "", fmt.Errorf("设置了 RUNCMD_CONFIG_TOKEN 时配置地址必须是 https://，拒绝以明文发送 token: %s", rawURL)
+	}
+	cache, err := configCachePath(rawURL)
+	if err != nil {
+		return "", err
+	}
+	etagFile := cache + ".etag"
+	_, statErr := os.Stat(cache)
+	cached := statErr == nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), configFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("无效的配置地址 %s: %w", rawURL, err)
+	}
+	if etag, err := os.ReadFile(etagFile); err == nil && cached {
+		req.Header.Set("If-None-Match", strings.TrimSpace(string(etag)))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	data, etag, notModified, err := doConfigRequest(req)
+	switch {
+	case err != nil && cached:
+		logger.Warn(fmt.Sprintf("下载配置 %s 失败，使用缓存: %v", rawURL, err), "config", rawURL, "error", err)
+		return cache, nil
+	case err != nil:
+		return "", fmt.Errorf("下载配置 %s 失败: %w", rawURL, err)
+	case notModified:
+		logger.Debug(fmt.Sprintf("配置 %s 未变化，使用缓存", rawURL), "config", rawURL)
+		return cache, nil
+	}
+
+	if _, err := parseConfigFile(cache, string(data)); err != nil {
+		if cached {
+			logger.Warn(fmt.Sprintf("下载的配置 %s 无效，继续使用缓存: %v", rawURL, err), "config", rawURL, "error", err)
+			return cache, nil
+		}
+		return "", fmt.Errorf("下载的配置 %s 无效: %w", rawURL, err)
+	}
+	for _, issue := range lintConfigFile(rawURL, string(data)) {
+		logger.Warn(issue.String(), "config", rawURL)
+	}
+	if err := writeFileAtomic(cache, data); err != nil {
+		return "", fmt.Errorf("缓存配置 %s 失败: %w", rawURL, err)
+	}
+	if etag != "" {
+		_ = os.WriteFile(etagFile, []byte(etag+"\n"), 0o644)
+	} else if err := os.Remove(etagFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	logger.Info(fmt.Sprintf("已更新远程配置 %s", rawURL), "config", rawURL)
+	return cache, nil
+}
+
+// 带 token 的请求不跟随到 http:// 的重定向
+var configClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" && req.Header.Get("Authorization") != "" {
+			return fmt.Errorf("拒绝重定向到 %s：不以明文发送 RUNCMD_CONFIG_TOKEN", req.URL.Redacted())
+		}
+		if len(via) >= 10 {
+			return errors.New("重定向次数过多")
+		}
+		return nil
+	},
+}
+
+func doConfigRequest(req *http.Request) (data []byte, etag string, notModified bool, err error) {
+	resp, err := configClient.Do(req)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, "", true, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", false, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if data, err = io.ReadAll(resp.Body); err != nil {
+		return nil, "", false, err
+	}
+	return data, resp.Header.Get("ETag"), false, nil
+}
+
+// 先写临时文件再改名，其他 runCmd 进程不会读到写了一半的配置
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// 读取远程配置：组的来源显示为 URL
+func readConfigURL(rawURL string) (*Config, error) {
+	name, err := fetchConfig(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := readConfigFile(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg.setSource(rawURL)
+	return cfg, nil
+}
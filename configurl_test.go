@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchConfigTokenNeedsHTTPS(t *testing.T) {
+	t.Setenv("RUNCMD_CONFIG_TOKEN", "s3cr3t")
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+	if _, err := fetchConfig(srv.URL + "/config.txt"); err == nil || !strings.Contains(err.Error(), "https://") {
+		t.Errorf("http:// 地址带 token 应报错，得到 %v", err)
+	}
+	if gotAuth != "" {
+		t.Errorf("token 不应以明文发送")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// 组链中需要确认后才执行的组：组设置 confirm=true 或列在 protected_groups 中
+func protectedGroups(cfg *Config, names []string) ([]string, error) {
+	listed := splitTags(cfg.Settings["protected_groups"])
+	var out []string
+	for _, name := range names {
+		on, err := cfg.boolSetting(name, "confirm", false)
+		if err != nil {
+			return nil, err
+		}
+		if on || slices.Contains(listed, name) {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// 打印将要执行的目录和命令，读取一行输入，只有 yes 才继续
+func confirmRun(in io.Reader, out io.Writer, targets []*target, chain []*runOptions, protected []string) bool {
+	fmt.Fprintf(out, "组 [%s] 需要确认，将在以下 %d 个目录执行:\n", strings.Join(protected, "], ["), len(targets))
+	for _, t := range targets {
+		fmt.Fprintf(out, "  %s\n", t.Dir)
+	}
+	first := targets[0]
+	for _, opts := range chain {
+		templated := false
+		fmt.Fprintf(out, "组 [%s] 的命令 (%s):\n", opts.Group, opts.Shell)
+		for _, step := range opts.Steps {
+			templated = templated || strings.Contains(step.String(), "{{")
+			for _, line := range strings.Split(step.expand(first, opts).String(), "\n") {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+		if templated && len(targets) > 1 {
+			fmt.Fprintf(out, "  （以 %s 为例，模板变量按目录展开）\n", first.Dir)
+		}
+	}
+	fmt.Fprint(out, "输入 yes 继续: ")
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	if !strings.HasSuffix(line, "\n") {
+		fmt.Fprintln(out)
+	}
+	return strings.TrimSpace(line) == "yes"
+}
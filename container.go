@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 容器内挂载目标目录的默认工作目录
+const defaultContainerWorkdir = "/work"
+
+// container 选项：镜像名时用 docker run 新建容器，exec:name 时进入已有容器
+type containerSpec struct {
+	Image   string   // docker run 使用的镜像
+	Name    string   // docker exec 进入的容器名
+	Workdir string   // 容器内的工作目录
+	Options []string // 追加给 docker run/exec 的参数
+}
+
+func parseContainerSetting(v string) containerSpec {
+	v = strings.TrimSpace(v)
+	if name, ok := strings.CutPrefix(v, "exec:"); ok {
+		return containerSpec{Name: strings.TrimSpace(name)}
+	}
+	return containerSpec{Image: v}
+}
+
+// 构造在容器中执行步骤的命令；docker run 时目标目录挂载为工作目录
+// 组的 [env] 变量与目录的 dotenv 变量通过 -e KEY 传入容器，值由 docker 从子进程环境中读取，
+// 不出现在命令行上
+func containerCommand(ctx context.Context, t *target, opts *runOptions, step cmdStep, env []string) *exec.Cmd {
+	spec := opts.Container
+	var args []string
+	if spec.Name != "" {
+		args = []string{"exec", "-i", "-w", spec.Workdir}
+	} else {
+		dir, err := filepath.Abs(t.Dir)
+		if err != nil {
+			dir = t.Dir
+		}
+		args = []string{"run", "--rm", "-i", "-v", dir + ":" + spec.Workdir, "-w", spec.Workdir}
+	}
+	seen := make(map[string]bool)
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); !seen[k] {
+			args = append(args, "-e", k)
+			seen[k] = true
+		}
+	}
+	if spec.Name == "" {
+		args = append(args, opts.Limits.dockerArgs()...)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	args = append(args, spec.Options...)
+	if spec.Name != "" {
+		args = append(args, spec.Name)
+	} else {
+		args = append(args, spec.Image)
+	}
+
+	argv := step.Argv
+	if len(argv) == 0 {
+		argv = opts.Shell.scriptArgv(step.Script, opts.Args)
+	}
+	return exec.CommandContext(ctx, "docker", append(args, argv...)...)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerCommandEnv(t *testing.T) {
+	sh, err := resolveShell("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &runOptions{Shell: sh, Container: &containerSpec{Name: "app", Workdir: "/work"}}
+	env := []string{"TOKEN=s3cr3t", "A=1", "A=2"}
+	c := containerCommand(context.Background(), &target{Dir: "."}, opts, cmdStep{Script: "echo $TOKEN"}, env)
+	want := []string{"docker", "exec", "-i", "-w", "/work", "-e", "TOKEN", "-e", "A", "app", "sh", "-c", "echo $TOKEN"}
+	if !reflect.DeepEqual(c.Args, want) {
+		t.Errorf("args = %q\nwant %q", c.Args, want)
+	}
+	if strings.Contains(strings.Join(c.Args, " "), "s3cr3t") {
+		t.Errorf("变量值不应出现在命令行上: %q", c.Args)
+	}
+}
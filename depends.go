@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 为每个目标设置依赖的目标，只在本次运行的目标之间生效；被依赖的目录成功后才开始执行：
+//
+//	[depends_on]
+//	services/api = libs/core, libs/util   # 键和值都按目录路径或目录名匹配，支持通配符
+//
+// infer_depends=true 时另外从 go.mod 中指向本地目录的 replace 和 package.json 中
+// 对其他目标包名的依赖推断
+func assignDepends(cfg *Config, targets []*target) error {
+	deps := make(map[*target]map[*target]bool)
+	add := func(t, dep *target) {
+		if t == dep {
+			return
+		}
+		if deps[t] == nil {
+			deps[t] = make(map[*target]bool)
+		}
+		deps[t][dep] = true
+	}
+	for _, key := range sortedKeys(cfg.Depends) {
+		for _, t := range targets {
+			if !matchWeightPattern(key, t.Dir) {
+				continue
+			}
+			for _, p := range strings.Split(cfg.Depends[key], ",") {
+				if p = strings.TrimSpace(p); p == "" {
+					continue
+				}
+				for _, dep := range targets {
+					if matchWeightPattern(p, dep.Dir) {
+						add(t, dep)
+					}
+				}
+			}
+		}
+	}
+	infer, err := cfg.boolSetting("", "infer_depends", false)
+	if err != nil {
+		return err
+	}
+	if infer {
+		inferDepends(targets, add)
+	}
+
+	for _, t := range targets {
+		for _, dep := range targets {
+			if deps[t][dep] {
+				t.Deps = append(t.Deps, dep)
+			}
+		}
+	}
+	return checkDependCycle(targets)
+}
+
+// 从 go.mod 和 package.json 推断本地目标之间的依赖
+func inferDepends(targets []*target, add func(t, dep *target)) {
+	byPath := make(map[string]*target)
+	byPackage := make(map[string]*target)
+	for _, t := range targets {
+		if t.remote() {
+			continue
+		}
+		if abs, err := realPath(t.Dir); err == nil {
+			byPath[abs] = t
+		}
+		if pkg, err := readPackageJSON(t.Dir); err == nil && pkg.Name != "" {
+			byPackage[pkg.Name] = t
+		}
+	}
+	for _, t := range targets {
+		if t.remote() {
+			continue
+		}
+		for _, dir := range goModReplaceDirs(t.Dir) {
+			if abs, err := realPath(filepath.Join(t.Dir, dir)); err == nil && byPath[abs] != nil {
+				add(t, byPath[abs])
+			}
+		}
+		if pkg, err := readPackageJSON(t.Dir); err == nil {
+			for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies} {
+				for name := range m {
+					if dep := byPackage[name]; dep != nil {
+						add(t, dep)
+					}
+				}
+			}
+		}
+	}
+}
+
+// go.mod 中 replace 指向的本地路径（以 ./ ../ 或 / 开头）
+func goModReplaceDirs(dir string) []string {
+	f, err := os.Open(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var dirs []string
+	inBlock := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case line == "replace (":
+			inBlock = true
+			continue
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "replace "):
+			line = strings.TrimPrefix(line, "replace ")
+		case !inBlock:
+			continue
+		}
+		_, target, ok := strings.Cut(line, "=>")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(target)
+		if len(fields) == 1 && (strings.HasPrefix(fields[0], ".") || filepath.IsAbs(fields[0])) {
+			dirs = append(dirs, fields[0])
+		}
+	}
+	return dirs
+}
+
+type packageJSON struct {
+	Name             string            `json:"name"`
+	Dependencies     map[string]string `json:"dependencies"`
+	DevDependencies  map[string]string `json:"devDependencies"`
+	PeerDependencies map[string]string `json:"peerDependencies"`
+}
+
+func readPackageJSON(dir string) (*packageJSON, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// 检查目录依赖中的循环
+func checkDependCycle(targets []*target) error {
+	state := make(map[*target]int) // 1 处理中，2 已完成
+	var visit func(t *target, path []string) error
+	visit = func(t *target, path []string) error {
+		switch state[t] {
+		case 1:
+			return fmt.Errorf("目录依赖存在循环: %s", strings.Join(append(path, t.Dir), " -> "))
+		case 2:
+			return nil
+		}
+		state[t] = 1
+		for _, dep := range t.Deps {
+			if err := visit(dep, append(path, t.Dir)); err != nil {
+				return err
+			}
+		}
+		state[t] = 2
+		return nil
+	}
+	for _, t := range targets {
+		if err := visit(t, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 依赖的目录是否都已成功（命中缓存或条件不满足而跳过的组视为成功）
+func dependsOK(results []*dirResult) bool {
+	for _, r := range results {
+		if !r.succeeded() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// --debug-stats 时收集的运行器自身的统计，nil 表示未开启
+var runDiagnostics *diagnostics
+
+type phaseStat struct {
+	count      int
+	total, max time.Duration
+}
+
+type diagnostics struct {
+	mu     sync.Mutex
+	phases map[string]*phaseStat
+	order  []string // 阶段首次出现的顺序
+	peak   int      // goroutine 数的峰值
+	start  time.Time
+	stop   chan struct{}
+}
+
+// 开始收集，每 100ms 采样一次 goroutine 数
+func startDiagnostics() *diagnostics {
+	d := &diagnostics{phases: make(map[string]*phaseStat), start: time.Now(), stop: make(chan struct{})}
+	go func() {
+		tick := time.NewTicker(100 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			d.sample()
+			select {
+			case <-tick.C:
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return d
+}
+
+func (d *diagnostics) sample() {
+	n := runtime.NumGoroutine()
+	d.mu.Lock()
+	d.peak = max(d.peak, n)
+	d.mu.Unlock()
+}
+
+// 记录一个阶段从 since 到现在的耗时，d 为 nil 时什么也不做
+func (d *diagnostics) observe(phase string, since time.Time) {
+	if d == nil {
+		return
+	}
+	elapsed := time.Since(since)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.phases[phase]
+	if s == nil {
+		s = &phaseStat{}
+		d.phases[phase] = s
+		d.order = append(d.order, phase)
+	}
+	s.count++
+	s.total += elapsed
+	s.max = max(s.max, elapsed)
+}
+
+// 停止采样并打印各阶段耗时、goroutine、调度延迟和 GC 统计
+func (d *diagnostics) print(w io.Writer) {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	d.sample()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintln(w, "\n===== 运行统计 (--debug-stats) =====")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tCOUNT\tTOTAL\tAVG\tMAX")
+	for _, name := range d.order {
+		s := d.phases[name]
+		avg := s.total / time.Duration(s.count)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", name, s.count, roundDuration(s.total), roundDuration(avg), roundDuration(s.max))
+	}
+	tw.Flush()
+
+	samples := []metrics.Sample{{Name: "/sched/latencies:seconds"}, {Name: "/gc/pauses:seconds"}}
+	metrics.Read(samples)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(w, "耗时 %s，goroutine 当前 %d / 峰值 %d，GOMAXPROCS %d\n",
+		roundDuration(time.Since(d.start)), runtime.NumGoroutine(), d.peak, runtime.GOMAXPROCS(0))
+	if h := histogram(samples[0]); h != nil {
+		fmt.Fprintf(w, "goroutine 调度等待: p50 %s，p99 %s，最大 %s\n", quantile(h, 0.5), quantile(h, 0.99), quantile(h, 1))
+	}
+	if h := histogram(samples[1]); h != nil {
+		fmt.Fprintf(w, "GC: %d 次，暂停 p99 %s，堆 %s，累计分配 %s\n", mem.NumGC, quantile(h, 0.99), formatBytes(mem.HeapAlloc), formatBytes(mem.TotalAlloc))
+	}
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+func histogram(s metrics.Sample) *metrics.Float64Histogram {
+	if s.Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	return s.Value.Float64Histogram()
+}
+
+// 直方图的分位数，取所在桶的上界（上界为 +Inf 时取下界）
+func quantile(h *metrics.Float64Histogram, q float64) time.Duration {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	want := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range h.Counts {
+		if seen += c; seen >= want && c > 0 {
+			bound := h.Buckets[i+1]
+			if math.IsInf(bound, 1) {
+				bound = h.Buckets[i]
+			}
+			return roundDuration(time.Duration(bound * float64(time.Second)))
+		}
+	}
+	return 0
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// --pprof addr：在后台提供 net/http/pprof，监听失败时返回错误
+func startPprof(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("pprof 监听 %s 失败: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	logger.Info(fmt.Sprintf("pprof: http://%s/debug/pprof/", ln.Addr()), "addr", ln.Addr().String())
+	go func() { _ = http.Serve(ln, mux) }()
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runCmd diff-config：对比内嵌默认配置与合并后的生效配置，列出被外部配置（及 --profile、-s）改动的部分
+func runDiffConfig(args []string) int {
+	fs := flag.NewFlagSet("diff-config", flag.ContinueOnError)
+	addConfigFlag(fs)
+	noColor := fs.Bool("no-color", false, "禁用彩色输出")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd diff-config")
+		fmt.Fprintln(fs.Output(), "- 为内嵌配置中的值，+ 为生效的值")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	setupColor(*noColor, logOut)
+
+	data, _ := embeddedConfig.ReadFile("config.txt")
+	base := parseConfig(string(data))
+	cfg, err := loadConfig()
+	if err == nil {
+		err = base.expandIncludes()
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if n := writeConfigDiff(logOut, base, cfg); n == 0 {
+		fmt.Fprintln(logOut, "生效配置与内嵌默认配置没有差异")
+	}
+	return exitOK
+}
+
+// 按区块输出差异，返回有差异的区块数
+func writeConfigDiff(w io.Writer, base, cfg *Config) int {
+	sections := 0
+	section := func(header string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		if sections > 0 {
+			fmt.Fprintln(w)
+		}
+		sections++
+		fmt.Fprintln(w, header)
+		for _, l := range lines {
+			fmt.Fprintln(w, l)
+		}
+	}
+
+	section("[settings]", diffKV(base.Settings, cfg.Settings))
+	section("[vars]", diffKV(base.Vars, cfg.Vars))
+	section("[notify]", diffKV(base.Notify, cfg.Notify))
+	section("[weights]", diffKV(base.Weights, cfg.Weights))
+	section("[depends_on]", diffKV(base.Depends, cfg.Depends))
+	section("[hooks]", diffKV(base.Hooks, cfg.Hooks))
+	section("[dirs]", diffKV(joinTags(base.DirTags), joinTags(cfg.DirTags)))
+	section("[hosts]", diffKV(joinHosts(base.Hosts), joinHosts(cfg.Hosts)))
+	for _, scope := range sortedKeys(unionKeys(base.Env, cfg.Env)) {
+		header := "[env]"
+		if scope != "" {
+			header = "[env:" + scope + "]"
+		}
+		section(header, diffKV(base.Env[scope], cfg.Env[scope]))
+	}
+	for _, name := range sortedKeys(unionKeys(base.DirSets, cfg.DirSets)) {
+		section("[dirs:"+name+"]", diffLines(base.DirSets[name], cfg.DirSets[name]))
+	}
+	for _, name := range sortedKeys(unionKeys(base.Groups, cfg.Groups)) {
+		var lines []string
+		if opts := diffKV(base.Options[name], cfg.Options[name]); len(opts) > 0 {
+			lines = append(append(lines, "  选项:"), opts...)
+		}
+		if base.Descs[name] != cfg.Descs[name] {
+			lines = append(append(lines, "  说明:"), diffLines(nonEmpty(base.Descs[name]), nonEmpty(cfg.Descs[name]))...)
+		}
+		if cmds := diffLines(base.Groups[name], cfg.Groups[name]); len(cmds) > 0 {
+			lines = append(append(lines, "  命令:"), cmds...)
+		}
+		header := "[" + name + "]"
+		if _, ok := base.Groups[name]; !ok {
+			header += "  新增的组"
+		}
+		if src := cfg.Sources[name]; src != "" && src != "embedded" {
+			header += "  来源: " + src
+		}
+		section(header, lines)
+	}
+	return sections
+}
+
+// key=value 区块的差异，空值视为不存在
+func diffKV(old, cur map[string]string) []string {
+	var lines []string
+	for _, k := range sortedKeys(unionKeys(old, cur)) {
+		o, inOld := old[k]
+		c, inCur := cur[k]
+		if inOld == inCur && o == c {
+			continue
+		}
+		if inOld && o != "" {
+			lines = append(lines, colorize("31", "- "+k+" = "+o))
+		}
+		if inCur && c != "" {
+			lines = append(lines, colorize("32", "+ "+k+" = "+c))
+		}
+	}
+	return lines
+}
+
+// 行列表的差异：去掉相同的开头和结尾，中间部分按删除和新增输出，省略的相同行以 ... 表示
+func diffLines(old, cur []string) []string {
+	start := 0
+	for start < len(old) && start < len(cur) && old[start] == cur[start] {
+		start++
+	}
+	end := 0
+	for end < len(old)-start && end < len(cur)-start && old[len(old)-1-end] == cur[len(cur)-1-end] {
+		end++
+	}
+	if start == len(old) && start == len(cur) {
+		return nil
+	}
+	var lines []string
+	if start > 0 {
+		lines = append(lines, fmt.Sprintf("  ...（%d 行相同）", start))
+	}
+	for _, l := range old[start : len(old)-end] {
+		lines = append(lines, colorize("31", "- "+l))
+	}
+	for _, l := range cur[start : len(cur)-end] {
+		lines = append(lines, colorize("32", "+ "+l))
+	}
+	if end > 0 {
+		lines = append(lines, fmt.Sprintf("  ...（%d 行相同）", end))
+	}
+	return lines
+}
+
+// [dirs] 清单转成 目录 -> tags=a,b 的形式以便对比
+func joinTags(m map[string][]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for dir, tags := range m {
+		out[dir] = "tags=" + strings.Join(tags, ",")
+	}
+	return out
+}
+
+// [hosts] 清单中每台主机的属性写成一行
+func joinHosts(m map[string]hostEntry) map[string]string {
+	out := make(map[string]string, len(m))
+	for host, h := range m {
+		var attrs []string
+		if h.User != "" {
+			attrs = append(attrs, "user="+h.User)
+		}
+		if h.Port != "" {
+			attrs = append(attrs, "port="+h.Port)
+		}
+		if len(h.Tags) > 0 {
+			attrs = append(attrs, "tags="+strings.Join(h.Tags, ","))
+		}
+		out[host] = strings.Join(attrs, " ")
+	}
+	return out
+}
+
+// 非空字符串作为单行列表
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+// 两个 map 的键的并集
+func unionKeys[V any](a, b map[string]V) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 递归扫描时跳过的目录
+var skipScanDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true}
+
+// 把目录参数中的 -（或 useStdin 时追加在末尾）替换为从 r 读取的目录，每行一个，跳过空行和 # 注释
+func expandStdinArgs(args []string, useStdin bool, r io.Reader) ([]string, bool, error) {
+	i := slices.Index(args, "-")
+	if i < 0 && !useStdin {
+		return args, false, nil
+	}
+	var dirs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("从 stdin 读取目录失败: %w", err)
+	}
+	out := slices.DeleteFunc(slices.Clone(args), func(a string) bool { return a == "-" })
+	if i < 0 || i > len(out) {
+		i = len(out)
+	}
+	return slices.Insert(out, i, dirs...), true, nil
+}
+
+// 把 @name 参数替换为配置中 [dirs:name] 的目录列表
+func resolveDirSets(cfg *Config, args []string) ([]string, error) {
+	var out []string
+	for _, arg := range args {
+		name, ok := strings.CutPrefix(arg, "@")
+		if !ok {
+			out = append(out, arg)
+			continue
+		}
+		set, ok := cfg.DirSets[name]
+		if !ok {
+			return nil, fmt.Errorf("未找到目录集合 [dirs:%s]", name)
+		}
+		out = append(out, set...)
+	}
+	return out, nil
+}
+
+// 展开命令行中的目录参数，支持 ./repos/* 这样的通配符
+func expandDirArgs(args []string) ([]string, error) {
+	var dirs []string
+	for _, arg := range args {
+		_, _, remote := parseRemoteDir(arg)
+		if remote || strings.HasPrefix(arg, k8sScheme) || !strings.ContainsAny(arg, "*?[") {
+			dirs = append(dirs, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("无效的通配符 %q: %w", arg, err)
+		}
+		n := 0
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() {
+				dirs = append(dirs, m)
+				n++
+			}
+		}
+		if n == 0 {
+			logger.Warn(fmt.Sprintf("通配符 %s 没有匹配到任何目录", arg), "pattern", arg)
+		}
+	}
+	return uniqueDirs(dirs), nil
+}
+
+// 从各个根目录递归查找包含标记文件（如 go.mod，逗号分隔多个时任一存在即可）的目录
+func scanDirs(roots []string, marker string) ([]string, error) {
+	markers := strings.Split(marker, ",")
+	var dirs []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if path != root && skipScanDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			for _, m := range markers {
+				if _, err := os.Stat(filepath.Join(path, strings.TrimSpace(m))); err == nil {
+					dirs = append(dirs, path)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("扫描目录 %s 失败: %w", root, err)
+		}
+	}
+	sort.Strings(dirs)
+	return uniqueDirs(dirs), nil
+}
+
+// 去重并保持原有顺序
+func uniqueDirs(dirs []string) []string {
+	seen := make(map[string]bool, len(dirs))
+	out := dirs[:0]
+	for _, d := range dirs {
+		key := filepath.Clean(d)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, d)
+	}
+	return out
+}
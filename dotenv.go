@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 解析 dotenv 设置：true 表示只加载 .env，也可以写逗号分隔的文件列表
+func parseDotenvSetting(v string) []string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "false", "0", "no":
+		return nil
+	case "true", "1", "yes":
+		return []string{".env"}
+	}
+	var files []string
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// 读取目录下的 dotenv 文件，返回 KEY=VALUE 列表；不存在的文件直接跳过
+func loadDotenvFiles(dir string, files []string) ([]string, error) {
+	var env []string
+	for _, name := range files {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, name)
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		vars, err := parseDotenv(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		env = append(env, vars...)
+	}
+	return env, nil
+}
+
+// 解析 dotenv 内容，支持注释、export 前缀和引号
+func parseDotenv(r io.Reader) ([]string, error) {
+	var env []string
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("第 %d 行格式错误: %q", lineNo, line)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			quote := v[0]
+			v = v[1 : len(v)-1]
+			if quote == '"' {
+				v = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(v)
+			}
+		} else if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+		env = append(env, k+"="+v)
+	}
+	return env, scanner.Err()
+}
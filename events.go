@@ -0,0 +1,40 @@
+package main
+
+import "sync"
+
+// 运行过程中的事件类型
+const (
+	eventDirStarted  = "dir_started"
+	eventLine        = "line"
+	eventDirFinished = "dir_finished"
+)
+
+// 运行事件，供 TUI 等界面订阅
+type runEvent struct {
+	Kind   string
+	Dir    string
+	Group  string
+	Line   string     // eventLine 时的输出内容
+	Stderr bool       // eventLine 是否来自 stderr（仅 stderr=separate 时区分）
+	Result *dirResult // eventDirFinished 时的结果
+}
+
+var (
+	sinksMu    sync.RWMutex
+	eventSinks []func(runEvent)
+)
+
+// 订阅运行事件，回调会在执行目录的 goroutine 中同步调用
+func onEvent(fn func(runEvent)) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	eventSinks = append(eventSinks, fn)
+}
+
+func emit(ev runEvent) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, fn := range eventSinks {
+		fn(ev)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 运行级别的事件（只写到 --events 事件流，不经过 emit）
+const (
+	eventRunStarted  = "run_started"
+	eventRunFinished = "run_finished"
+)
+
+// --events ndjson 中的一行
+type streamEvent struct {
+	Event      string   `json:"event"`
+	Time       string   `json:"time"`
+	Dir        string   `json:"dir,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	Dirs       []string `json:"dirs,omitempty"`
+	Line       *string  `json:"line,omitempty"`
+	Stream     string   `json:"stream,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	ExitCode   *int     `json:"exit_code,omitempty"`
+	DurationMs *int64   `json:"duration_ms,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	OK         *bool    `json:"ok,omitempty"`
+	Failed     []string `json:"failed,omitempty"`
+}
+
+// 每个事件一行 JSON，写到 stdout、文件或命名管道
+type eventStream struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+	c   io.Closer // 写到 stdout 时为 nil
+}
+
+// 打开事件流：path 为空或 - 时写到 stdout；命名管道在有读取方之前会阻塞
+func openEventStream(format, path string) (*eventStream, error) {
+	if format != "ndjson" {
+		return nil, fmt.Errorf("无效的 --events %q，目前只支持 ndjson", format)
+	}
+	if path == "" || path == "-" {
+		return &eventStream{w: os.Stdout, enc: json.NewEncoder(os.Stdout)}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开事件输出 %s 失败: %w", path, err)
+	}
+	return &eventStream{w: f, enc: json.NewEncoder(f), c: f}, nil
+}
+
+func (s *eventStream) write(ev streamEvent) {
+	ev.Time = time.Now().Format(time.RFC3339Nano)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 读取方退出（管道断开）后不再影响运行
+	_ = s.enc.Encode(ev)
+}
+
+// 把目录级别的运行事件转成事件流中的一行
+func (s *eventStream) onEvent(ev runEvent) {
+	out := streamEvent{Event: ev.Kind, Dir: ev.Dir, Group: ev.Group}
+	switch ev.Kind {
+	case eventLine:
+		out.Line, out.Stream = &ev.Line, "stdout"
+		if ev.Stderr {
+			out.Stream = "stderr"
+		}
+	case eventDirFinished:
+		r := ev.Result
+		ms := r.Duration.Milliseconds()
+		out.Status, out.ExitCode, out.DurationMs = r.Status, &r.ExitCode, &ms
+		if r.Err != nil {
+			out.Error = r.Err.Error()
+		}
+	}
+	s.write(out)
+}
+
+func (s *eventStream) runStarted(group string, targets []*target) {
+	dirs := make([]string, len(targets))
+	for i, t := range targets {
+		dirs[i] = t.Dir
+	}
+	s.write(streamEvent{Event: eventRunStarted, Group: group, Dirs: dirs})
+}
+
+func (s *eventStream) runFinished(rep jsonReport, failed []string) {
+	s.write(streamEvent{Event: eventRunFinished, Group: rep.Group, OK: &rep.OK, DurationMs: &rep.DurationMs, Failed: failed})
+}
+
+func (s *eventStream) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 解析不经过 shell 的命令行：exec: git status -sb 或 exec: ["git", "status", "-sb"]
+// 第二个返回值表示该行是否为 exec 形式
+func parseExecLine(line string) ([]string, bool, error) {
+	rest, ok := strings.CutPrefix(line, "exec:")
+	if !ok {
+		return nil, false, nil
+	}
+	rest = strings.TrimSpace(rest)
+
+	var argv []string
+	if strings.HasPrefix(rest, "[") {
+		if err := json.Unmarshal([]byte(rest), &argv); err != nil {
+			return nil, true, fmt.Errorf("无效的 exec 命令 %q: %w", line, err)
+		}
+	} else {
+		var err error
+		if argv, err = splitArgs(rest); err != nil {
+			return nil, true, fmt.Errorf("无效的 exec 命令 %q: %w", line, err)
+		}
+	}
+	if len(argv) == 0 {
+		return nil, true, fmt.Errorf("空的 exec 命令")
+	}
+	return argv, true, nil
+}
+
+// 按空白拆分参数，支持单双引号和反斜杠转义，不做任何变量展开
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	has, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, has = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, has = r, true
+		case r == ' ' || r == '\t':
+			if has {
+				args = append(args, cur.String())
+				cur.Reset()
+				has = false
+			}
+		default:
+			cur.WriteRune(r)
+			has = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("引号未闭合")
+	}
+	if has {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
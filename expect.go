@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 输出不符合 expect: / expect-not: 时的错误
+var errExpectFailed = errors.New("输出不符合预期")
+
+// 组内以 expect: 或 expect-not: 开头的行：执行成功后检查该目录的输出，
+// 任一输出行包含该文本（写作 /正则/ 时按正则匹配）才算满足，expect-not: 则要求不出现
+type outputExpect struct {
+	Raw    string
+	Negate bool
+	re     *regexp.Regexp // nil 时按子串匹配
+}
+
+func (e outputExpect) String() string {
+	if e.Negate {
+		return "expect-not: " + e.Raw
+	}
+	return "expect: " + e.Raw
+}
+
+func (e outputExpect) match(line string) bool {
+	if e.re != nil {
+		return e.re.MatchString(line)
+	}
+	return strings.Contains(line, e.Raw)
+}
+
+// 拆出组内的 expect: / expect-not: 行，其余为命令
+func splitExpect(group string, cmds []string) ([]outputExpect, []string, error) {
+	var expects []outputExpect
+	var rest []string
+	for _, line := range cmds {
+		e := outputExpect{}
+		v, ok := strings.CutPrefix(line, "expect:")
+		if !ok {
+			if v, ok = strings.CutPrefix(line, "expect-not:"); !ok {
+				rest = append(rest, line)
+				continue
+			}
+			e.Negate = true
+		}
+		if e.Raw = strings.TrimSpace(v); e.Raw == "" {
+			return nil, nil, fmt.Errorf("组 [%s]: %s 后缺少内容", group, strings.TrimSpace(e.String()))
+		}
+		if len(e.Raw) > 2 && strings.HasPrefix(e.Raw, "/") && strings.HasSuffix(e.Raw, "/") {
+			re, err := regexp.Compile(e.Raw[1 : len(e.Raw)-1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("组 [%s]: 无效的正则 %s: %w", group, e.Raw, err)
+			}
+			e.re = re
+		}
+		expects = append(expects, e)
+	}
+	return expects, rest, nil
+}
+
+// 当前组的输出与 expect 的匹配情况，多个输出流并发写入
+type expectState struct {
+	mu   sync.Mutex
+	seen []bool
+}
+
+func (s *expectState) reset(opts *runOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = make([]bool, len(opts.Expect))
+}
+
+func (s *expectState) observe(line string, opts *runOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range opts.Expect {
+		if i < len(s.seen) && !s.seen[i] && e.match(line) {
+			s.seen[i] = true
+		}
+	}
+}
+
+// 返回第一个不满足的预期
+func (s *expectState) check(opts *runOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range opts.Expect {
+		if i < len(s.seen) && s.seen[i] == e.Negate {
+			if e.Negate {
+				return fmt.Errorf("%w: 输出中出现了 %s", errExpectFailed, e.Raw)
+			}
+			return fmt.Errorf("%w: 输出中没有 %s", errExpectFailed, e.Raw)
+		}
+	}
+	return nil
+}
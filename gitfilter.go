@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// --git-dirty、--git-branch、--git-changed-since：按目录的 git 状态筛选目标
+type gitFilter struct {
+	Dirty        bool   // 有未提交的改动（含未跟踪文件）
+	Branch       string // 当前分支，支持 release/* 这样的通配符
+	ChangedSince string // 相对该提交有改动（含未提交的改动，不含未跟踪文件），只看目录本身
+}
+
+func (f gitFilter) active() bool {
+	return f.Dirty || f.Branch != "" || f.ChangedSince != ""
+}
+
+// 保留满足全部条件的 git 目录，顺序不变；不在 git 仓库中的目录不满足条件
+func filterGitDirs(ctx context.Context, dirs []string, f gitFilter) ([]string, error) {
+	keep := make([]bool, len(dirs))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.NumCPU())
+	for i, dir := range dirs {
+		if _, _, remote := parseRemoteDir(dir); remote || strings.HasPrefix(dir, k8sScheme) {
+			return nil, fmt.Errorf("git 筛选只支持本地目录: %s", dir)
+		}
+		g.Go(func() error {
+			ok, err := f.match(ctx, dir)
+			keep[i] = ok
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var out []string
+	for i, dir := range dirs {
+		if keep[i] {
+			out = append(out, dir)
+		}
+	}
+	return out, nil
+}
+
+func (f gitFilter) match(ctx context.Context, dir string) (bool, error) {
+	if _, err := gitOutput(ctx, dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return false, nil
+	}
+	if f.Dirty {
+		out, err := gitOutput(ctx, dir, "status", "--porcelain", "--", ".")
+		if err != nil || out == "" {
+			return false, err
+		}
+	}
+	if f.Branch != "" {
+		out, err := gitOutput(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return false, err
+		}
+		if ok, _ := path.Match(f.Branch, out); !ok {
+			return false, nil
+		}
+	}
+	if f.ChangedSince != "" {
+		out, err := gitOutput(ctx, dir, "diff", "--name-only", f.ChangedSince, "--", ".")
+		if err != nil {
+			return false, fmt.Errorf("目录 %s: %w", dir, err)
+		}
+		if out == "" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// 在目录中执行 git 命令，返回去掉首尾空白的输出
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	c := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New("git " + args[0] + ": " + msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 默认的运行历史文件，相对当前目录
+const defaultHistoryFile = ".runcmd/history.db"
+
+var historyBucket = []byte("runs")
+
+// 历史中的一次运行
+type historyRun struct {
+	ID         uint64          `json:"id"`
+	Group      string          `json:"group"`
+	Dirs       []string        `json:"dirs"`
+	StartedAt  time.Time       `json:"started_at"`
+	DurationMs int64           `json:"duration_ms"`
+	OK         bool            `json:"ok"`
+	Results    []jsonDirReport `json:"results"`
+}
+
+// 运行历史文件路径，未开启时返回空。默认不记录，避免在工作目录中写入文件；
+// history=true 或配置了 history_file 时开启
+func historyPath(cfg *Config) (string, error) {
+	file := cfg.Settings["history_file"]
+	on := file != ""
+	if v, ok := cfg.Settings["history"]; ok {
+		var err error
+		if on, err = strconv.ParseBool(v); err != nil {
+			return "", fmt.Errorf("无效的 history 配置 %q", v)
+		}
+	}
+	switch {
+	case !on:
+		return "", nil
+	case file != "":
+		return file, nil
+	}
+	return defaultHistoryFile, nil
+}
+
+func openHistory(path string) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// 其他 runCmd 进程持有锁时最多等待 1 秒
+	return bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+}
+
+func historyKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// 把一次运行写入历史，失败时只打印警告
+func recordHistory(cfg *Config, dirs []string, start time.Time, rep jsonReport) {
+	path, err := historyPath(cfg)
+	if err != nil || path == "" {
+		return
+	}
+	db, err := openHistory(path)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("记录运行历史失败: %v", err), "phase", "history", "error", err)
+		return
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(historyBucket)
+		if err != nil {
+			return err
+		}
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(historyRun{
+			ID: id, Group: rep.Group, Dirs: dirs, StartedAt: start,
+			DurationMs: rep.DurationMs, OK: rep.OK, Results: rep.Results,
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put(historyKey(id), data)
+	})
+	if err != nil {
+		logger.Warn(fmt.Sprintf("记录运行历史失败: %v", err), "phase", "history", "error", err)
+	}
+}
+
+// 上次运行该组（链）时失败、跳过或未完成的目录，供 --resume 使用
+func resumeDirs(cfg *Config, group string) ([]string, *historyRun, error) {
+	path, err := historyPath(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if path == "" {
+		return nil, nil, errors.New("--resume 需要运行历史，请设置 history=true")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, fmt.Errorf("还没有运行历史 (%s)", path)
+	}
+	db, err := openHistory(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	var last *historyRun
+	err = eachHistoryRun(db, func(run *historyRun) bool {
+		if run.Group == group {
+			last = run
+		}
+		return last == nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if last == nil {
+		return nil, nil, fmt.Errorf("运行历史中没有组 [%s] 的记录", group)
+	}
+	// 组链时一个目录有多条结果，任一不成功或缺少结果都需要重新执行
+	ok := make(map[string]bool)
+	for _, r := range last.Results {
+		if v, seen := ok[r.Dir]; !seen || v {
+			ok[r.Dir] = okStatus(r.Status)
+		}
+	}
+	var dirs []string
+	for _, d := range last.Dirs {
+		if !ok[d] {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs, last, nil
+}
+
+// 从新到旧遍历历史，fn 返回 false 时停止
+func eachHistoryRun(db *bolt.DB, fn func(*historyRun) bool) error {
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run historyRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if !fn(&run) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func loadHistoryRun(db *bolt.DB, id uint64) (*historyRun, error) {
+	var run *historyRun
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		if b == nil {
+			return nil
+		}
+		v := b.Get(historyKey(id))
+		if v == nil {
+			return nil
+		}
+		run = &historyRun{}
+		return json.Unmarshal(v, run)
+	})
+	if err == nil && run == nil {
+		err = fmt.Errorf("运行 #%d 不存在", id)
+	}
+	return run, err
+}
+
+// 打开历史文件用于查询，文件不存在时给出提示
+func openHistoryForRead() (*bolt.DB, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	path, err := historyPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, errors.New("运行历史未开启，请设置 history=true")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("还没有运行历史 (%s)", path)
+	}
+	return openHistory(path)
+}
+
+func runStatusText(ok bool) string {
+	if ok {
+		return statusOK
+	}
+	return statusFailed
+}
+
+func msDuration(ms int64) time.Duration {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Millisecond)
+}
+
+// runCmd history：列出最近的运行，--dir 时列出该目录每次运行的状态和耗时
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	addConfigFlag(fs)
+	limit := fs.Int("limit", 20, "最多显示的运行数")
+	group := fs.String("group", "", "只显示该组（组链）的运行")
+	dir := fs.String("dir", "", "显示单个目录在各次运行中的状态和耗时")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd history [flags]")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	db, err := openHistoryForRead()
+	if err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitConfigError
+	}
+	defer db.Close()
+
+	tw := tabwriter.NewWriter(logOut, 0, 0, 2, ' ', 0)
+	if *dir != "" {
+		fmt.Fprintf(tw, "ID\tTIME\tGROUP\t%s\tDURATION\tEXIT\n", plainCell("STATUS"))
+	} else {
+		fmt.Fprintf(tw, "ID\tTIME\tGROUP\t%s\tDIRS\tFAILED\tDURATION\n", plainCell("STATUS"))
+	}
+	n := 0
+	err = eachHistoryRun(db, func(run *historyRun) bool {
+		if *group != "" && run.Group != *group {
+			return true
+		}
+		when := run.StartedAt.Local().Format("2006-01-02 15:04:05")
+		if *dir != "" {
+			matched := false
+			for _, r := range run.Results {
+				if filepath.Clean(r.Dir) != filepath.Clean(*dir) {
+					continue
+				}
+				matched = true
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\n", run.ID, when, r.Group, colorStatus(r.Status), msDuration(r.DurationMs), r.ExitCode)
+			}
+			if matched {
+				n++
+			}
+		} else {
+			failed := 0
+			for _, r := range run.Results {
+				if !okStatus(r.Status) {
+					failed++
+				}
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n", run.ID, when, run.Group, colorStatus(runStatusText(run.OK)), len(run.Dirs), failed, msDuration(run.DurationMs))
+			n++
+		}
+		return n < *limit
+	})
+	tw.Flush()
+	if err != nil {
+		fmt.Fprintf(logOut, "读取运行历史失败: %v\n", err)
+		return exitConfigError
+	}
+	return exitOK
+}
+
+// runCmd show <run-id>：显示一次运行中每个目录的结果
+func runShow(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(logOut, "用法: ./runCmd show <run-id>")
+		return exitUsage
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		fmt.Fprintf(logOut, "无效的运行 ID %q\n", args[0])
+		return exitUsage
+	}
+	db, err := openHistoryForRead()
+	if err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitConfigError
+	}
+	defer db.Close()
+	run, err := loadHistoryRun(db, id)
+	if err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitUsage
+	}
+	printHistoryRun(logOut, run)
+	return exitOK
+}
+
+func printHistoryRun(w io.Writer, run *historyRun) {
+	fmt.Fprintf(w, "运行 #%d  组 [%s]  %s\n", run.ID, run.Group, colorStatus(runStatusText(run.OK)))
+	fmt.Fprintf(w, "开始时间: %s  耗时: %s\n", run.StartedAt.Local().Format("2006-01-02 15:04:05"), msDuration(run.DurationMs))
+	fmt.Fprintf(w, "目录: %s\n\n", strings.Join(run.Dirs, " "))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DIR\tGROUP\t%s\tDURATION\tEXIT\tATTEMPTS\tLOG\n", plainCell("STATUS"))
+	for _, r := range run.Results {
+		log := r.LogFile
+		if log == "" {
+			log = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", r.Dir, r.Group, colorStatus(r.Status), msDuration(r.DurationMs), r.ExitCode, r.Attempts, log)
+	}
+	tw.Flush()
+	for _, r := range run.Results {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s: %s\n", r.Dir, r.Error)
+		}
+	}
+}
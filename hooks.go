@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// [hooks] 中可用的钩子
+//
+//	[hooks]
+//	pre_run = ./scripts/lock-deploy.sh
+//	post_dir_failure = notify-send "$RUNCMD_DIR 失败"
+//	post_run = curl -fsS -d "status=$RUNCMD_STATUS" https://example.com/ping
+var hookNames = []string{
+	"pre_run", "post_run",
+	"pre_dir", "post_dir", "post_dir_success", "post_dir_failure",
+	"pre_group", "post_group",
+}
+
+// 本次运行的钩子，nil 表示没有配置
+var activeHooks *hookSet
+
+type hookSet struct {
+	cmds  map[string]string
+	shell shellSpec
+	cfg   *Config
+
+	once sync.Once // 运行级别钩子的环境在第一次执行时生成，避免 validate 等读取密钥
+	env  []string  // 运行级别钩子的环境：继承 + [env] + [secrets]
+	mask *masker
+	err  error
+}
+
+func checkHooks(cfg *Config) error {
+	for _, name := range sortedKeys(cfg.Hooks) {
+		if !slices.Contains(hookNames, name) {
+			return fmt.Errorf("未知的钩子 %s，可选 %s", name, strings.Join(hookNames, "、"))
+		}
+	}
+	return nil
+}
+
+// 钩子命令按 [settings] 中的 shell 在本机执行
+func newHookSet(cfg *Config) (*hookSet, error) {
+	if len(cfg.Hooks) == 0 {
+		return nil, nil
+	}
+	if err := checkHooks(cfg); err != nil {
+		return nil, err
+	}
+	shell, err := resolveShell(cfg.Settings["shell"])
+	if err != nil {
+		return nil, err
+	}
+	return &hookSet{cmds: cfg.Hooks, shell: shell, cfg: cfg}, nil
+}
+
+// 生成运行级别钩子的环境和遮盖器，密钥按 mask 设置同样遮盖
+func (h *hookSet) globalEnv() ([]string, *masker, error) {
+	h.once.Do(func() {
+		env, secrets, err := buildEnv(h.cfg, "", false, true)
+		if err != nil {
+			h.err = err
+			return
+		}
+		spec, err := parseMaskSetting(h.cfg.Settings["mask"])
+		if err != nil {
+			h.err = err
+			return
+		}
+		values := make([]string, len(secrets))
+		for i, kv := range secrets {
+			_, values[i], _ = strings.Cut(kv, "=")
+		}
+		h.env, h.mask = env, spec.withValues(values).forEnv(env)
+	})
+	return h.env, h.mask, h.err
+}
+
+// 在 base 之后追加 RUNCMD_HOOK 和成对给出的 RUNCMD_<KEY>=value
+func hookEnv(base []string, name string, vars ...string) []string {
+	env := append(append([]string{}, base...), "RUNCMD_HOOK="+name)
+	for i := 0; i+1 < len(vars); i += 2 {
+		env = append(env, "RUNCMD_"+vars[i]+"="+vars[i+1])
+	}
+	return env
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// 执行运行级别的钩子（pre_run、post_run），输出遮盖后直接写到终端
+func (h *hookSet) runGlobal(ctx context.Context, name string, vars ...string) error {
+	if h == nil || h.cmds[name] == "" {
+		return nil
+	}
+	env, mask, err := h.globalEnv()
+	if err != nil {
+		return fmt.Errorf("钩子 %s 失败: %w", name, err)
+	}
+	logger.Info(fmt.Sprintf("执行钩子 %s", name), "phase", "hook", "hook", name)
+	c := h.shell.command(ctx, h.cmds[name], nil)
+	c.Env = hookEnv(env, name, vars...)
+	r, w := io.Pipe()
+	c.Stdout, c.Stderr = w, w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = readLines(r, defaultMaxLineSize, func(line string) {
+			fmt.Fprintln(logOut, mask.apply(line))
+		})
+		_, _ = io.Copy(io.Discard, r)
+	}()
+	err = c.Run()
+	w.Close()
+	<-done
+	if err != nil {
+		return fmt.Errorf("钩子 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// 在目标目录执行目录或组级别的钩子，输出以 [dir#hook] 为前缀；
+// 环境在组的环境（含 [env]）之上追加 RUNCMD_* 变量
+func (h *hookSet) runInDir(ctx context.Context, t *target, opts *runOptions, name string, vars ...string) error {
+	if h == nil || h.cmds[name] == "" {
+		return nil
+	}
+	defer runDiagnostics.observe("hook:"+name, time.Now())
+	c := h.shell.command(ctx, h.cmds[name], nil)
+	env := hookEnv(opts.Env, name, append([]string{"DIR", t.Dir}, vars...)...)
+	if _, _, err := runProcess(c, t, t.Dir+"#"+name, env, opts); err != nil {
+		t.logger().Warn(fmt.Sprintf("%s 钩子 %s 失败: %v", prefix(t.Dir), name, err), "phase", "hook", "hook", name, "error", err)
+		return fmt.Errorf("钩子 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// 目录中的组链结束后执行 post_dir，再按结果执行 post_dir_success 或 post_dir_failure
+func (h *hookSet) postDir(ctx context.Context, t *target, chain []*runOptions, results []*dirResult) {
+	if h == nil {
+		return
+	}
+	status := chainStatus(results)
+	vars := []string{"GROUP", chainName(chain), "STATUS", status, "DURATION", seconds(time.Since(t.start))}
+	_ = h.runInDir(ctx, t, chain[0], "post_dir", vars...)
+	if okStatus(status) {
+		_ = h.runInDir(ctx, t, chain[0], "post_dir_success", vars...)
+	} else {
+		_ = h.runInDir(ctx, t, chain[0], "post_dir_failure", vars...)
+	}
+}
+
+func chainName(chain []*runOptions) string {
+	names := make([]string, len(chain))
+	for i, opts := range chain {
+		names[i] = opts.Group
+	}
+	return strings.Join(names, ",")
+}
+
+// 组链在目录中的总体状态：全部成功为 OK，否则取第一个未成功的状态
+func chainStatus(results []*dirResult) string {
+	for _, r := range results {
+		if !r.succeeded() {
+			return r.Status
+		}
+	}
+	return statusOK
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// [hosts] 清单中的一台主机：
+//
+//	web1.example.com  user=deploy port=2222 tags=web,eu
+//
+// 目标目录写作 web1.example.com:/srv/app 或用 --hosts 选择时，ssh 使用这里的用户和端口
+type hostEntry struct {
+	User string
+	Port string
+	Tags []string
+}
+
+// 解析 [hosts] 清单中的一行
+func parseHostLine(line string) (string, hostEntry) {
+	fields := splitHeaderFields(line)
+	var h hostEntry
+	for _, f := range fields[1:] {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "user":
+			h.User = v
+		case "port":
+			h.Port = v
+		case "tags":
+			h.Tags = splitTags(v)
+		}
+	}
+	return fields[0], h
+}
+
+// 按 --hosts 选择清单中的主机，逗号分隔：tag=web 选带该标签的主机，all 选全部，
+// 其他写法为主机名。结果按清单中的主机名排序
+func selectHosts(cfg *Config, sel string) ([]string, error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, fmt.Errorf("--hosts %s: 配置中没有 [hosts] 清单", sel)
+	}
+	picked := make(map[string]bool)
+	for _, item := range splitTags(sel) {
+		tag, isTag := strings.CutPrefix(item, "tag=")
+		switch {
+		case item == "all":
+			for name := range cfg.Hosts {
+				picked[name] = true
+			}
+		case isTag:
+			for name, h := range cfg.Hosts {
+				if slices.Contains(h.Tags, tag) {
+					picked[name] = true
+				}
+			}
+		default:
+			if _, ok := cfg.Hosts[item]; !ok {
+				return nil, fmt.Errorf("--hosts: [hosts] 清单中没有主机 %s", item)
+			}
+			picked[item] = true
+		}
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("--hosts %s 没有选中任何主机", sel)
+	}
+	return sortedKeys(picked), nil
+}
+
+// 每台主机上的每个目录作为一个远程目标，输出以 主机:目录 为前缀
+func fleetDirs(hosts, dirs []string) ([]string, error) {
+	out := make([]string, 0, len(hosts)*len(dirs))
+	for _, dir := range dirs {
+		if _, _, remote := parseRemoteDir(dir); remote || strings.HasPrefix(dir, k8sScheme) {
+			return nil, fmt.Errorf("使用 --hosts 时目录参数为远程主机上的路径，不能是远程目标 %s", dir)
+		}
+	}
+	for _, host := range hosts {
+		for _, dir := range dirs {
+			out = append(out, host+":"+dir)
+		}
+	}
+	return out, nil
+}
+
+// 远程目标的主机在 [hosts] 清单中时，补上清单中的用户和端口；
+// 目标中已写了 user@ 时以目标为准
+func applyHosts(cfg *Config, targets []*target) error {
+	for _, t := range targets {
+		if t.Host == "" {
+			continue
+		}
+		_, name, hasUser := strings.Cut(t.Host, "@")
+		if !hasUser {
+			name = t.Host
+		}
+		h, ok := cfg.Hosts[name]
+		if !ok {
+			continue
+		}
+		if h.Port != "" {
+			if n, err := strconv.Atoi(h.Port); err != nil || n <= 0 || n > 65535 {
+				return fmt.Errorf("[hosts] 中主机 %s 的端口 %q 无效", name, h.Port)
+			}
+			t.Port = h.Port
+		}
+		if !hasUser && h.User != "" {
+			t.Host = h.User + "@" + name
+		}
+	}
+	return nil
+}
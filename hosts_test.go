@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testHosts = "[hosts]\nweb1 user=deploy tags=web,eu\nweb2 port=2222 tags=web\ndb1 tags=db\n"
+
+func TestSelectHosts(t *testing.T) {
+	cfg := parseConfig(testHosts)
+	tests := []struct {
+		sel     string
+		want    []string
+		wantErr bool
+	}{
+		{sel: "all", want: []string{"db1", "web1", "web2"}},
+		{sel: "tag=web", want: []string{"web1", "web2"}},
+		{sel: "tag=eu,db1", want: []string{"db1", "web1"}},
+		{sel: "web9", wantErr: true},
+		{sel: "tag=nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := selectHosts(cfg, tt.sel)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectHosts(%q) = %q, %v, want %q", tt.sel, got, err, tt.want)
+		}
+	}
+	if _, err := selectHosts(newConfig(), "all"); err == nil {
+		t.Errorf("没有 [hosts] 清单时应报错")
+	}
+}
+
+func TestFleetDirs(t *testing.T) {
+	got, err := fleetDirs([]string{"web1", "web2"}, []string{"/srv/a", "/srv/b"})
+	want := []string{"web1:/srv/a", "web1:/srv/b", "web2:/srv/a", "web2:/srv/b"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("fleetDirs = %q, %v, want %q", got, err, want)
+	}
+	for _, dir := range []string{"web3:/srv", "k8s://ns/app"} {
+		if _, err := fleetDirs([]string{"web1"}, []string{dir}); err == nil {
+			t.Errorf("fleetDirs 目录 %s 应报错", dir)
+		}
+	}
+}
+
+func TestApplyHosts(t *testing.T) {
+	cfg := parseConfig(testHosts + "bad port=99999\n")
+	tests := []struct {
+		dir      string
+		wantHost string
+		wantPort string
+		wantErr  bool
+	}{
+		{dir: "web1:/srv", wantHost: "deploy@web1"},
+		{dir: "root@web1:/srv", wantHost: "root@web1"},
+		{dir: "web2:/srv", wantHost: "web2", wantPort: "2222"},
+		{dir: "other:/srv", wantHost: "other"},
+		{dir: "./local"},
+		{dir: "bad:/srv", wantHost: "bad", wantErr: true},
+	}
+	for _, tt := range tests {
+		targets := newTargets([]string{tt.dir})
+		err := applyHosts(cfg, targets)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("applyHosts(%s) err = %v, wantErr %v", tt.dir, err, tt.wantErr)
+			continue
+		}
+		if got := targets[0]; got.Host != tt.wantHost || got.Port != tt.wantPort {
+			t.Errorf("applyHosts(%s) = %q port %q, want %q port %q", tt.dir, got.Host, got.Port, tt.wantHost, tt.wantPort)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// init 能识别的项目类型：目录中存在任一标记文件即认为属于该类型
+type projectType struct {
+	Name    string   // 组名和目录集合名的前缀
+	Label   string   // 提示中显示的名称
+	Markers []string // 标记文件
+	Groups  [][2]string
+}
+
+var projectTypes = []projectType{
+	{"go", "Go", []string{"go.mod"}, [][2]string{{"build", "go build ./..."}, {"test", "go test ./..."}}},
+	{"node", "Node.js", []string{"package.json"}, [][2]string{{"install", "npm ci"}, {"test", "npm test"}}},
+	{"rust", "Rust", []string{"Cargo.toml"}, [][2]string{{"build", "cargo build"}, {"test", "cargo test"}}},
+	{"python", "Python", []string{"pyproject.toml", "requirements.txt", "setup.py"}, [][2]string{{"test", "python -m pytest"}}},
+	{"maven", "Maven", []string{"pom.xml"}, [][2]string{{"build", "mvn -q package"}, {"test", "mvn -q test"}}},
+	{"make", "Make", []string{"Makefile"}, [][2]string{{"build", "make"}}},
+	{"compose", "Docker Compose", []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"},
+		[][2]string{{"update", "docker compose pull\ndocker compose up -d"}}},
+	{"git", "git", []string{".git"}, [][2]string{{"pull", "git pull --ff-only"}}},
+}
+
+// runCmd init：在当前目录生成初始的 config.txt
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	out := fs.String("o", externalConfigFiles[0], "写入的配置文件路径")
+	force := fs.Bool("force", false, "覆盖已存在的配置文件")
+	yes := fs.Bool("yes", false, "不询问，添加检测到的全部项目类型")
+	embedded := fs.Bool("embedded", false, "不检测项目，直接写入内嵌的默认配置")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd init [flags]")
+		fmt.Fprintln(fs.Output(), "检测当前目录下各子目录的项目类型（go.mod、package.json 等），生成对应的组和目录集合；")
+		fmt.Fprintln(fs.Output(), "没有检测到项目时写入内嵌的默认配置")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if _, err := os.Stat(*out); err == nil && !*force {
+		logger.Error(fmt.Sprintf("%s 已存在，使用 --force 覆盖", *out))
+		return exitUsage
+	}
+
+	var content string
+	if !*embedded {
+		found, err := detectProjects(".")
+		if err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+		if !*yes && isTerminal(os.Stdin) {
+			found = confirmProjects(os.Stdin, logOut, found)
+		}
+		if len(found) > 0 {
+			content = scaffoldConfig(found)
+		}
+	}
+	if content == "" {
+		data, _ := embeddedConfig.ReadFile("config.txt")
+		content = "# runCmd 配置，由 runCmd init 根据内嵌默认配置生成\n\n" + string(data)
+	}
+	if err := os.WriteFile(*out, []byte(content), 0o644); err != nil {
+		logger.Error(fmt.Sprintf("写入 %s 失败: %v", *out, err))
+		return exitUsage
+	}
+	logger.Info(fmt.Sprintf("已写入 %s，可用 ./runCmd validate 检查、./runCmd list 查看其中的组", *out), "config", *out)
+	return exitOK
+}
+
+// 检测到的一种项目类型及其目录
+type detectedProject struct {
+	projectType
+	Dirs []string
+}
+
+// 检查 root 下的各个子目录（不含隐藏目录），按 projectTypes 的顺序返回检测到的类型
+func detectProjects(root string) ([]detectedProject, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("读取目录失败: %w", err)
+	}
+	var found []detectedProject
+	for _, pt := range projectTypes {
+		var dirs []string
+		for _, e := range entries {
+			if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			for _, m := range pt.Markers {
+				if _, err := os.Stat(filepath.Join(root, e.Name(), m)); err == nil {
+					dirs = append(dirs, e.Name())
+					break
+				}
+			}
+		}
+		if len(dirs) > 0 {
+			sort.Strings(dirs)
+			found = append(found, detectedProject{pt, dirs})
+		}
+	}
+	return found, nil
+}
+
+// 逐个类型询问是否添加，直接回车视为同意
+func confirmProjects(in io.Reader, w io.Writer, found []detectedProject) []detectedProject {
+	reader := bufio.NewReader(in)
+	var chosen []detectedProject
+	for _, p := range found {
+		fmt.Fprintf(w, "检测到 %d 个 %s 项目 (%s)，添加对应的组？[Y/n] ", len(p.Dirs), p.Label, strings.Join(p.Dirs, ", "))
+		answer, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			break
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "y", "yes":
+			chosen = append(chosen, p)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return chosen
+}
+
+// 为检测到的项目生成配置：每种类型一组 <type>-<action> 组和 [dirs:<type>] 目录集合
+func scaffoldConfig(found []detectedProject) string {
+	var b strings.Builder
+	b.WriteString("# runCmd 配置，由 runCmd init 生成\n")
+	fmt.Fprintf(&b, "# 用法: ./runCmd %s-%s @%s\n\n", found[0].Name, found[0].Groups[0][0], found[0].Name)
+	fmt.Fprintf(&b, "[settings]\nconcurrency=%d\n", defaultConcurrency)
+	for _, p := range found {
+		for _, g := range p.Groups {
+			fmt.Fprintf(&b, "\n# %s 项目: %s\n[%s-%s]\n%s\n", p.Label, g[0], p.Name, g[0], g[1])
+		}
+		fmt.Fprintf(&b, "\n[dirs:%s]\n%s\n", p.Name, strings.Join(p.Dirs, "\n"))
+	}
+	return b.String()
+}
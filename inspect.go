@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runCmd list：列出合并后配置中的全部组，含命令数、来源和组头上方注释中的说明
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	addConfigFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd list")
+		fmt.Fprintln(fs.Output(), "组的说明写在组头上方紧挨着的 # 注释中（YAML 配置用 description）")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	tw := tabwriter.NewWriter(logOut, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tCMDS\tDEPS\tSOURCE\tDESCRIPTION")
+	for _, name := range sortedKeys(cfg.Groups) {
+		deps := cfg.Options[name]["deps"]
+		if deps == "" {
+			deps = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", name, len(cfg.Groups[name]), deps, cfg.Sources[name], cfg.Descs[name])
+	}
+	tw.Flush()
+	return exitOK
+}
+
+// 是否为历史运行 ID，如 12 或 #12
+func isRunID(s string) bool {
+	_, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 10, 64)
+	return err == nil
+}
+
+// runCmd show <group>：显示组的命令和选项；参数是运行 ID 时显示该次运行的结果
+func runShowCommand(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	addConfigFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd show <group>")
+		fmt.Fprintln(fs.Output(), "      ./runCmd show <run-id>    显示一次历史运行，如 show 12 或 show #12")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	setupColor(false, logOut)
+	name := fs.Arg(0)
+	if isRunID(name) {
+		return runShow(fs.Args())
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if name, err = cfg.matchGroup(name); err != nil {
+		logger.Error(err.Error())
+		return exitGroupNotFound
+	}
+	cmds := cfg.Groups[name]
+	fmt.Fprintf(logOut, "组 [%s]  来源: %s\n", name, cfg.Sources[name])
+	if d := cfg.Descs[name]; d != "" {
+		fmt.Fprintf(logOut, "说明: %s\n", d)
+	}
+	if opts := cfg.Options[name]; len(opts) > 0 {
+		var kv []string
+		for _, k := range sortedKeys(opts) {
+			kv = append(kv, k+"="+opts[k])
+		}
+		fmt.Fprintf(logOut, "选项: %s\n", strings.Join(kv, " "))
+	}
+	if env := cfg.Env[name]; len(env) > 0 {
+		fmt.Fprintf(logOut, "环境变量: %s\n", strings.Join(sortedKeys(env), ", "))
+	}
+	if chain, err := cfg.resolveGroupChain([]string{name}); err == nil && len(chain) > 1 {
+		fmt.Fprintf(logOut, "组链: %s\n", strings.Join(chain, " -> "))
+	}
+	fmt.Fprintf(logOut, "命令 (%d):\n", len(cmds))
+	for _, c := range cmds {
+		fmt.Fprintf(logOut, "  %s\n", c)
+	}
+	return exitOK
+}
+
+// runCmd validate：先逐行检查配置文本（带文件名和行号），再逐个组生成执行参数，报告配置中的错误
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	addConfigFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd validate")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	// 逐个检查内嵌配置、外部配置和其中 @include 的文件；加载失败时只检查外部配置本身
+	cfg, loadErr := loadConfig()
+	data, _ := embeddedConfig.ReadFile("config.txt")
+	issues := lintConfig("embedded:config.txt", string(data))
+	var files []string
+	if loadErr == nil {
+		files = cfg.Files
+	} else if name, _, err := findConfigFile(); err == nil && name != "" {
+		files = []string{name}
+	}
+	linted := make(map[string]bool)
+	for _, f := range files {
+		if linted[f] {
+			continue
+		}
+		linted[f] = true
+		if content, err := os.ReadFile(f); err == nil {
+			issues = append(issues, lintConfigFile(f, string(content))...)
+		}
+	}
+	var problems []string
+	for _, issue := range issues {
+		problems = append(problems, issue.String())
+	}
+	if loadErr != nil {
+		problems = append(problems, loadErr.Error())
+		for _, p := range problems {
+			fmt.Fprintln(logOut, p)
+		}
+		return exitConfigError
+	}
+	for _, name := range sortedKeys(cfg.Groups) {
+		if msg := groupNameConflict(name); msg != "" {
+			problems = append(problems, msg)
+		}
+		if _, err := cfg.resolveGroupChain([]string{name}); err != nil {
+			problems = append(problems, fmt.Sprintf("[%s] %v", name, err))
+		}
+		if _, err := newRunOptions(cfg, name, cfg.Groups[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("[%s] %v", name, err))
+		}
+	}
+	checks := []func() error{
+		func() error { _, err := parseNotifyConfig(cfg.Notify); return err },
+		func() error { _, err := parseScheduleSetting(cfg.Settings["schedule"]); return err },
+		func() error { _, err := parseMaxRunTime(cfg); return err },
+		func() error { return checkMergeStrategy(cfg) },
+		func() error { return checkHooks(cfg) },
+		func() error { _, err := historyPath(cfg); return err },
+		func() error { _, err := parseOutputModes(cfg.Settings["output"]); return err },
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(logOut, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(logOut, "配置有 %d 个问题\n", len(problems))
+		return exitConfigError
+	}
+	fmt.Fprintf(logOut, "配置有效: %d 个组\n", len(cfg.Groups))
+	return exitOK
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --junit 时失败用例中附带的输出行数，0 表示不保留输出
+var outputTailLines int
+
+const junitTailLines = 50
+
+// 一个组在目录中最后的若干行输出
+type outputTail struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (o *outputTail) add(line string, max int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.lines) >= max {
+		o.lines = append(o.lines[:0], o.lines[len(o.lines)-max+1:]...)
+	}
+	o.lines = append(o.lines, line)
+}
+
+// 取出并清空
+func (o *outputTail) take() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	lines := o.lines
+	o.lines = nil
+	return lines
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// 每个组一个 testsuite，每个目录一个 testcase
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// 把运行结果写成 JUnit XML：FAIL/TIMEOUT 为 failure（附最后的输出），SKIPPED/CANCELLED 为 skipped
+func writeJUnitReport(path, name string, results []*dirResult, start time.Time, elapsed time.Duration) error {
+	suites := junitTestSuites{Name: "runCmd " + name, Time: seconds(elapsed)}
+	index := make(map[string]int)
+	total := make(map[string]time.Duration)
+	for _, r := range results {
+		i, ok := index[r.Group]
+		if !ok {
+			i = len(suites.Suites)
+			index[r.Group] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: r.Group, Timestamp: start.Format("2006-01-02T15:04:05")})
+		}
+		suite := &suites.Suites[i]
+		tc := junitTestCase{Name: r.Dir, ClassName: r.Group, Time: seconds(r.Duration)}
+		msg := r.Status
+		if r.Err != nil {
+			msg = r.Err.Error()
+		}
+		tail := strings.Join(r.OutputTail, "\n")
+		switch {
+		case r.failed():
+			tc.Failure = &junitMessage{Message: msg, Type: r.Status, Text: tail}
+			suite.Failures++
+		case !okStatus(r.Status):
+			tc.Skipped = &junitMessage{Message: msg}
+			suite.Skipped++
+		case r.Status == statusCached:
+			tc.SystemOut = "CACHED"
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+		total[r.Group] += r.Duration
+	}
+	for i := range suites.Suites {
+		s := &suites.Suites[i]
+		s.Time = seconds(total[s.Name])
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+		suites.Skipped += s.Skipped
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("写入 JUnit 报告 %s 失败: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const k8sScheme = "k8s://"
+
+// 解析 k8s://namespace/selector:/workdir，selector 为 pod 名或 app=web 这样的标签选择器
+func parseK8sTarget(s string) (ns, selector, workdir string, ok bool) {
+	rest, ok := strings.CutPrefix(s, k8sScheme)
+	if !ok {
+		return "", "", "", false
+	}
+	ref, workdir, _ := strings.Cut(rest, ":")
+	ns, selector, found := strings.Cut(ref, "/")
+	if !found || ns == "" || selector == "" {
+		return "", "", "", false
+	}
+	return ns, selector, workdir, true
+}
+
+// 把使用标签选择器的 k8s 目标展开为每个运行中的 pod
+func expandK8sTargets(args []string, kubectlOpts []string) ([]string, error) {
+	var out []string
+	for _, arg := range args {
+		ns, selector, workdir, ok := parseK8sTarget(arg)
+		if !ok || !strings.Contains(selector, "=") {
+			out = append(out, arg)
+			continue
+		}
+		kargs := append(append([]string{}, kubectlOpts...), "get", "pods", "-n", ns, "-l", selector,
+			"--field-selector=status.phase=Running", "-o", "jsonpath={.items[*].metadata.name}")
+		data, err := exec.Command("kubectl", kargs...).Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+				err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return nil, fmt.Errorf("查询 pod 失败 %s: %w", arg, err)
+		}
+		pods := strings.Fields(string(data))
+		if len(pods) == 0 {
+			logger.Warn(fmt.Sprintf("%s 没有匹配到运行中的 pod", arg), "target", arg)
+		}
+		for _, pod := range pods {
+			out = append(out, fmt.Sprintf("%s%s/%s:%s", k8sScheme, ns, pod, workdir))
+		}
+	}
+	return out, nil
+}
+
+// 构造通过 kubectl exec 在 pod 中执行步骤的命令
+func kubectlCommand(ctx context.Context, t *target, opts *runOptions, step cmdStep) *exec.Cmd {
+	args := append(append([]string{}, opts.KubectlOptions...), "exec", "-i", "-n", t.Namespace, t.Pod)
+	if opts.K8sContainer != "" {
+		args = append(args, "-c", opts.K8sContainer)
+	}
+	args = append(args, "--", "sh", "-c", remoteScript(t, opts, step))
+	return setRemoteEnv(exec.CommandContext(ctx, "kubectl", args...), opts)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ionice 的调度类
+const (
+	ioClassIdle       = "idle"        // 只在磁盘空闲时读写
+	ioClassBestEffort = "best-effort" // 默认类，级别 0-7，越大越低
+)
+
+// nice、ionice、cpu_limit、mem_limit：限制本机执行的命令占用的资源，
+// 整批构建可以与交互工作共用一台机器。对 ssh、k8s 目标不生效；容器中执行时
+// cpu_limit、mem_limit 转为 docker run 的 --cpus、--memory
+type resourceLimits struct {
+	Nice    int     // 0 表示不调整
+	IOClass string  // 空表示不调整
+	IOLevel int     // best-effort 的级别
+	CPUs    float64 // 最多使用的 CPU 数，0 表示不限制
+	Memory  int64   // 内存上限（字节），0 表示不限制
+}
+
+func parseResourceLimits(cfg *Config, group string) (resourceLimits, error) {
+	var l resourceLimits
+	if v, ok := cfg.groupSetting(group, "nice"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < -20 || n > 19 {
+			return l, fmt.Errorf("无效的 nice 配置 %q，需要 -20 到 19 之间的整数", v)
+		}
+		l.Nice = n
+	}
+	if v, ok := cfg.groupSetting(group, "ionice"); ok && v != "" {
+		class, level, hasLevel := strings.Cut(v, ":")
+		l.IOClass, l.IOLevel = class, 4
+		switch {
+		case class == ioClassIdle && !hasLevel:
+		case class == ioClassBestEffort && hasLevel:
+			n, err := strconv.Atoi(level)
+			if err != nil || n < 0 || n > 7 {
+				return l, fmt.Errorf("无效的 ionice 配置 %q，best-effort 的级别为 0-7", v)
+			}
+			l.IOLevel = n
+		case class == ioClassBestEffort:
+		default:
+			return l, fmt.Errorf("无效的 ionice 配置 %q，可选 %s、%s[:0-7]", v, ioClassIdle, ioClassBestEffort)
+		}
+	}
+	if v, ok := cfg.groupSetting(group, "cpu_limit"); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return l, fmt.Errorf("无效的 cpu_limit 配置 %q，需要大于 0 的 CPU 数", v)
+		}
+		l.CPUs = f
+	}
+	n, err := cfg.sizeSetting(group, "mem_limit", 0)
+	if err != nil {
+		return l, err
+	}
+	l.Memory = n
+	return l, nil
+}
+
+func (l resourceLimits) enabled() bool {
+	return l.Nice != 0 || l.IOClass != "" || l.CPUs > 0 || l.Memory > 0
+}
+
+// 容器中执行时传给 docker run 的参数
+func (l resourceLimits) dockerArgs() []string {
+	var args []string
+	if l.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(l.CPUs, 'f', -1, 64))
+	}
+	if l.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(l.Memory, 10))
+	}
+	return args
+}
+
+// 执行前检查：nice、ionice 需要同名命令，cpu_limit、mem_limit 需要可委派的 cgroup v2。
+// 明确配置了限制却无法生效时报配置错误，而不是不加限制地执行
+func (l resourceLimits) check() error {
+	if l.Nice != 0 {
+		if _, err := exec.LookPath("nice"); err != nil {
+			return fmt.Errorf("配置了 nice=%d，但没有找到 nice 命令", l.Nice)
+		}
+	}
+	if l.IOClass != "" {
+		if _, err := exec.LookPath("ionice"); err != nil {
+			return fmt.Errorf("配置了 ionice=%s，但没有找到 ionice 命令", l.IOClass)
+		}
+	}
+	if l.CPUs > 0 || l.Memory > 0 {
+		if err := checkCgroup(l); err != nil {
+			return fmt.Errorf("cpu_limit、mem_limit 无法生效: %w", err)
+		}
+	}
+	return nil
+}
+
+// 一次进程执行的资源限制，进程结束后删除为它创建的 cgroup
+type procLimits struct {
+	cg *cgroup // cpu_limit、mem_limit 时为本次进程创建的 cgroup
+}
+
+// 启动前调用，限制在 exec 之前就已生效，命令 fork 的子进程全部继承：
+// cpu_limit、mem_limit 通过 CLONE_INTO_CGROUP 让进程直接在新建的 cgroup 中启动，
+// nice、ionice 用同名命令包装原命令
+func prepareLimits(c *exec.Cmd, l resourceLimits) (*procLimits, error) {
+	if !l.enabled() {
+		return nil, nil
+	}
+	p := &procLimits{}
+	if l.CPUs > 0 || l.Memory > 0 {
+		cg, err := newCgroup(l)
+		if err != nil {
+			return nil, fmt.Errorf("创建 cgroup 失败: %w", err)
+		}
+		cg.attach(c)
+		p.cg = cg
+	}
+	if err := l.wrap(c); err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// 把命令改写为 nice -n N ionice -c CLASS 原命令
+func (l resourceLimits) wrap(c *exec.Cmd) error {
+	var args []string
+	if l.Nice != 0 {
+		nice, err := exec.LookPath("nice")
+		if err != nil {
+			return err
+		}
+		args = append(args, nice, "-n", strconv.Itoa(l.Nice))
+	}
+	if l.IOClass != "" {
+		ionice, err := exec.LookPath("ionice")
+		if err != nil {
+			return err
+		}
+		args = append(args, ionice, "-c", "3")
+		if l.IOClass == ioClassBestEffort {
+			args = append(args[:len(args)-1], "2", "-n", strconv.Itoa(l.IOLevel))
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	c.Args = append(append(args, c.Path), c.Args[1:]...)
+	c.Path = args[0]
+	return nil
+}
+
+// 进程结束后删除 cgroup
+func (p *procLimits) close() {
+	if p != nil && p.cg != nil {
+		p.cg.remove()
+	}
+}
@@ -0,0 +1,142 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	cgroupRoot      = "/sys/fs/cgroup"
+	cgroupCPUPeriod = 100000 // cpu.max 的周期（微秒）
+)
+
+// 为一次进程执行创建的 cgroup v2，进程通过 CLONE_INTO_CGROUP 直接在其中启动
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+var (
+	cgroupMu     sync.Mutex
+	cgroupParent string // 启用了控制器、用于创建子 cgroup 的目录
+)
+
+// 在 runCmd 所在的 cgroup 中为子 cgroup 启用控制器。cgroup v2 中有进程的 cgroup
+// 不能给子 cgroup 启用控制器（EBUSY），这时先把 runCmd 自身移到叶子 cgroup runcmd-self 中。
+// 当前 cgroup 需要可以委派（cgroup 根目录，或 systemd 的 Delegate=yes）
+func enableControllers(l resourceLimits) (string, error) {
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+	if cgroupParent == "" {
+		parent, err := selfCgroup()
+		if err != nil {
+			return "", err
+		}
+		cgroupParent = parent
+	}
+	var controllers []string
+	if l.CPUs > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if l.Memory > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	control := filepath.Join(cgroupParent, "cgroup.subtree_control")
+	err := os.WriteFile(control, []byte(strings.Join(controllers, " ")), 0)
+	if errors.Is(err, syscall.EBUSY) {
+		leaf := filepath.Join(cgroupParent, "runcmd-self")
+		if err = os.Mkdir(leaf, 0o755); err == nil || errors.Is(err, os.ErrExist) {
+			err = os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0)
+		}
+		if err == nil {
+			err = os.WriteFile(control, []byte(strings.Join(controllers, " ")), 0)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("无法在 %s 中启用 %s 控制器，需要可以委派的 cgroup（例如用 systemd-run --user --scope -p Delegate=yes 启动 runCmd）: %w",
+			cgroupParent, strings.Join(controllers, " "), err)
+	}
+	return cgroupParent, nil
+}
+
+func checkCgroup(l resourceLimits) error {
+	_, err := enableControllers(l)
+	return err
+}
+
+// 在启用了控制器的 cgroup 下创建子 cgroup，写入 cpu.max 和 memory.max
+func newCgroup(l resourceLimits) (*cgroup, error) {
+	parent, err := enableControllers(l)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, "runcmd-")
+	if err != nil {
+		return nil, err
+	}
+	cg := &cgroup{dir: dir}
+	if l.CPUs > 0 {
+		err = os.WriteFile(filepath.Join(dir, "cpu.max"), fmt.Appendf(nil, "%d %d", int64(l.CPUs*cgroupCPUPeriod), cgroupCPUPeriod), 0)
+	}
+	if err == nil && l.Memory > 0 {
+		err = os.WriteFile(filepath.Join(dir, "memory.max"), fmt.Appendf(nil, "%d", l.Memory), 0)
+	}
+	if err == nil {
+		cg.fd, err = os.Open(dir)
+	}
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+// 当前进程所在的 cgroup v2 目录
+func selfCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("未挂载 cgroup v2")
+	}
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupRoot, p), nil
+		}
+	}
+	return "", errors.New("/proc/self/cgroup 中没有 cgroup v2 路径")
+}
+
+func (cg *cgroup) attach(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.UseCgroupFD = true
+	c.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// 终止 cgroup 中残留的后台进程后删除
+func (cg *cgroup) remove() {
+	if cg.fd != nil {
+		_ = cg.fd.Close()
+	}
+	_ = os.WriteFile(filepath.Join(cg.dir, "cgroup.kill"), []byte("1"), 0)
+	for range 50 {
+		if err := os.Remove(cg.dir); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	logger.Debug(fmt.Sprintf("删除 cgroup %s 失败", cg.dir), "phase", "limits", "cgroup", cg.dir)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// 非 Linux 平台没有 cgroup
+type cgroup struct{}
+
+func newCgroup(l resourceLimits) (*cgroup, error) {
+	return nil, errors.New("仅 Linux 支持 cgroup")
+}
+
+func checkCgroup(l resourceLimits) error {
+	return errors.New("仅 Linux 支持 cgroup")
+}
+
+func (cg *cgroup) attach(c *exec.Cmd) {}
+
+func (cg *cgroup) remove() {}
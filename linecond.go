@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// 命令行前的条件前缀，可写多个，全部满足时才执行该行：
+//
+//	@linux make build
+//	@windows msbuild app.sln
+//	@if-exists Makefile make test
+//	@if-missing go.mod @unix ./build.sh
+var (
+	condOS   = []string{"linux", "darwin", "windows", "freebsd", "openbsd", "netbsd"}
+	condArch = []string{"amd64", "arm64", "386", "arm", "riscv64", "ppc64le", "s390x"}
+)
+
+type lineCond struct {
+	Kind string // os、arch、exists、missing
+	Arg  string
+}
+
+// 拆出命令行前的条件前缀；不认识的 @ 开头的词（如 cmd 的 @echo off）当作命令本身
+func parseLineConds(line string) ([]lineCond, string, error) {
+	var conds []lineCond
+loop:
+	for strings.HasPrefix(line, "@") {
+		word, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		name := word[1:]
+		switch {
+		case name == "unix":
+			conds = append(conds, lineCond{Kind: "os", Arg: name})
+		case slices.Contains(condOS, name):
+			conds = append(conds, lineCond{Kind: "os", Arg: name})
+		case slices.Contains(condArch, name):
+			conds = append(conds, lineCond{Kind: "arch", Arg: name})
+		case name == "if-exists" || name == "if-missing":
+			path, after, _ := strings.Cut(rest, " ")
+			if path == "" {
+				return nil, "", fmt.Errorf("%s 需要文件路径", word)
+			}
+			conds = append(conds, lineCond{Kind: strings.TrimPrefix(name, "if-"), Arg: path})
+			rest = strings.TrimSpace(after)
+		default:
+			break loop
+		}
+		line = rest
+	}
+	if len(conds) > 0 && line == "" {
+		return nil, "", fmt.Errorf("条件前缀后缺少命令")
+	}
+	return conds, line, nil
+}
+
+// 去掉全部条件前缀后的命令，以及是否有命令带条件前缀
+func stripLineConds(cmds []string) ([]string, bool, error) {
+	out := make([]string, 0, len(cmds))
+	found := false
+	for _, line := range cmds {
+		conds, cmd, err := parseLineConds(line)
+		if err != nil {
+			return nil, false, err
+		}
+		found = found || len(conds) > 0
+		out = append(out, cmd)
+	}
+	return out, found, nil
+}
+
+// 条件在目标上是否满足；容器中按 linux 判断，ssh/k8s 目标无法在本机判断
+func (c lineCond) holds(t *target, opts *runOptions) (bool, error) {
+	if t.remote() {
+		return false, fmt.Errorf("远程目标不支持条件前缀 @%s", c.Arg)
+	}
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if opts.Container != nil {
+		goos = "linux"
+	}
+	switch c.Kind {
+	case "os":
+		if c.Arg == "unix" {
+			return goos != "windows", nil
+		}
+		return goos == c.Arg, nil
+	case "arch":
+		return goarch == c.Arg, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(t.Dir, expandTemplate(t, opts, c.Arg)))
+	if err != nil {
+		return false, fmt.Errorf("无效的路径 %q: %w", c.Arg, err)
+	}
+	return (len(matches) > 0) == (c.Kind == "exists"), nil
+}
+
+// 去掉条件前缀，只保留在该目标上满足条件的命令
+func selectLines(t *target, opts *runOptions, cmds []string) ([]string, error) {
+	var out []string
+	for _, line := range cmds {
+		conds, cmd, err := parseLineConds(line)
+		if err != nil {
+			return nil, err
+		}
+		ok := true
+		for _, c := range conds {
+			if ok, err = c.holds(t, opts); err != nil {
+				return nil, err
+			} else if !ok {
+				break
+			}
+		}
+		if ok {
+			out = append(out, cmd)
+		}
+	}
+	return out, nil
+}
+
+// 目标上实际执行的步骤：有条件前缀时按目录重新选出命令
+func (opts *runOptions) stepsFor(t *target) ([]cmdStep, error) {
+	if !opts.LineConds {
+		return opts.Steps, nil
+	}
+	cmds, err := selectLines(t, opts, opts.Cmds)
+	if err != nil {
+		return nil, fmt.Errorf("组 [%s]: %w", opts.Group, err)
+	}
+	return buildSteps(opts.Group, cmds, opts.Shell, opts.PerCommand)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置中可用的设置：[settings] 中的 key / key.group，以及组头选项
+var knownSettings = map[string]bool{
+	"age_identity": true, "buffer_memory": true, "cache": true, "cache_file": true, "cache_files": true, "clean_env": true, "confirm": true, "concurrency": true, "container": true, "container_options": true,
+	"container_workdir": true, "cpu_limit": true, "deps": true, "dotenv": true, "extends": true, "extends_url": true, "fail_fast": true,
+	"grace_period": true, "grep": true, "grep_v": true, "history": true, "history_file": true, "host_concurrency": true, "infer_depends": true, "ionice": true,
+	"k8s_container": true, "lock": true, "lock_timeout": true, "kubectl_options": true, "log_dir": true, "mask": true,
+	"max_line_size": true, "max_output_bytes": true, "max_output_lines": true, "max_failures": true, "max_failure_pct": true, "max_load": true, "merge_strategy": true, "max_run_time": true, "mem_limit": true, "min_free_memory": true,
+	"nice": true, "output": true, "parallel": true, "parallel_limit": true, "per_command": true, "pty": true, "protected_groups": true, "retries": true,
+	"retry_delay": true, "sandbox": true, "sandbox_network": true, "sandbox_writable": true, "schedule": true, "serve_addr": true, "shell": true, "singleton": true,
+	"ssh_options": true, "stderr": true, "stderr_log": true, "sync": true, "sync_artifacts": true, "sync_exclude": true, "sync_src": true, "timeout": true,
+	"timestamps": true, "user": true, "watch_debounce": true, "watch_ignore": true, "weight": true,
+}
+
+// YAML 配置的顶层键
+var yamlSections = map[string]bool{
+	"settings": true, "groups": true, "dirs": true, "vars": true, "env": true, "notify": true, "weights": true, "depends_on": true, "hooks": true, "tags": true, "priority": true, "secrets": true, "hosts": true,
+	"include": true, "profiles": true,
+}
+
+// 配置文件中的一个问题
+type lintIssue struct {
+	Source string
+	Line   int
+	Msg    string
+}
+
+func (i lintIssue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.Source, i.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", i.Source, i.Line, i.Msg)
+}
+
+// 按文件扩展名检查配置文本
+func lintConfigFile(source, content string) []lintIssue {
+	if isYAMLFile(source) {
+		return lintYAMLConfig(source, content)
+	}
+	return lintConfig(source, content)
+}
+
+// 检查 INI 格式的配置：括号不匹配、重复的组、空组、未知设置、无法解析的行，
+// 以及因失败策略前缀或 exec 命令隐式改为逐条执行的组
+func lintConfig(source, content string) []lintIssue {
+	var issues []lintIssue
+	add := func(line int, format string, args ...any) {
+		issues = append(issues, lintIssue{source, line, fmt.Sprintf(format, args...)})
+	}
+
+	seen := make(map[string]int) // 区块名 -> 首次出现的行号
+	var section string           // 当前区块名，组为组名
+	var kind string              // 去掉 @profile 后的区块名
+	var sectionLine, cmds int
+	isGroup := false
+	perLine := false // 组头写了 per_command=true 或 parallel=true，或已经提示过逐条执行
+	endSection := func() {
+		if isGroup && cmds == 0 && kind == section {
+			add(sectionLine, "组 [%s] 没有任何命令", section)
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// 只有 [ 没有 ]（或反过来）多半是写错的区块头；[ -f x ] && ... 这样的 shell 命令不算
+		opening, closing := strings.HasPrefix(line, "["), strings.HasSuffix(line, "]")
+		if opening && !strings.Contains(line, "]") || closing && !strings.Contains(line, "[") {
+			add(n, "区块头的方括号不匹配: %s", line)
+			continue
+		}
+		if !opening || !closing {
+			switch {
+			case strings.HasPrefix(line, "@include ") && !isGroup && !strings.HasPrefix(kind, "dirs:"):
+			case section == "":
+				add(n, "不属于任何区块的行会被忽略: %s", line)
+			case isGroup:
+				cmds++
+				if !perLine && splitsGroup(line) {
+					add(n, "组 [%s] 中的 %s 让整组改为每条命令独立进程执行，cd、export 不会延续到下一条；确认无误可在组头写 per_command=true", section, line)
+					perLine = true
+				}
+			case strings.HasPrefix(kind, "dirs:"):
+			case kind == "hosts":
+				for _, f := range splitHeaderFields(line)[1:] {
+					if k, _, _ := strings.Cut(f, "="); k != "user" && k != "port" && k != "tags" {
+						add(n, "[hosts] 中未知的主机属性 %s，目前只支持 user=、port=、tags=", f)
+					}
+				}
+			case kind == "dirs":
+				for _, f := range splitHeaderFields(line)[1:] {
+					if !strings.HasPrefix(f, "tags=") && !strings.HasPrefix(f, "priority=") {
+						add(n, "[dirs] 中未知的目录属性 %s，目前只支持 tags=、priority=", f)
+					}
+				}
+			case !strings.Contains(line, "="):
+				add(n, "[%s] 中的行缺少 =: %s", section, line)
+			case kind == "settings":
+				key, _, _ := strings.Cut(line, "=")
+				lintSettingKey(strings.TrimSpace(key), func(msg string) { add(n, "%s", msg) })
+			}
+			continue
+		}
+
+		endSection()
+		header := strings.Trim(line, "[]")
+		if strings.Count(header, `"`)%2 != 0 {
+			add(n, "区块头的引号不匹配: %s", line)
+		}
+		fields := splitHeaderFields(header)
+		if len(fields) == 0 {
+			add(n, "空的区块头")
+			section, kind, isGroup = "", "", false
+			continue
+		}
+		section, sectionLine, cmds, perLine = fields[0], n, 0, false
+		kind, _, _ = strings.Cut(section, "@")
+		isGroup = kind != "settings" && kind != "vars" && kind != "notify" && kind != "weights" && kind != "depends_on" && kind != "hooks" && kind != "dirs" && kind != "hosts" &&
+			kind != "env" && !strings.HasPrefix(kind, "env:") && !strings.HasPrefix(kind, "dirs:")
+		if first, dup := seen[section]; dup {
+			if isGroup {
+				add(n, "组 [%s] 重复定义（第 %d 行），后面的定义会覆盖前面的", section, first)
+			} else if strings.HasPrefix(kind, "dirs:") {
+				add(n, "目录集合 [%s] 重复定义（第 %d 行）", section, first)
+			}
+		} else {
+			seen[section] = n
+		}
+		for _, f := range fields[1:] {
+			k, v, ok := strings.Cut(f, "=")
+			if (k == "per_command" || k == "parallel") && v == "true" {
+				perLine = true
+			}
+			_, directive := mergeDirective(f)
+			switch {
+			case !isGroup:
+				add(n, "[%s] 不支持区块头选项: %s", section, f)
+			case directive:
+			case strings.HasPrefix(f, "+") || strings.HasPrefix(f, "=") && !strings.Contains(f[1:], "="):
+				add(n, "组 [%s] 的未知合并方式 %s，可选 +%s、=%s", section, f, mergeAppend, mergeReplace)
+			case !ok:
+				add(n, "组 [%s] 的选项缺少 =: %s", section, f)
+			default:
+				if msg := lintGroupOption(section, k); msg != "" {
+					add(n, "%s", msg)
+				}
+			}
+		}
+	}
+	endSection()
+	return issues
+}
+
+// 检查 [settings] 中的键，支持 key.group 形式
+func lintSettingKey(key string, report func(string)) {
+	base, _, _ := strings.Cut(key, ".")
+	if !knownSettings[base] {
+		report(fmt.Sprintf("未知的设置 %s", key))
+	}
+}
+
+// 检查 YAML 配置：语法错误（含重复的键）、未知的顶层键和设置、空组
+func lintYAMLConfig(source, content string) []lintIssue {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return []lintIssue{{Source: source, Msg: err.Error()}}
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	var issues []lintIssue
+	top := root.Content[0]
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		key, val := top.Content[i], top.Content[i+1]
+		if !yamlSections[key.Value] {
+			issues = append(issues, lintIssue{source, key.Line, fmt.Sprintf("未知的顶层键 %s", key.Value)})
+			continue
+		}
+		if val.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(val.Content); j += 2 {
+			k, v := val.Content[j], val.Content[j+1]
+			switch key.Value {
+			case "settings":
+				lintSettingKey(k.Value, func(msg string) { issues = append(issues, lintIssue{source, k.Line, msg}) })
+			case "groups":
+				var g yamlGroup
+				if err := v.Decode(&g); err == nil && len(g.Commands) == 0 {
+					issues = append(issues, lintIssue{source, k.Line, fmt.Sprintf("组 [%s] 没有任何命令", k.Value)})
+				}
+				if g.Merge != "" && g.Merge != mergeAppend && g.Merge != mergeReplace {
+					issues = append(issues, lintIssue{source, k.Line, fmt.Sprintf("组 [%s] 的未知合并方式 %s", k.Value, g.Merge)})
+				}
+				for _, opt := range sortedKeys(g.Options) {
+					if msg := lintGroupOption(k.Value, opt); msg != "" {
+						issues = append(issues, lintIssue{source, k.Line, msg})
+					}
+				}
+				if g.Options["per_command"] != "true" && g.Options["parallel"] != "true" {
+					for _, line := range g.Commands {
+						if splitsGroup(line) {
+							issues = append(issues, lintIssue{source, k.Line, fmt.Sprintf("组 [%s] 中的 %s 让整组改为每条命令独立进程执行，cd、export 不会延续到下一条；确认无误可在组选项中写 per_command: true", k.Value, line)})
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
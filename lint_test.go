@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintConfigPerLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		content string
+		want    int // 逐条执行提示的数量
+	}{
+		{"warn 前缀", "config.txt", "[g]\ncd sub\n!make\n- make lint\n", 1},
+		{"exec 命令", "config.txt", "[g]\nexec: git status\n", 1},
+		{"shell 取反", "config.txt", "[g]\n! test -f x\n", 0},
+		{"明确写了 per_command", "config.txt", "[g per_command=true]\n!make\n", 0},
+		{"parallel 组", "config.txt", "[g parallel=true]\n- make\n", 0},
+		{"每个组各提示一次", "config.txt", "[a]\n!make\n[b]\n- make\n", 2},
+		{"YAML", "config.yaml", "groups:\n  g:\n    commands: [\"!make\", \"cd sub\"]\n", 1},
+		{"YAML per_command", "config.yaml", "groups:\n  g:\n    commands: [\"!make\"]\n    options: {per_command: \"true\"}\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := 0
+			for _, issue := range lintConfigFile(tt.source, tt.content) {
+				if strings.Contains(issue.Msg, "每条命令独立进程") {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Errorf("提示数 = %d, want %d: %v", got, tt.want, lintConfigFile(tt.source, tt.content))
+			}
+		})
+	}
+}
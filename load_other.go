@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// 其他平台暂不读取系统负载，不做限流
+func loadAverage() (float64, bool) {
+	return 0, false
+}
+
+func memoryAvailable() (avail, total int64, ok bool) {
+	return 0, 0, false
+}
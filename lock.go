@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 每个目录的锁文件
+const dirLockFile = ".runcmd.lock"
+
+// 目录锁被占用时的处理方式
+const (
+	lockOff  = "off"
+	lockWait = "wait"
+	lockSkip = "skip"
+	lockFail = "fail"
+)
+
+// 等待目录锁时的轮询间隔
+const lockPollInterval = 200 * time.Millisecond
+
+var errDirLocked = errors.New("目录正被另一个 runCmd 进程使用")
+
+func parseLockSetting(v string) (string, error) {
+	switch v {
+	case "", lockOff, "false":
+		return lockOff, nil
+	case lockWait, "true":
+		return lockWait, nil
+	case lockSkip, lockFail:
+		return v, nil
+	}
+	return "", fmt.Errorf("无效的 lock 配置 %q，可选 off、wait、skip、fail", v)
+}
+
+// 组链中第一个开启 lock 的组决定整个目录的加锁方式
+func chainLock(chain []*runOptions) (string, time.Duration) {
+	for _, opts := range chain {
+		if opts.Lock != lockOff {
+			return opts.Lock, opts.LockTimeout
+		}
+	}
+	return lockOff, 0
+}
+
+// 获取目录的锁文件，wait 模式下轮询直到拿到锁、超时或取消；返回的函数用于释放
+func lockDir(ctx context.Context, t *target, mode string, timeout time.Duration) (func(), error) {
+	return acquireLock(ctx, filepath.Join(t.Dir, dirLockFile), mode == lockWait, timeout, errDirLocked, func() {
+		t.logger().Info(fmt.Sprintf("%s 目录正被另一个 runCmd 进程使用，等待锁释放...", prefix(t.Dir)), "phase", "lock")
+	})
+}
+
+// 对 path 加排他锁并写入本进程 pid；被占用时不等待则返回 busy，
+// 等待时先调用一次 onWait 再轮询，timeout 为 0 表示不限制
+func acquireLock(ctx context.Context, path string, wait bool, timeout time.Duration, busy error, onWait func()) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("创建锁文件 %s 失败: %w", path, err)
+	}
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for waited := false; ; waited = true {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("锁定 %s 失败: %w", path, err)
+		}
+		if ok {
+			break
+		}
+		if !wait {
+			_ = f.Close()
+			return nil, busy
+		}
+		if !waited {
+			onWait()
+		}
+		select {
+		case <-time.After(lockPollInterval):
+		case <-deadline:
+			_ = f.Close()
+			return nil, fmt.Errorf("等待锁超过 %s: %w", timeout, busy)
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		}
+	}
+	// 记录持有者的 pid，便于排查
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+	}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志文件中每行的时间格式
+const logTimeFormat = "2006-01-02 15:04:05.000"
+
+// 单个目录单个组的日志文件，parallel 步骤会同时写入
+type dirLog struct {
+	mu   sync.Mutex
+	f    *os.File
+	Path string
+}
+
+// 创建 <log_dir>/<group>/<目录名><ext>，已存在时覆盖
+func openDirLog(logDir, group, dir, ext string) (*dirLog, error) {
+	path := filepath.Join(logDir, group, sanitizeLogName(dir)+ext)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &dirLog{f: f, Path: path}, nil
+}
+
+// 把目录路径转成可用作文件名的形式，如 ./svc/api -> svc_api
+func sanitizeLogName(dir string) string {
+	name := strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/.")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// 写入一行带时间戳的日志，l 为 nil 时什么都不做
+func (l *dirLog) printf(format string, args ...any) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.f, "%s %s\n", time.Now().Format(logTimeFormat), fmt.Sprintf(format, args...))
+}
+
+func (l *dirLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
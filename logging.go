@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// --log-format 的取值
+const (
+	logFormatConsole = "console" // 默认：只输出消息文本，与命令输出交错显示
+	logFormatText    = "text"    // slog 的 key=value 格式
+	logFormatJSON    = "json"    // 每条进度信息一行 JSON
+)
+
+var (
+	logLevel  = new(slog.LevelVar)
+	logFormat = logFormatConsole
+
+	// 进度与诊断信息的日志，命令输出不经过这里
+	logger = newLogger(consoleWriter{})
+)
+
+// 写入时才取目标 Writer：logOut 在 JSON 模式、TUI 和 serve 中会被替换
+type writerFunc func() io.Writer
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f().Write(p)
+}
+
+func newLogger(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	switch logFormat {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(w, opts))
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(&consoleHandler{w: w})
+}
+
+// 按 --log-level / --log-format 重新生成日志
+func setupLogging(level, format string) error {
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("无效的 --log-level %q，可选 debug、info、warn、error", level)
+	}
+	switch format {
+	case logFormatConsole, logFormatText, logFormatJSON:
+	default:
+		return fmt.Errorf("无效的 --log-format %q，可选 %s、%s、%s", format, logFormatConsole, logFormatText, logFormatJSON)
+	}
+	logFormat = format
+	logger = newLogger(consoleWriter{})
+	return nil
+}
+
+// 目录的日志，写入该目录当前的输出（缓冲模式下随目录输出一起打印）
+func (t *target) logger() *slog.Logger {
+	return newLogger(writerFunc(t.w)).With("dir", t.Dir)
+}
+
+// 控制台格式下用空行分隔各目录的输出
+func consoleBlankLine(w io.Writer) {
+	if logFormat == logFormatConsole && logLevel.Level() <= slog.LevelInfo {
+		fmt.Fprintln(w)
+	}
+}
+
+// 控制台格式：只输出消息文本，字段只在 text/json 格式中保留
+type consoleHandler struct {
+	w io.Writer
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	_, err := io.WriteString(h.w, r.Message+"\n")
+	return err
+}
+
+func (h *consoleHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *consoleHandler) WithGroup(string) slog.Handler { return h }
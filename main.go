@@ -1,167 +1,616 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
-	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
 )
 
 //go:embed config.txt
 var embeddedConfig embed.FS
 
-const externalConfigFile = "config.txt"
+// 进程退出码
+const (
+	exitOK             = 0
+	exitCmdFailed      = 1   // 有目录执行失败
+	exitUsage          = 2   // 参数错误
+	exitConfigError    = 3   // 配置解析失败
+	exitGroupNotFound  = 4   // 组不存在
+	exitAlreadyRunning = 5   // singleton=true 时同组的上一次运行仍在进行
+	exitDeadline       = 124 // 超过 max_run_time
+	exitCancelled      = 130 // 被 Ctrl-C 取消
+)
 
-// 命令组结构
-type Config struct {
-	Settings map[string]string
-	Groups   map[string][]string
+func main() {
+	os.Exit(run())
 }
 
-// 解析配置内容（从字符串）
-func parseConfig(content string) *Config {
-	cfg := &Config{
-		Settings: make(map[string]string),
-		Groups:   make(map[string][]string),
-	}
-
-	var currentGroup string
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+func run() int {
+	defer setupTracing()()
+	return dispatch(os.Args[1:])
+}
 
-		// 检测分组
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			currentGroup = strings.Trim(line, "[]")
-			if currentGroup != "settings" {
-				cfg.Groups[currentGroup] = []string{}
-			}
-			continue
+// 进度信息改到 stderr（toStderr），或在返回的 flush 调用前先缓存，flush 时写到此时的 logOut；
+// flush 之前 logOut 没有被改到别处时恢复为原来的输出
+func deferLogOutput(toStderr bool) (flush func()) {
+	if toStderr {
+		logOut = os.Stderr
+		return func() {}
+	}
+	prev, pending := logOut, &bytes.Buffer{}
+	logOut = pending
+	return func() {
+		if pending == nil {
+			return
 		}
-
-		// settings 配置
-		if currentGroup == "settings" {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				val := strings.TrimSpace(parts[1])
-				cfg.Settings[key] = val
-			}
-		} else if currentGroup != "" {
-			cfg.Groups[currentGroup] = append(cfg.Groups[currentGroup], line)
+		if logOut == io.Writer(pending) {
+			logOut = prev
 		}
+		_, _ = logOut.Write(pending.Bytes())
+		pending = nil
 	}
+}
 
-	return cfg
+// --output 中是否有 json，格式错误留到加载配置后报告
+func outputModeJSON(v string) bool {
+	modes, err := parseOutputModes(v)
+	return err == nil && modes.JSON
 }
 
-// 合并配置（外部覆盖默认）
-func mergeConfig(base, override *Config) *Config {
-	result := &Config{
-		Settings: make(map[string]string),
-		Groups:   make(map[string][]string),
-	}
+// runCmd exec 中临时命令所在的组名
+const adhocGroup = "exec"
+
+// runCmd run：在目录中执行组（链）
+func runRun(args []string) int {
+	return runTargets("run", args)
+}
 
-	// base
-	for k, v := range base.Settings {
-		result.Settings[k] = v
+// runCmd exec：不经过配置中的组，直接在目录中执行一条临时命令
+func runExec(args []string) int {
+	return runTargets("exec", args)
+}
+
+// run 与 exec 共用的执行流程，exec 的第一个参数是命令而不是组名
+func runTargets(name string, args []string) int {
+	adhoc := name == "exec"
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	addConfigFlag(fs)
+	jsonOutput := fs.Bool("json", false, "运行结束后在 stdout 输出 JSON 汇总（进度输出改到 stderr）")
+	output := fs.String("output", "", "输出模式，逗号分隔: stream（默认）、buffered、json、gha")
+	dryRun := fs.Bool("dry-run", false, "只打印每个目录将执行的脚本，不实际执行")
+	tuiMode := fs.Bool("tui", false, "以终端界面实时展示每个目录的状态")
+	watchMode := fs.Bool("watch", false, "执行后持续监听目录，文件变化时重新执行该目录")
+	noColor := fs.Bool("no-color", false, "禁用彩色输出")
+	failFast := fs.Bool("fail-fast", false, "任一目录失败后停止调度并终止其余目录")
+	recursive := fs.Bool("recursive", false, "把目录参数当作根目录，递归查找包含 --match 文件的目录")
+	match := fs.String("match", "", "递归扫描时的标记文件，如 go.mod，逗号分隔多个")
+	affected := fs.String("affected", "", "把目录参数当作仓库根目录，只在相对该提交（如 origin/main）有改动的子包中执行")
+	junitFile := fs.String("junit", "", "运行结束后把结果写成 JUnit XML 文件，每个目录一个用例")
+	eventsFormat := fs.String("events", "", "实时输出运行事件（run_started、dir_started、line、dir_finished、run_finished），目前只支持 ndjson")
+	eventsFile := fs.String("events-file", "-", "--events 的输出文件或命名管道，- 为 stdout（进度输出改到 stderr）")
+	aggregate := fs.Bool("aggregate", false, "不显示各目录的实时输出，结束后对比各目录的输出，标出与多数不同的目录")
+	assumeYes := fs.Bool("yes", false, "不询问，直接执行需要确认的组（confirm=true 或 protected_groups）")
+	interactive := fs.Bool("interactive", false, "目录失败后询问：重试、跳过、中止运行或在该目录打开 shell（需要在终端中运行）")
+	noCache := fs.Bool("no-cache", false, "忽略 cache 设置，全部重新执行")
+	pprofAddr := fs.String("pprof", "", "在该地址提供 net/http/pprof（如 :6060 或 localhost:6060），诊断运行器本身的性能")
+	debugStats := fs.Bool("debug-stats", false, "结束后打印运行器的统计：各阶段耗时、goroutine 数、调度等待和 GC")
+	bench := fs.Int("bench", 0, "基准测试：整批目录执行 N 轮，结束后统计每个目录的最短、中位、最长耗时和标准差（不使用结果缓存）")
+	filter := fs.String("filter", "", "先在每个目录执行该条件命令，失败的目录跳过（记为 SKIPPED）")
+	var gitSel gitFilter
+	fs.BoolVar(&gitSel.Dirty, "git-dirty", false, "只在有未提交改动的 git 目录中执行")
+	fs.StringVar(&gitSel.Branch, "git-branch", "", "只在当前分支匹配的 git 目录中执行，支持通配符如 release/*")
+	fs.StringVar(&gitSel.ChangedSince, "git-changed-since", "", "只在相对该提交（如 origin/main）有改动的目录中执行")
+	tagsFlag := fs.String("tags", "", "只在 [dirs] 清单中带任一标签的目录中执行，逗号分隔；不写目录参数时从清单全部目录中选")
+	excludeTags := fs.String("exclude-tags", "", "排除带任一标签的目录，逗号分隔")
+	hostsFlag := fs.String("hosts", "", "在 [hosts] 清单中选中的每台主机上通过 ssh 执行，目录参数为远程路径：tag=web、all 或主机名，逗号分隔")
+	var shuffle shuffleFlag
+	fs.Var(&shuffle, "shuffle", "随机打乱目录的调度顺序，--shuffle=SEED 按种子复现同样的顺序（种子会打印在日志中）")
+	priorityFile := fs.String("priority-file", "", "目录优先级文件，每行 目录 = 优先级，并发不足时优先级高的目录先执行")
+	resume := fs.Bool("resume", false, "只重新执行上次运行该组时失败、跳过或未完成的目录，写了目录参数时只在其中选")
+	fs.BoolVar(resume, "failed-only", false, "同 --resume")
+	stdinDirs := fs.Bool("stdin", false, "从 stdin 读取目录列表（每行一个），目录参数写 - 效果相同")
+	logLevelFlag := fs.String("log-level", "info", "进度信息的日志级别: debug、info、warn、error（命令输出不受影响）")
+	logFormatFlag := fs.String("log-format", logFormatConsole, "进度信息的格式: console、text、json")
+	fs.Var(&paramFlags, "p", "覆盖组参数 name=value（组头中声明的 [group name=default]），可重复")
+	fs.Func("concurrency", "最大并发数，同 -s concurrency=N", settingFlags.alias("concurrency"))
+	fs.Func("timeout", "每个目录的超时，同 -s timeout=D", settingFlags.alias("timeout"))
+	fs.Func("shell", "执行命令的 shell，同 -s shell=NAME", settingFlags.alias("shell"))
+	fs.BoolFunc("pty", "在伪终端中执行，终端输入直接交给命令（sudo、npm login 等）；只有一个目录时默认开启，--pty=false 关闭", settingFlags.alias("pty"))
+	fs.Func("grep", "终端只显示匹配该正则的输出行（日志文件仍记录全部），同 -s grep=RE", settingFlags.alias("grep"))
+	fs.Func("grep-v", "终端不显示匹配该正则的输出行，同 -s grep_v=RE", settingFlags.alias("grep_v"))
+	fs.Func("host-concurrency", "每台远程主机同时执行的目录数上限，同 -s host_concurrency=N", settingFlags.alias("host_concurrency"))
+	fs.Func("lock", "目录锁被其他 runCmd 进程占用时: off、wait、skip、fail，同 -s lock=MODE", settingFlags.alias("lock"))
+	fs.Usage = func() {
+		if adhoc {
+			fmt.Fprintln(fs.Output(), "用法: ./runCmd exec [flags] -- '<command>' <dir|glob|@dirset> ...")
+			fmt.Fprintln(fs.Output(), "命令按 shell 设置执行，超时、重试等使用 [settings] 中的全局设置")
+			fs.PrintDefaults()
+			return
+		}
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd run [flags] <group> <dir|glob|@dirset> ... [-- args...]")
+		fmt.Fprintln(fs.Output(), "-- 之后的参数作为脚本的 $1 $2 ...，也可从环境变量 RUNCMD_ARGS 读取")
+		fmt.Fprintln(fs.Output(), "组链写作 pull,build,test；省略 run 的旧写法 ./runCmd [flags] <group> <dir>... 仍然可用")
+		fs.PrintDefaults()
 	}
-	for g, cmds := range base.Groups {
-		result.Groups[g] = append([]string{}, cmds...)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
-
-	// override 覆盖
-	for k, v := range override.Settings {
-		result.Settings[k] = v
+	// -- 之后的参数原样交给脚本
+	positional, passArgs := fs.Args(), []string(nil)
+	if i := slices.Index(positional, "--"); i >= 0 {
+		positional, passArgs = positional[:i], positional[i+1:]
 	}
-	for g, cmds := range override.Groups {
-		result.Groups[g] = append([]string{}, cmds...)
+	byTags := *tagsFlag != "" || *excludeTags != ""
+	if len(positional) < 2 && !((*stdinDirs || byTags || *resume) && len(positional) == 1) {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := setupLogging(*logLevelFlag, *logFormatFlag); err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitUsage
 	}
 
-	return result
-}
-
-// 在目录执行命令组
-func runCmdsInDir(dir string, cmds []string, wg *sync.WaitGroup, worker chan struct{}) {
-	defer wg.Done()
-	worker <- struct{}{}
-	defer func() { <-worker }()
-
-	fmt.Printf(">>> 开始在目录 [%s] 执行命令...\n", dir)
-
-	script := strings.Join(cmds, "\n")
-	c := exec.Command("sh", "-c", script)
-	c.Dir = dir
+	group := positional[0]
+	if *recursive && *match == "" {
+		logger.Error("--recursive 需要配合 --match 指定标记文件")
+		return exitUsage
+	}
+	if *watchMode && *tuiMode {
+		logger.Error("--watch 暂不支持与 --tui 同时使用")
+		return exitUsage
+	}
+	if *interactive && (*tuiMode || *stdinDirs) {
+		logger.Error("--interactive 不能与 --tui 或 --stdin 同时使用")
+		return exitUsage
+	}
+	if *bench < 0 || *bench > 0 && (*tuiMode || *watchMode || *interactive) {
+		logger.Error("--bench 需要正整数，且不能与 --tui、--watch 或 --interactive 同时使用")
+		return exitUsage
+	}
 
-	// 合并 stdout 和 stderr
-	pipe, _ := c.StdoutPipe()
-	c.Stderr = c.Stdout
+	// --json 或 --events 写到 stdout 时 stdout 只留给结构化输出，加载配置前就把进度信息改到 stderr；
+	// output=json 写在配置中时，加载配置期间的提示先缓存，确定输出方式后再写出
+	eventsToStdout := *eventsFormat != "" && (*eventsFile == "" || *eventsFile == "-")
+	flush := deferLogOutput(*jsonOutput || eventsToStdout || outputModeJSON(*output))
+	defer flush()
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if adhoc {
+		cfg.Groups[adhocGroup] = []string{group}
+		delete(cfg.Options, adhocGroup)
+		delete(cfg.Env, adhocGroup)
+		cfg.Sources[adhocGroup] = "命令行"
+		group = adhocGroup
+	}
 
-	if err := c.Start(); err != nil {
-		fmt.Printf("[%s] 启动失败: %v\n", dir, err)
-		return
+	outputSetting := cfg.Settings["output"]
+	if *output != "" {
+		outputSetting = *output
+	}
+	modes, err := parseOutputModes(outputSetting)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitUsage
 	}
+	bufferedOutput, ghaOutput = modes.Buffered, modes.GHA
+	if bufferMemoryLimit, err = parseBufferMemory(cfg); err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	aggregateOutput = *aggregate
+	if *junitFile != "" {
+		outputTailLines = junitTailLines
+	}
+	if *jsonOutput || modes.JSON {
+		*jsonOutput = true
+		logOut = os.Stderr
+	}
+	if eventsToStdout {
+		if *jsonOutput {
+			logger.Error("--events 写到 stdout 时不能与 JSON 汇总同时使用，请用 --events-file 指定文件")
+			return exitUsage
+		}
+		logOut = os.Stderr
+	}
+	flush()
 
-	// 实时读取合并后的输出
-	scanner := bufio.NewScanner(pipe)
-	for scanner.Scan() {
-		fmt.Printf("[%s] %s\n", dir, scanner.Text())
+	// 支持 pull,build,test 形式的组链
+	names, err := cfg.resolveGroupChain(strings.Split(group, ","))
+	if errors.Is(err, errGroupNotFound) {
+		logger.Error(err.Error())
+		return exitGroupNotFound
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
 	}
 
-	if err := c.Wait(); err != nil {
-		fmt.Printf("[%s] 执行错误: %v\n", dir, err)
+	if err := cfg.applyParams(names, paramFlags); err != nil {
+		logger.Error(err.Error())
+		return exitUsage
 	}
-	fmt.Printf("<<< 完成目录 [%s] 的命令执行\n\n", dir)
-}
+	chain, concurrency, err := newRunChain(cfg, names)
+	if err == nil {
+		_, err = parseNotifyConfig(cfg.Notify)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	for _, opts := range chain {
+		opts.setArgs(passArgs)
+		if *filter != "" {
+			opts.When = append([]string{*filter}, opts.When...)
+		}
+	}
+	if len(names) > 1 {
+		logger.Info("组链: "+strings.Join(names, " -> "), "groups", names)
+	}
+	logger.Info(fmt.Sprintf("最大并发数: %d", concurrency), "concurrency", concurrency)
 
-func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("用法: ./runCmd <group> <dir1> <dir2> ...")
-		return
+	dirArgs, fromStdin, err := expandStdinArgs(positional[1:], *stdinDirs, os.Stdin)
+	if err == nil && fromStdin && *tuiMode {
+		err = errors.New("从 stdin 读取目录时不能使用 --tui")
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitUsage
 	}
+	var dirs []string
+	if *hostsFlag != "" {
+		var hosts []string
+		if hosts, err = selectHosts(cfg, *hostsFlag); err == nil {
+			dirs, err = fleetDirs(hosts, dirArgs)
+		}
+		if err == nil {
+			logger.Info(fmt.Sprintf("目标主机数: %d", len(hosts)), "hosts", hosts)
+		}
+	} else {
+		dirs, err = resolveTargetDirs(cfg, dirArgs, *recursive, *match)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitUsage
+	}
+	if *resume {
+		prev, last, err := resumeDirs(cfg, strings.Join(names, ","))
+		if err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+		if len(dirArgs) > 0 {
+			keep := make(map[string]bool, len(dirs))
+			for _, d := range dirs {
+				keep[filepath.Clean(d)] = true
+			}
+			prev = slices.DeleteFunc(prev, func(d string) bool { return !keep[filepath.Clean(d)] })
+		}
+		logger.Info(fmt.Sprintf("从运行 #%d 恢复: %d / %d 个目录需要重新执行", last.ID, len(prev), len(last.Dirs)), "run", last.ID, "dirs", len(prev))
+		if len(prev) == 0 {
+			return exitOK
+		}
+		dirs = prev
+	}
+	if byTags {
+		dirs = selectByTags(cfg, dirs, splitTags(*tagsFlag), splitTags(*excludeTags))
+	}
+	if *affected != "" {
+		pkgs := dirs
+		if !*recursive {
+			markers := defaultPackageMarkers
+			if *match != "" {
+				markers = *match
+			}
+			if pkgs, err = scanDirs(dirs, markers); err != nil {
+				logger.Error(err.Error())
+				return exitUsage
+			}
+		}
+		if dirs, err = affectedPackages(context.Background(), pkgs, *affected); err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+		logger.Info(fmt.Sprintf("相对 %s 有改动的子包: %d / %d", *affected, len(dirs), len(pkgs)), "dirs", len(dirs), "packages", len(pkgs))
+		if len(dirs) == 0 {
+			return exitOK
+		}
+	}
+	if gitSel.active() {
+		total := len(dirs)
+		if dirs, err = filterGitDirs(context.Background(), dirs, gitSel); err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+		logger.Info(fmt.Sprintf("按 git 状态筛选: %d / %d 个目录符合条件", len(dirs), total), "dirs", len(dirs), "candidates", total)
+		if len(dirs) == 0 {
+			return exitOK
+		}
+	}
+	if len(dirs) == 0 {
+		logger.Error("没有找到需要执行的目录")
+		return exitUsage
+	}
+	logger.Info(fmt.Sprintf("目标目录数: %d", len(dirs)), "dirs", len(dirs))
+	targets := newTargets(dirs)
+	if err = applyHosts(cfg, targets); err == nil {
+		err = assignWeights(cfg, names, targets, concurrency)
+	}
+	if err == nil {
+		err = assignDepends(cfg, targets)
+	}
+	if err == nil && *priorityFile != "" {
+		err = cfg.loadPriorityFile(*priorityFile)
+	}
+	if err == nil {
+		err = assignPriority(cfg, targets)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	// text/json 日志给脚本解析，不带颜色
+	setupColor(*noColor || logFormat != logFormatConsole, logOut)
+	assignDirColors(targets)
 
-	group := os.Args[1]
-	dirs := os.Args[2:]
+	if *dryRun {
+		printDryRun(targets, chain)
+		return exitOK
+	}
+	if err := checkChainLimits(chain, targets); err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
 
-	// 先加载内嵌配置
-	data, _ := embeddedConfig.ReadFile("config.txt")
-	cfg := parseConfig(string(data))
+	var events *eventStream
+	if *eventsFormat != "" {
+		if events, err = openEventStream(*eventsFormat, *eventsFile); err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+		defer events.Close()
+		onEvent(events.onEvent)
+	}
+	if resultCacheStore, err = openResultCache(cfg, chain, *noCache || *bench > 0); err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	ptyMode, err := parsePTYSetting(cfg.Settings["pty"])
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if ptyMode == ptyOn || (ptyMode == ptyAuto && len(targets) == 1 && !targets[0].remote()) {
+		switch {
+		case !ptyAvailable() || bufferedOutput || *jsonOutput || *tuiMode || *aggregate || events != nil || fromStdin:
+			if ptyMode == ptyOn {
+				logger.Warn("stdin/stdout 不是终端或使用了 buffered/json/--tui/--events 输出，不使用伪终端")
+			}
+		default:
+			for _, opts := range chain {
+				reason := opts.ptyBlocker()
+				opts.PTY = reason == ""
+				if reason != "" && ptyMode == ptyOn {
+					logger.Warn(fmt.Sprintf("组 [%s] 使用了 %s，不使用伪终端", opts.Group, reason), "group", opts.Group)
+				}
+			}
+			if len(targets) > 1 {
+				logger.Info("伪终端模式下逐个目录执行")
+				concurrency = 1
+			}
+			if *interactive {
+				logger.Warn("伪终端模式下不支持 --interactive，已忽略")
+				*interactive = false
+			}
+		}
+	}
+	protected, err := protectedGroups(cfg, names)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if len(protected) > 0 && !*assumeYes {
+		if fromStdin || !isTerminal(os.Stdin) {
+			logger.Error(fmt.Sprintf("组 [%s] 需要确认，非交互环境请加 --yes", strings.Join(protected, ", ")))
+			return exitUsage
+		}
+		if !confirmRun(os.Stdin, logOut, targets, chain, protected) {
+			fmt.Fprintln(logOut, "已取消")
+			return exitCancelled
+		}
+	}
+	if !*failFast {
+		if *failFast, err = chainFailFast(cfg, names); err != nil {
+			logger.Error(err.Error())
+			return exitConfigError
+		}
+	}
 
-	// 如果存在外部 config.txt，覆盖
-	if ext, err := os.ReadFile(externalConfigFile); err == nil {
-		fmt.Printf("检测到外部配置 %s，将覆盖默认配置\n", externalConfigFile)
-		override := parseConfig(string(ext))
-		cfg = mergeConfig(cfg, override)
+	// Ctrl-C / SIGTERM 时取消整个运行
+	sigCtx, stop := interruptContext(context.Background())
+	defer stop()
+	ctx, cancel := context.WithCancelCause(sigCtx)
+	defer cancel(nil)
+	if *interactive {
+		if isTerminal(os.Stdin) {
+			failurePrompter = newFailurePrompt(os.Stdin, consoleWriter{}, cancel)
+		} else {
+			logger.Warn("stdin 不是终端，忽略 --interactive")
+		}
+	}
+	maxRunTime, err := parseMaxRunTime(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if maxRunTime > 0 {
+		var stopDeadline context.CancelFunc
+		ctx, stopDeadline = context.WithTimeoutCause(ctx, maxRunTime, errMaxRunTime)
+		defer stopDeadline()
 	}
 
-	cmds, ok := cfg.Groups[group]
-	if !ok {
-		fmt.Printf("未找到组 [%s] 的命令，请检查配置\n", group)
-		return
+	if single, wait, err := chainSingleton(cfg, names); err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	} else if single {
+		unlock, err := acquireSingleton(sigCtx, cfg, names, wait)
+		if err != nil {
+			logger.Error(err.Error())
+			if sigCtx.Err() != nil {
+				return exitCancelled
+			}
+			return exitAlreadyRunning
+		}
+		defer unlock()
+	}
+	if *pprofAddr != "" {
+		if err := startPprof(*pprofAddr); err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+	}
+	if activeHooks, err = newHookSet(cfg); err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if err := activeHooks.runGlobal(ctx, "pre_run", "GROUP", strings.Join(names, ",")); err != nil {
+		logger.Error(err.Error())
+		return exitCmdFailed
+	}
+	if events != nil {
+		events.runStarted(strings.Join(names, ","), targets)
+	}
+	if *watchMode {
+		wopts, err := newWatchOptions(cfg)
+		if err != nil {
+			logger.Error(err.Error())
+			return exitConfigError
+		}
+		if err := watchTargets(ctx, targets, chain, semaphore.NewWeighted(int64(concurrency)), wopts); err != nil {
+			logger.Error(err.Error())
+			return exitUsage
+		}
+		if errors.Is(context.Cause(ctx), errMaxRunTime) {
+			return exitDeadline
+		}
+		return exitCancelled
 	}
 
-	// 并发控制，默认 3
-	concurrency := 3
-	if v, ok := cfg.Settings["concurrency"]; ok {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			concurrency = n
+	if *debugStats {
+		runDiagnostics = startDiagnostics()
+	}
+	runStart := time.Now()
+	ctx, runSpan := startRunSpan(ctx, strings.Join(names, ","), len(targets))
+	b := newBatch(targets, chain, concurrency, *failFast)
+	if b.order, err = scheduleTargets(cfg, names, targets); err == nil {
+		b.throttle, err = newLoadThrottle(cfg, names)
+	}
+	if err == nil {
+		b.failures, err = parseFailureLimit(cfg)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfigError
+	}
+	if shuffle.on {
+		b.order = shuffleTargets(b.order, shuffle.seed)
+		logger.Info(fmt.Sprintf("随机调度顺序，种子 %d（--shuffle=%d 可复现）", shuffle.seed, shuffle.seed), "phase", "schedule", "seed", shuffle.seed)
+	}
+	var rounds [][]*dirResult
+	var walls []time.Duration
+	if *tuiMode {
+		// TUI 接管终端，运行期间的文本输出丢弃，结束后再打印汇总
+		out, colored := logOut, colorEnabled
+		logOut, colorEnabled = io.Discard, true
+		err := runTUI(strings.Join(names, ","), targets, func() { cancel(errUserCancelled) }, func() { b.start(ctx, cancel) }, b.wait)
+		logOut, colorEnabled = out, colored
+		if err != nil {
+			logger.Error(fmt.Sprintf("TUI 运行失败: %v", err))
 		}
+	} else if *bench > 0 {
+		rounds, walls = runBench(ctx, cancel, b, concurrency, *bench)
+	} else {
+		b.start(ctx, cancel)
+		b.wait()
+	}
+	results := b.results()
+	if len(rounds) > 0 {
+		// 汇总、历史和通知使用最后一轮的结果
+		results = rounds[len(rounds)-1]
 	}
-	fmt.Printf("最大并发数: %d\n", concurrency)
 
-	worker := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
+	printSummaryTable(logOut, results)
+	if *aggregate {
+		printAggregate(logOut, targets, results)
+	}
+	if len(rounds) > 0 {
+		printBenchReport(logOut, targets, rounds, walls)
+	}
+	runDiagnostics.print(logOut)
+	if ctx.Err() != nil {
+		printCancelSummary(results, context.Cause(ctx))
+	}
+	failed := failedDirs(results)
+	// 基准测试中任一轮失败的目录都算失败
+	for _, round := range rounds {
+		for _, dir := range failedDirs(round) {
+			if !slices.Contains(failed, dir) {
+				failed = append(failed, dir)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(logOut, "执行失败的目录 (%d): %s\n", len(failed), strings.Join(failed, ", "))
+	}
+	elapsed := time.Since(runStart)
+	if *jsonOutput {
+		if err := writeJSONReport(os.Stdout, strings.Join(names, ","), results, elapsed); err != nil {
+			logger.Error(fmt.Sprintf("输出 JSON 汇总失败: %v", err))
+		}
+	}
+	if *junitFile != "" {
+		if err := writeJUnitReport(*junitFile, strings.Join(names, ","), results, runStart, elapsed); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+	rep := newJSONReport(strings.Join(names, ","), results, elapsed)
+	endRunSpan(runSpan, rep)
+	recordHistory(cfg, dirs, runStart, rep)
+	sendNotifications(context.Background(), cfg, rep)
+	var failedAll []string
+	for _, r := range results {
+		if !r.succeeded() && !slices.Contains(failedAll, r.Dir) {
+			failedAll = append(failedAll, r.Dir)
+		}
+	}
+	if events != nil {
+		events.runFinished(rep, failedAll)
+	}
+	if err := activeHooks.runGlobal(context.Background(), "post_run", "GROUP", rep.Group,
+		"STATUS", runStatusText(rep.OK), "DURATION", seconds(elapsed), "FAILED", strings.Join(failedAll, ",")); err != nil {
+		logger.Warn(err.Error(), "phase", "hook")
+	}
 
-	for _, dir := range dirs {
-		wg.Add(1)
-		go runCmdsInDir(dir, cmds, &wg, worker)
+	switch {
+	case sigCtx.Err() != nil || errors.Is(context.Cause(ctx), errUserCancelled):
+		return exitCancelled
+	case errors.Is(context.Cause(ctx), errMaxRunTime):
+		return exitDeadline
+	case len(failed) > 0:
+		return exitCmdFailed
 	}
-	wg.Wait()
+	return exitOK
 }
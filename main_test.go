@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 在 dir 中执行 runCmd run，返回 stdout、stderr 和退出码
+func runCLI(t *testing.T, dir string, args ...string) (string, string, int) {
+	t.Helper()
+	t.Chdir(dir)
+	stdout, stderr := captureFile(t), captureFile(t)
+	origOut, origErr, origLog := os.Stdout, os.Stderr, logOut
+	os.Stdout, os.Stderr, logOut = stdout.w, stderr.w, stdout.w
+	code := runRun(args)
+	os.Stdout, os.Stderr, logOut = origOut, origErr, origLog
+	return stdout.close(), stderr.close(), code
+}
+
+type capture struct {
+	w    *os.File
+	done chan string
+}
+
+func captureFile(t *testing.T) *capture {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &capture{w: w, done: make(chan string)}
+	go func() {
+		data, _ := io.ReadAll(r)
+		r.Close()
+		c.done <- string(data)
+	}()
+	return c
+}
+
+func (c *capture) close() string {
+	c.w.Close()
+	return <-c.done
+}
+
+// 在临时目录中写入配置和目录 a
+func cliWorkdir(t *testing.T, config string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.txt"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestJSONOutputKeepsStdoutClean(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+	}{
+		{name: "--json", config: "[g]\necho hi\n", args: []string{"--json", "g", "a"}},
+		{name: "--output=json", config: "[g]\necho hi\n", args: []string{"--output=json", "g", "a"}},
+		{name: "配置中的 output=json", config: "[settings]\noutput = json\n[g]\necho hi\n", args: []string{"g", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runCLI(t, cliWorkdir(t, "[settings]\nshell = sh\n"+tt.config), tt.args...)
+			if code != exitOK {
+				t.Fatalf("exit = %d, stderr:\n%s", code, stderr)
+			}
+			var report struct {
+				Group string `json:"group"`
+				OK    bool   `json:"ok"`
+			}
+			if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+				t.Fatalf("stdout 不是 JSON: %v\n%s", err, stdout)
+			}
+			if report.Group != "g" || !report.OK {
+				t.Errorf("report = %+v", report)
+			}
+			if !strings.Contains(stderr, "检测到外部配置") {
+				t.Errorf("加载配置的提示应写到 stderr:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestEventsKeepStdoutClean(t *testing.T) {
+	stdout, stderr, code := runCLI(t, cliWorkdir(t, "[settings]\nshell = sh\n[g]\necho hi\n"), "--events", "ndjson", "g", "a")
+	if code != exitOK {
+		t.Fatalf("exit = %d, stderr:\n%s", code, stderr)
+	}
+	var kinds []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var ev struct {
+			Kind string `json:"event"`
+		}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("stdout 中有非 JSON 的行 %q: %v", line, err)
+		}
+		kinds = append(kinds, ev.Kind)
+	}
+	if len(kinds) == 0 || kinds[0] != "run_started" || kinds[len(kinds)-1] != "run_finished" {
+		t.Errorf("events = %q", kinds)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 遮盖后的替换文本
+const maskReplacement = "***"
+
+// 长度小于该值的环境变量值不遮盖，避免把 1、on 之类的常见片段全部替换掉
+const minMaskedValueLen = 3
+
+// mask 设置：逗号分隔，/.../ 为正则，其余为环境变量名（支持 * 通配），如
+//
+//	mask=TOKEN,*_PASSWORD,/ghp_[A-Za-z0-9]+/
+type maskSpec struct {
+	envNames []string
+	regexps  []*regexp.Regexp
+	values   []string // 总是遮盖的值，如 secret:// 读到的密钥
+}
+
+// 在 s 的基础上总是遮盖 values，s 为 nil 时新建
+func (s *maskSpec) withValues(values []string) *maskSpec {
+	if len(values) == 0 {
+		return s
+	}
+	spec := &maskSpec{}
+	if s != nil {
+		*spec = *s
+	}
+	spec.values = append(append([]string{}, spec.values...), values...)
+	return spec
+}
+
+func parseMaskSetting(v string) (*maskSpec, error) {
+	spec := &maskSpec{}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+		case len(item) > 1 && strings.HasPrefix(item, "/") && strings.HasSuffix(item, "/"):
+			re, err := regexp.Compile(item[1 : len(item)-1])
+			if err != nil {
+				return nil, fmt.Errorf("无效的 mask 正则 %q: %w", item, err)
+			}
+			spec.regexps = append(spec.regexps, re)
+		default:
+			if _, err := path.Match(item, ""); err != nil {
+				return nil, fmt.Errorf("无效的 mask 变量名 %q: %w", item, err)
+			}
+			spec.envNames = append(spec.envNames, item)
+		}
+	}
+	if len(spec.envNames) == 0 && len(spec.regexps) == 0 {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// 输出遮盖器，nil 表示不遮盖
+type masker struct {
+	values  []string
+	regexps []*regexp.Regexp
+}
+
+// 按子进程的环境生成遮盖器，匹配到的变量值会被遮盖
+func (s *maskSpec) forEnv(env []string) *masker {
+	if s == nil {
+		return nil
+	}
+	m := &masker{regexps: s.regexps}
+	seen := make(map[string]bool)
+	for _, v := range s.values {
+		if v != "" && !seen[v] {
+			m.values = append(m.values, v)
+			seen[v] = true
+		}
+	}
+	for _, kv := range env {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || len(v) < minMaskedValueLen || seen[v] {
+			continue
+		}
+		for _, name := range s.envNames {
+			if matched, _ := path.Match(name, k); matched {
+				m.values = append(m.values, v)
+				seen[v] = true
+				break
+			}
+		}
+	}
+	// 长的值先替换，避免其中包含的短值先被替换后长值匹配不上
+	sort.Slice(m.values, func(i, j int) bool { return len(m.values[i]) > len(m.values[j]) })
+	return m
+}
+
+func (m *masker) apply(line string) string {
+	if m == nil {
+		return line
+	}
+	for _, v := range m.values {
+		line = strings.ReplaceAll(line, v, maskReplacement)
+	}
+	for _, re := range m.regexps {
+		line = re.ReplaceAllString(line, maskReplacement)
+	}
+	return line
+}
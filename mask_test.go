@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestMasker(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		values  []string
+		env     []string
+		line    string
+		want    string
+	}{
+		{
+			name:    "按变量名",
+			setting: "TOKEN",
+			env:     []string{"TOKEN=abc123", "OTHER=abc"},
+			line:    "token=abc123 other=abc",
+			want:    "token=*** other=abc",
+		},
+		{
+			name:    "通配符",
+			setting: "*_PASSWORD",
+			env:     []string{"DB_PASSWORD=hunter2", "PASSWORD_HINT=pet"},
+			line:    "hunter2 pet",
+			want:    "*** pet",
+		},
+		{
+			name:    "过短的值不遮盖",
+			setting: "DEBUG",
+			env:     []string{"DEBUG=on"},
+			line:    "logging on",
+			want:    "logging on",
+		},
+		{
+			name:    "正则",
+			setting: "/ghp_[A-Za-z0-9]+/",
+			line:    "push with ghp_AbC123 done",
+			want:    "push with *** done",
+		},
+		{
+			name:    "长的值先替换",
+			setting: "A,B",
+			env:     []string{"A=secret", "B=secret-long"},
+			line:    "secret-long secret",
+			want:    "*** ***",
+		},
+		{
+			name:   "没有 mask 设置时仍遮盖密钥",
+			values: []string{"s3cr3t", "no"},
+			env:    []string{"X=s3cr3t"},
+			line:   "s3cr3t no",
+			want:   "*** ***",
+		},
+		{
+			name: "不遮盖",
+			env:  []string{"TOKEN=abc123"},
+			line: "abc123",
+			want: "abc123",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseMaskSetting(tt.setting)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := spec.withValues(tt.values).forEnv(tt.env)
+			if got := m.apply(tt.line); got != tt.want {
+				t.Errorf("apply(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMaskSettingErrors(t *testing.T) {
+	for _, v := range []string{"/[a-/", "TOKEN[", "TOKEN,/(/"} {
+		if _, err := parseMaskSetting(v); err == nil {
+			t.Errorf("parseMaskSetting(%q) 应报错", v)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 组在单个目录中执行耗时的直方图分桶（秒），从 1 秒到约 1 小时
+var durationBuckets = prometheus.ExponentialBuckets(1, 2.5, 10)
+
+// serve 模式下 /metrics 暴露的 Prometheus 指标
+type serverMetrics struct {
+	registry        *prometheus.Registry
+	runsStarted     *prometheus.CounterVec
+	runsFailed      *prometheus.CounterVec
+	runDuration     *prometheus.HistogramVec
+	dirResults      *prometheus.CounterVec
+	groupDuration   *prometheus.HistogramVec
+	dirLastDuration *prometheus.GaugeVec
+	dirLastSuccess  *prometheus.GaugeVec
+	running         prometheus.Gauge
+}
+
+func newServerMetrics(s *server) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		runsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "runcmd_runs_started_total", Help: "开始执行的运行数",
+		}, []string{"group"}),
+		runsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "runcmd_runs_failed_total", Help: "未全部成功的运行数（含取消和配置错误）",
+		}, []string{"group"}),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "runcmd_run_duration_seconds", Help: "整个运行的耗时", Buckets: durationBuckets,
+		}, []string{"group"}),
+		dirResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "runcmd_dir_results_total", Help: "各组在目录中的执行结果数",
+		}, []string{"group", "status"}),
+		groupDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "runcmd_group_duration_seconds", Help: "组在单个目录中的执行耗时", Buckets: durationBuckets,
+		}, []string{"group"}),
+		dirLastDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "runcmd_dir_last_duration_seconds", Help: "目录最近一次执行该组的耗时",
+		}, []string{"dir", "group"}),
+		dirLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "runcmd_dir_last_success", Help: "目录最近一次执行该组是否成功（1 成功，0 失败）",
+		}, []string{"dir", "group"}),
+		running: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "runcmd_workers_running", Help: "正在执行的目录数",
+		}),
+	}
+	queued := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "runcmd_runs_queued", Help: "排队等待执行的运行数",
+	}, func() float64 { return float64(len(s.queue)) })
+	m.registry.MustRegister(m.runsStarted, m.runsFailed, m.runDuration, m.dirResults,
+		m.groupDuration, m.dirLastDuration, m.dirLastSuccess, m.running, queued)
+	return m
+}
+
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// 根据运行事件更新目录级指标；跳过的目录没有开始执行，不计入
+func (m *serverMetrics) observe(ev runEvent) {
+	switch ev.Kind {
+	case eventDirStarted:
+		m.running.Inc()
+	case eventDirFinished:
+		res := ev.Result
+		m.dirResults.WithLabelValues(ev.Group, res.Status).Inc()
+		if res.Status == statusSkipped || res.Status == statusCached {
+			return
+		}
+		m.running.Dec()
+		m.groupDuration.WithLabelValues(ev.Group).Observe(res.Duration.Seconds())
+		m.dirLastDuration.WithLabelValues(ev.Dir, ev.Group).Set(res.Duration.Seconds())
+		success := 0.0
+		if okStatus(res.Status) {
+			success = 1
+		}
+		m.dirLastSuccess.WithLabelValues(ev.Dir, ev.Group).Set(success)
+	}
+}
+
+// 记录一次运行的结束
+func (m *serverMetrics) runFinished(group string, status string, rep *jsonReport) {
+	if rep != nil {
+		m.runDuration.WithLabelValues(group).Observe(msDuration(rep.DurationMs).Seconds())
+	}
+	if status != runFinished || rep == nil || !rep.OK {
+		m.runsFailed.WithLabelValues(group).Inc()
+	}
+}
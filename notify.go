@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 单个通知请求的超时
+const notifyTimeout = 10 * time.Second
+
+// [notify] 配置：
+//
+//	webhook=https://example.com/hook   # POST JSON 汇总，多个地址用逗号分隔
+//	slack=https://hooks.slack.com/...  # Slack Incoming Webhook 格式
+//	on=failure                         # always（默认）或 failure
+type notifyConfig struct {
+	Webhooks  []string
+	Slack     []string
+	OnFailure bool
+}
+
+func parseNotifyConfig(m map[string]string) (notifyConfig, error) {
+	var nc notifyConfig
+	split := func(v string) []string {
+		var out []string
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				out = append(out, u)
+			}
+		}
+		return out
+	}
+	nc.Webhooks = split(m["webhook"])
+	nc.Slack = split(m["slack"])
+	switch v := strings.TrimSpace(m["on"]); v {
+	case "", "always":
+	case "failure":
+		nc.OnFailure = true
+	default:
+		return nc, fmt.Errorf("无效的 notify on 配置 %q，可选 always、failure", v)
+	}
+	return nc, nil
+}
+
+func (nc notifyConfig) empty() bool {
+	return len(nc.Webhooks) == 0 && len(nc.Slack) == 0
+}
+
+// 运行结束后按 [notify] 配置发送通知，发送失败只打印警告
+func sendNotifications(ctx context.Context, cfg *Config, rep jsonReport) {
+	nc, err := parseNotifyConfig(cfg.Notify)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	if nc.empty() || (nc.OnFailure && rep.OK) {
+		return
+	}
+
+	generic, _ := json.Marshal(rep)
+	slack, _ := json.Marshal(map[string]string{"text": slackSummary(rep)})
+	for _, u := range nc.Webhooks {
+		if err := postJSON(ctx, u, generic); err != nil {
+			logger.Warn(fmt.Sprintf("发送通知到 %s 失败: %v", u, err), "phase", "notify", "error", err)
+		}
+	}
+	for _, u := range nc.Slack {
+		if err := postJSON(ctx, u, slack); err != nil {
+			logger.Warn(fmt.Sprintf("发送 Slack 通知到 %s 失败: %v", u, err), "phase", "notify", "error", err)
+		}
+	}
+}
+
+func postJSON(ctx context.Context, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// Slack 消息文本：总体结果加上失败目录及各自耗时
+func slackSummary(rep jsonReport) string {
+	var failed []jsonDirReport
+	for _, r := range rep.Results {
+		if !okStatus(r.Status) {
+			failed = append(failed, r)
+		}
+	}
+	elapsed := (time.Duration(rep.DurationMs) * time.Millisecond).Round(100 * time.Millisecond)
+	var b strings.Builder
+	if rep.OK {
+		fmt.Fprintf(&b, ":white_check_mark: runCmd [%s] 全部成功，%d 个目录，耗时 %s", rep.Group, len(rep.Results), elapsed)
+		return b.String()
+	}
+	fmt.Fprintf(&b, ":x: runCmd [%s] 有 %d/%d 个目录未成功，耗时 %s", rep.Group, len(failed), len(rep.Results), elapsed)
+	for _, r := range failed {
+		fmt.Fprintf(&b, "\n• `%s` [%s] %s (%s)", r.Dir, r.Group, r.Status, time.Duration(r.DurationMs)*time.Millisecond)
+	}
+	return b.String()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timestamps 设置的取值
+const (
+	timestampsWall    = "wall"    // 墙上时间，如 15:04:05.000
+	timestampsElapsed = "elapsed" // 相对目录开始执行的时间，如 +12.345s
+)
+
+// 终端输出（logOut）的汇合点：各目录的输出行、进度日志和缓冲块都在这把锁下一次写出，
+// 并发目录的输出不会交错成半行，缓冲块之间也不会相互穿插
+var outputMu sync.Mutex
+
+// 经过 outputMu 写到当前的 logOut（JSON 模式、TUI 和 serve 中会被替换）
+type consoleWriter struct{}
+
+func (consoleWriter) Write(p []byte) (int, error) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	return logOut.Write(p)
+}
+
+// 拼接输出行的缓冲池，避免每行 Fprintf 的格式化和分配
+var linePool = sync.Pool{New: func() any {
+	b := make([]byte, 0, 256)
+	return &b
+}}
+
+// 超过该大小的行缓冲不放回池中
+const maxPooledLine = 64 << 10
+
+// 并发安全的缓冲区，parallel 步骤会同时写入；超过 buffer_memory 后转存到临时文件
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf spillBuffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// 把缓冲的输出整段写出
+func (t *target) flush() {
+	if t.buf == nil {
+		return
+	}
+	t.buf.mu.Lock()
+	defer t.buf.mu.Unlock()
+	defer t.buf.buf.Close()
+
+	waiting := time.Now()
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	runDiagnostics.observe("flush_wait", waiting)
+	if ghaOutput {
+		fmt.Fprintf(logOut, "::group::%s\n", ghaEscape(t.Dir))
+		_, _ = t.buf.buf.WriteTo(logOut)
+		fmt.Fprintln(logOut, "::endgroup::")
+		_, _ = io.WriteString(logOut, t.annotations)
+		return
+	}
+	_, _ = t.buf.buf.WriteTo(logOut)
+}
+
+// GitHub Actions 工作流命令中需要转义的字符
+var ghaReplacer = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+var ghaPropertyReplacer = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+func ghaEscape(s string) string {
+	return ghaReplacer.Replace(s)
+}
+
+// 失败的组对应的 ::error:: 注解，折叠组之后输出，显示在运行摘要中
+func ghaAnnotations(results []*dirResult) string {
+	var b strings.Builder
+	for _, r := range results {
+		if !r.failed() {
+			continue
+		}
+		msg := r.Status
+		if r.Err != nil {
+			msg += ": " + r.Err.Error()
+		}
+		fmt.Fprintf(&b, "::error title=%s::%s\n", ghaPropertyReplacer.Replace(fmt.Sprintf("%s [%s]", r.Dir, r.Group)), ghaEscape(msg))
+	}
+	return b.String()
+}
+
+// 一个组在目录中已输出的行数和字节数
+type outputLimit struct {
+	lines, bytes, suppressed atomic.Int64
+}
+
+func (o *outputLimit) reset() {
+	o.lines.Store(0)
+	o.bytes.Store(0)
+	o.suppressed.Store(0)
+}
+
+// 记入一行输出，超过 max_output_lines / max_output_bytes 时 show 为 false，first 表示这是第一行被省略的输出
+func (o *outputLimit) admit(n int, opts *runOptions) (show, first bool) {
+	lines, bytes := o.lines.Add(1), o.bytes.Add(int64(n)+1)
+	if (opts.MaxOutputLines > 0 && lines > opts.MaxOutputLines) || (opts.MaxOutputBytes > 0 && bytes > opts.MaxOutputBytes) {
+		return false, o.suppressed.Add(1) == 1
+	}
+	return true, false
+}
+
+// 是否通过 grep / grep_v 过滤
+func (opts *runOptions) lineVisible(line string) bool {
+	return (opts.Grep == nil || opts.Grep.MatchString(line)) && (opts.GrepV == nil || !opts.GrepV.MatchString(line))
+}
+
+// 输出一行命令输出到终端、日志和事件订阅者；被 grep 过滤或超过输出上限的行只写日志文件
+func (t *target) writeLine(label, line string, isErr bool, opts *runOptions) {
+	var tag, logTag string
+	if step := strings.TrimPrefix(label, t.Dir); step != "" {
+		logTag = "[" + step + "] "
+	}
+	log := t.log
+	if isErr {
+		tag = colorize("31", "[err]")
+		if t.errLog != nil {
+			log = t.errLog
+		} else {
+			logTag += "[err] "
+		}
+	}
+	if outputTailLines > 0 {
+		t.tail.add(line, outputTailLines)
+	}
+	if len(opts.Expect) > 0 {
+		t.expects.observe(line, opts)
+	}
+	if aggregateOutput {
+		t.captured.add(line)
+		log.printf("%s%s", logTag, line)
+		return
+	}
+	show, first := false, false
+	if opts.lineVisible(line) {
+		show, first = t.output.admit(len(line), opts)
+	}
+	if show {
+		bp := linePool.Get().(*[]byte)
+		b := append((*bp)[:0], prefix(label)...)
+		b = append(append(b, tag...), ' ')
+		b = append(append(b, t.timestamp(opts.Timestamps)...), line...)
+		b = append(b, '\n')
+		_, _ = t.w().Write(b)
+		if cap(b) <= maxPooledLine {
+			*bp = b
+			linePool.Put(bp)
+		}
+	} else if first {
+		fmt.Fprintf(t.w(), "%s … 输出超过上限，后续输出不再显示\n", prefix(t.Dir))
+	}
+	log.printf("%s%s", logTag, line)
+	if show {
+		emit(runEvent{Kind: eventLine, Dir: t.Dir, Group: opts.Group, Line: line, Stderr: isErr})
+	}
+}
+
+// 按行读取输出，超过 max 字节的行按 max 拆成多行，不会像 bufio.Scanner 那样丢弃
+func readLines(r io.Reader, max int, fn func(line string)) error {
+	br := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		for len(line) > max {
+			fn(string(line[:max]))
+			line = append(line[:0], line[max:]...)
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF:
+			if len(line) > 0 {
+				fn(string(line))
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		fn(string(line))
+		line = line[:0]
+	}
+}
+
+// 解析 timestamps 设置：true/wall 为墙上时间，elapsed 为相对时间，false 关闭
+func parseTimestampsSetting(v string) (string, error) {
+	switch v = strings.TrimSpace(v); v {
+	case timestampsWall, timestampsElapsed:
+		return v, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return "", fmt.Errorf("无效的 timestamps 配置 %q，可选 true、false、wall、elapsed", v)
+	}
+	if on {
+		return timestampsWall, nil
+	}
+	return "", nil
+}
+
+// 输出行的时间前缀，未开启时为空
+func (t *target) timestamp(mode string) string {
+	switch mode {
+	case timestampsWall:
+		return time.Now().Format("15:04:05.000") + " "
+	case timestampsElapsed:
+		return fmt.Sprintf("+%.3fs ", time.Since(t.start).Seconds())
+	}
+	return ""
+}
+
+// output 设置/参数中开启的模式
+type outputModes struct {
+	Buffered bool // 每个目录结束后整段输出
+	JSON     bool // 结束后在 stdout 输出 JSON 汇总
+	GHA      bool // GitHub Actions：每个目录的输出折叠为一组，失败时输出 ::error:: 注解（隐含 buffered）
+}
+
+// 解析 output 设置/参数，逗号分隔：stream（默认）、buffered、json、gha
+func parseOutputModes(v string) (outputModes, error) {
+	var m outputModes
+	for _, mode := range strings.Split(v, ",") {
+		switch strings.TrimSpace(mode) {
+		case "", "stream":
+		case "buffered":
+			m.Buffered = true
+		case "json":
+			m.JSON = true
+		case "gha":
+			m.Buffered, m.GHA = true, true
+		default:
+			return m, fmt.Errorf("无效的 output 配置 %q，可选 stream、buffered、json、gha", mode)
+		}
+	}
+	return m, nil
+}
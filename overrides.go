@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 命令行覆盖的设置，按出现顺序应用；优先级高于外部配置和内嵌配置中的同名设置与组头选项
+type settingOverrides [][2]string
+
+var settingFlags settingOverrides
+
+func (s *settingOverrides) String() string {
+	var kv []string
+	for _, o := range *s {
+		kv = append(kv, o[0]+"="+o[1])
+	}
+	return strings.Join(kv, " ")
+}
+
+// 解析 -s key=value，key 可写作 key.group 只覆盖某个组
+func (s *settingOverrides) Set(v string) error {
+	key, val, ok := strings.Cut(v, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("设置覆盖应写作 key=value: %s", v)
+	}
+	if base, _, _ := strings.Cut(key, "."); !knownSettings[base] {
+		return fmt.Errorf("未知的设置 %s", key)
+	}
+	*s = append(*s, [2]string{key, strings.TrimSpace(val)})
+	return nil
+}
+
+// 把 --concurrency 等快捷参数转成同名设置的覆盖
+func (s *settingOverrides) alias(key string) func(string) error {
+	return func(v string) error { return s.Set(key + "=" + v) }
+}
+
+// 应用命令行覆盖：key 覆盖全局设置，并去掉各组的 key.group 和组头选项；key.group 只覆盖该组
+func (c *Config) applyOverrides(overrides settingOverrides) {
+	for _, o := range overrides {
+		key, val := o[0], o[1]
+		if base, group, ok := strings.Cut(key, "."); ok {
+			delete(c.Options[group], base)
+		} else {
+			for k := range c.Settings {
+				if strings.HasPrefix(k, key+".") {
+					delete(c.Settings, k)
+				}
+			}
+			for _, opts := range c.Options {
+				delete(opts, key)
+			}
+		}
+		c.Settings[key] = val
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 组参数：组头中不是已知设置的选项，值为默认值，以同名环境变量和 {{name}} 模板变量提供给脚本
+//
+//	[deploy env=staging region=us-east-1]
+//	./deploy.sh --env "$env" --region {{region}}
+//
+// 执行时用 -p env=prod 覆盖
+var paramNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 命令行 -p 传入的参数，按出现顺序应用
+type paramOverrides [][2]string
+
+var paramFlags paramOverrides
+
+func (p *paramOverrides) String() string {
+	var kv []string
+	for _, o := range *p {
+		kv = append(kv, o[0]+"="+o[1])
+	}
+	return strings.Join(kv, " ")
+}
+
+func (p *paramOverrides) Set(v string) error {
+	key, val, ok := strings.Cut(v, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !paramNameRe.MatchString(key) {
+		return fmt.Errorf("参数应写作 name=value，name 只能包含字母、数字和下划线: %s", v)
+	}
+	*p = append(*p, [2]string{key, val})
+	return nil
+}
+
+// 组的参数及默认值
+func (c *Config) groupParams(group string) map[string]string {
+	var params map[string]string
+	for k, v := range c.Options[group] {
+		if knownSettings[k] {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[k] = v
+	}
+	return params
+}
+
+// 把 -p 的值写入声明了该参数的组；组链中没有组声明该参数时报错
+func (c *Config) applyParams(groups []string, overrides paramOverrides) error {
+	for _, o := range overrides {
+		found := false
+		for _, g := range groups {
+			if _, ok := c.groupParams(g)[o[0]]; ok {
+				c.Options[g][o[0]] = o[1]
+				found = true
+			}
+		}
+		if !found {
+			var declared []string
+			for _, g := range groups {
+				declared = append(declared, sortedKeys(c.groupParams(g))...)
+			}
+			if len(declared) == 0 {
+				return fmt.Errorf("组 [%s] 没有声明参数，不能使用 -p %s", strings.Join(groups, ","), o[0])
+			}
+			return fmt.Errorf("组 [%s] 没有参数 %s，可用的参数: %s", strings.Join(groups, ","), o[0], strings.Join(declared, ", "))
+		}
+	}
+	return nil
+}
+
+// 组头选项既不是已知设置也不是合法的参数名，或与某个设置拼写相近时的提示
+func lintGroupOption(group, key string) string {
+	if knownSettings[key] {
+		return ""
+	}
+	if !paramNameRe.MatchString(key) {
+		return fmt.Sprintf("组 [%s] 的未知选项 %s", group, key)
+	}
+	for _, s := range sortedKeys(knownSettings) {
+		if editDistance(key, s) <= 2 && len(key) > 3 {
+			return fmt.Sprintf("组 [%s] 的参数 %s 与设置 %s 相近，是否拼写错误？", group, key, s)
+		}
+	}
+	return ""
+}
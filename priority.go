@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 为每个目标设置调度优先级，默认 0，并发名额不足时优先级高的目录先调度：
+//
+//	[dirs]
+//	services/auth  tags=go priority=10
+//
+// 或 --priority-file 指定的文件，每行 目录 = 优先级（同 [weights]，按目录路径或目录名匹配，
+// 支持通配符），同一目录键覆盖清单中的设置。优先级相同时按 schedule 设置的顺序
+func assignPriority(cfg *Config, targets []*target) error {
+	patterns := sortedKeys(cfg.Priority)
+	for _, t := range targets {
+		for _, p := range patterns {
+			if !matchWeightPattern(p, t.Dir) {
+				continue
+			}
+			n, err := strconv.Atoi(cfg.Priority[p])
+			if err != nil {
+				return fmt.Errorf("无效的优先级配置 %s=%s", p, cfg.Priority[p])
+			}
+			t.Priority = n
+			break
+		}
+	}
+	return nil
+}
+
+// 读取 --priority-file，合并到 cfg.Priority；# 开头的行为注释
+func (c *Config) loadPriorityFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取优先级文件失败: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dir, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: 需要 目录 = 优先级", path, n)
+		}
+		c.Priority[strings.TrimSpace(dir)] = strings.TrimSpace(v)
+	}
+	return scanner.Err()
+}
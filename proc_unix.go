@@ -0,0 +1,53 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// 非 Windows 平台按参数原样传递，无需处理
+func setShellCmdLine(c *exec.Cmd, s shellSpec, script string) {}
+
+// 让 shell 及其子进程处于独立的进程组，便于整体终止
+func setProcessGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+}
+
+// 以 u 的身份启动；只有 root 能切换到其他用户，已经是该用户时不做处理
+func setCredential(c *exec.Cmd, u *runUser) error {
+	euid := os.Geteuid()
+	if uint32(euid) == u.Uid {
+		return nil
+	}
+	if euid != 0 {
+		return fmt.Errorf("以用户 %s 执行需要以 root 运行 runCmd（当前 uid %d）", u.Name, euid)
+	}
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Credential = &syscall.Credential{Uid: u.Uid, Gid: u.Gid, Groups: u.Groups}
+	return nil
+}
+
+// 向整个进程组发送 SIGTERM
+func terminateProcessGroup(c *exec.Cmd) error {
+	if c.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-c.Process.Pid, syscall.SIGTERM)
+}
+
+// 杀掉整个进程组
+func killProcessGroup(c *exec.Cmd) error {
+	if c.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+}
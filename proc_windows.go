@@ -0,0 +1,38 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// cmd.exe 不认识 Go 默认的参数转义，直接指定完整命令行
+func setShellCmdLine(c *exec.Cmd, s shellSpec, script string) {
+	if s.Name != "cmd" {
+		return
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{CmdLine: strings.Join(s.Argv, " ") + " " + script}
+}
+
+// Windows 下没有进程组信号，保持默认
+func setProcessGroup(c *exec.Cmd) {}
+
+func setCredential(c *exec.Cmd, u *runUser) error {
+	return errors.New("Windows 不支持 user 设置")
+}
+
+// Windows 下无法发送 SIGTERM，直接终止
+func terminateProcessGroup(c *exec.Cmd) error {
+	return killProcessGroup(c)
+}
+
+// 只能终止 shell 本身
+func killProcessGroup(c *exec.Cmd) error {
+	if c.Process == nil {
+		return nil
+	}
+	return c.Process.Kill()
+}
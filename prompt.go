@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// --interactive 时目录失败后的询问，nil 表示不询问
+var failurePrompter *failurePrompt
+
+var errUserSkipped = errors.New("失败后用户选择跳过")
+
+// 交互式 shell 运行期间 Ctrl-C 交给 shell，不取消整个运行
+var interruptPaused atomic.Bool
+
+type failurePrompt struct {
+	mu     sync.Mutex // 同一时间只询问一个目录
+	in     *bufio.Reader
+	out    io.Writer
+	cancel context.CancelCauseFunc
+	closed bool // stdin 已关闭，不再询问
+}
+
+func newFailurePrompt(in io.Reader, out io.Writer, cancel context.CancelCauseFunc) *failurePrompt {
+	return &failurePrompt{in: bufio.NewReader(in), out: out, cancel: cancel}
+}
+
+// 询问失败的目录如何处理：返回 true 表示重试；跳过时把结果改为 SKIPPED，中止时取消整个运行
+func (p *failurePrompt) ask(ctx context.Context, t *target, opts *runOptions, res *dirResult) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && ctx.Err() == nil {
+		fmt.Fprintf(p.out, "\n%s 组 [%s] %s: %v\n", prefix(t.Dir), opts.Group, colorStatus(res.Status), res.Err)
+		fmt.Fprint(p.out, "[r] 重试  [s] 跳过  [a] 中止运行  [h] 在该目录打开 shell  (默认 s): ")
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			// stdin 关闭时按失败处理，不再询问
+			p.closed = true
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "r", "retry":
+			return true
+		case "", "s", "skip":
+			res.Status, res.Err = statusSkipped, errUserSkipped
+			return false
+		case "a", "abort":
+			p.cancel(errUserCancelled)
+			return false
+		case "h", "shell":
+			if t.remote() {
+				fmt.Fprintln(p.out, "远程目标不支持打开 shell")
+				continue
+			}
+			p.shell(t, opts)
+		default:
+			fmt.Fprintln(p.out, "请输入 r、s、a 或 h")
+		}
+	}
+	return false
+}
+
+// 在目录中打开交互式 shell（$SHELL，Windows 为 %COMSPEC%），退出后回到询问
+func (p *failurePrompt) shell(t *target, opts *runOptions) {
+	prog := os.Getenv("SHELL")
+	if runtime.GOOS == "windows" {
+		prog = os.Getenv("COMSPEC")
+	}
+	if prog == "" {
+		prog = defaultShellName()
+	}
+	fmt.Fprintf(p.out, "进入 %s（目录 %s），退出 shell 后继续\n", prog, t.Dir)
+	c := exec.Command(prog)
+	c.Dir = t.Dir
+	c.Env = opts.Env
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	interruptPaused.Store(true)
+	defer interruptPaused.Store(false)
+	if err := c.Run(); err != nil {
+		fmt.Fprintf(p.out, "shell 退出: %v\n", err)
+	}
+}
+
+// 与 signal.NotifyContext 相同，但交互式 shell 运行期间忽略 Ctrl-C
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if sig == os.Interrupt && interruptPaused.Load() {
+					continue
+				}
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// pty 设置：auto 时只有一个目录才分配伪终端
+const (
+	ptyAuto = "auto"
+	ptyOn   = "true"
+	ptyOff  = "false"
+)
+
+func parsePTYSetting(v string) (string, error) {
+	switch v {
+	case "", ptyAuto:
+		return ptyAuto, nil
+	case ptyOn, ptyOff:
+		return v, nil
+	}
+	return "", fmt.Errorf("无效的 pty 配置 %q，可选 auto、true、false", v)
+}
+
+// stdin 和 stdout 都是终端时才能把子进程接到伪终端上
+func ptyAvailable() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// 伪终端的输出原样写到终端和日志文件，不按行读取。组用到逐行处理的功能时不能使用伪终端，
+// 否则密钥和 mask 匹配的内容会原样显示；返回不能使用的原因，空表示可以
+func (opts *runOptions) ptyBlocker() string {
+	switch {
+	case opts.Parallel:
+		return "parallel=true"
+	case opts.Container != nil:
+		return "container"
+	case len(opts.Expect) > 0:
+		return "expect"
+	case opts.Mask != nil || opts.secrets != nil:
+		return "mask 或密钥"
+	case opts.Grep != nil || opts.GrepV != nil:
+		return "grep"
+	case opts.MaxOutputLines > 0 || opts.MaxOutputBytes > 0:
+		return "max_output_*"
+	case opts.Timestamps != "":
+		return "timestamps"
+	}
+	return ""
+}
+
+// 所有伪终端共用的 stdin 读取：前一个进程结束后没读完的输入留给下一个，不会被遗留的读取丢掉
+var (
+	stdinOnce sync.Once
+	stdinData chan []byte
+)
+
+func stdinChunks() <-chan []byte {
+	stdinOnce.Do(func() {
+		stdinData = make(chan []byte, 16)
+		go func() {
+			defer close(stdinData)
+			for {
+				buf := make([]byte, 1024)
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					stdinData <- buf[:n]
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return stdinData
+}
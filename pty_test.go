@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestPTYBlocker(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "普通组", config: "[g]\nnpm login\n"},
+		{name: "parallel", config: "[g parallel=true]\na\nb\n", want: "parallel=true"},
+		{name: "mask", config: "[g mask=TOKEN]\nnpm login\n", want: "mask 或密钥"},
+		{name: "secret://", config: "[env:g]\nTOKEN = secret://env/CI_TOKEN\n[g]\nnpm login\n", want: "mask 或密钥"},
+		{name: "[secrets]", config: "[secrets]\nENC[...]\n[g]\nnpm login\n", want: "mask 或密钥"},
+		{name: "grep", config: "[g grep=error]\nmake\n", want: "grep"},
+		{name: "max_output_lines", config: "[g max_output_lines=10]\nmake\n", want: "max_output_*"},
+		{name: "timestamps", config: "[g timestamps=wall]\nmake\n", want: "timestamps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseConfig(tt.config)
+			opts, err := newRunOptions(cfg, "g", cfg.Groups["g"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := opts.ptyBlocker(); got != tt.want {
+				t.Errorf("ptyBlocker = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
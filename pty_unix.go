@@ -0,0 +1,69 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// 在伪终端中运行命令：终端输入原样转发，输出不加前缀直接写到终端并计入日志
+func runInPTY(c *exec.Cmd, t *target, opts *runOptions) (int64, int, error) {
+	ptmx, err := pty.Start(c)
+	if err != nil {
+		return 0, -1, startError(err, t, opts)
+	}
+	defer ptmx.Close()
+
+	// 窗口大小随当前终端变化
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer func() {
+		signal.Stop(winch)
+		close(winch)
+	}()
+	go func() {
+		for range winch {
+			_ = pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	winch <- syscall.SIGWINCH
+
+	// stdin 切换为 raw 模式，按键（含 Ctrl-C）交给子进程处理
+	if state, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+		defer func() { _ = term.Restore(int(os.Stdin.Fd()), state) }()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		in := stdinChunks()
+		for {
+			select {
+			case data, ok := <-in:
+				if !ok {
+					return
+				}
+				if _, err := ptmx.Write(data); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var out io.Writer = os.Stdout
+	if t.log != nil {
+		out = io.MultiWriter(os.Stdout, t.log.f)
+	}
+	// 子进程退出后读取会返回 EIO，属于正常结束
+	n, _ := io.Copy(out, ptmx)
+	err = c.Wait()
+	return n, c.ProcessState.ExitCode(), err
+}
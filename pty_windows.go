@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Windows 控制台下不分配伪终端，直接继承当前控制台的输入输出
+func runInPTY(c *exec.Cmd, t *target, opts *runOptions) (int64, int, error) {
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Start(); err != nil {
+		return 0, -1, startError(err, t, opts)
+	}
+	err := c.Wait()
+	return 0, c.ProcessState.ExitCode(), err
+}
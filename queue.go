@@ -0,0 +1,202 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"time"
+)
+
+// 调度队列中的一个目录：priority 大的先出队，相同时按调度顺序
+type job struct {
+	t        *target
+	seq      int
+	priority int
+}
+
+// 待调度目录的优先队列（container/heap）
+type jobQueue []*job
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x any) { *q = append(*q, x.(*job)) }
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	j := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return j
+}
+
+func newJobQueue(order []*target) *jobQueue {
+	q := make(jobQueue, len(order))
+	for i, t := range order {
+		q[i] = &job{t: t, seq: i, priority: t.Priority}
+	}
+	heap.Init(&q)
+	return &q
+}
+
+// 交给 worker 的目录；acquired 为 false 表示运行已取消、未占用名额
+type dispatched struct {
+	t        *target
+	acquired bool
+}
+
+// 按队列顺序逐个占用并发名额，再交给空闲的 worker；名额用完时在这里阻塞，不会提前为排队的目录
+// 创建 goroutine。有 [depends_on] 时只调度依赖都已结束的目录，依赖未成功的目录直接跳过
+func (b *batch) dispatch(ctx context.Context, jobs chan<- dispatched, done <-chan *target) {
+	defer close(jobs)
+	q := newJobQueue(b.order)
+	finished := make(map[*target]bool)
+	for q.Len() > 0 {
+		for drained := false; !drained; {
+			select {
+			case t := <-done:
+				finished[t] = true
+			default:
+				drained = true
+			}
+		}
+		t, blocked := b.nextReady(ctx, q, finished)
+		if t == nil {
+			select {
+			case t := <-done:
+				finished[t] = true
+			case <-ctx.Done():
+			}
+			continue
+		}
+		if blocked != nil {
+			logger.Warn(fmt.Sprintf("%s 依赖的目录 %s 未成功，跳过", prefix(t.Dir), blocked.Dir), "dir", t.Dir, "phase", "skip", "depends_on", blocked.Dir)
+			b.perDir[t.Index] = skippedResults(t, b.chain, fmt.Errorf("依赖的目录 [%s] 未成功", blocked.Dir))
+			finished[t] = true
+			b.queued.Add(-1)
+			b.finished.Add(1)
+			b.wg.Done()
+			continue
+		}
+		if b.tripped.Load() {
+			b.skipTripped(t, finished)
+			continue
+		}
+
+		if b.throttle != nil {
+			throttled := time.Now()
+			b.throttle.wait(ctx, func() int { return int(b.running.Load()) })
+			runDiagnostics.observe("load_throttle", throttled)
+		}
+		acquiring := time.Now()
+		acquired := b.worker.Acquire(ctx, t.Weight) == nil
+		runDiagnostics.observe("slot_wait", acquiring)
+		if acquired && b.tripped.Load() {
+			// 等待名额期间失败数达到了上限
+			b.worker.Release(t.Weight)
+			b.skipTripped(t, finished)
+			continue
+		}
+		b.queued.Add(-1)
+		if acquired {
+			b.running.Add(1)
+		}
+		// worker 都已退出时不能一直阻塞在发送上，取消后剩余的目录记为跳过
+		select {
+		case jobs <- dispatched{t: t, acquired: acquired}:
+		case <-ctx.Done():
+			if acquired {
+				b.running.Add(-1)
+				b.worker.Release(t.Weight)
+			}
+			b.skipCancelled(t)
+			for q.Len() > 0 {
+				b.queued.Add(-1)
+				b.skipCancelled(heap.Pop(q).(*job).t)
+			}
+			return
+		}
+	}
+}
+
+// 运行取消后没有交给 worker 的目录，记为跳过
+func (b *batch) skipCancelled(t *target) {
+	b.perDir[t.Index] = skippedResults(t, b.chain, nil)
+	b.finished.Add(1)
+	b.wg.Done()
+}
+
+// 失败数达到上限后不再执行的目录，记为跳过
+func (b *batch) skipTripped(t *target, finished map[*target]bool) {
+	b.perDir[t.Index] = skippedResults(t, b.chain, fmt.Errorf("失败的目录数达到上限（%s）", b.failures))
+	finished[t] = true
+	b.queued.Add(-1)
+	b.finished.Add(1)
+	b.wg.Done()
+}
+
+// 队列中第一个依赖都已结束的目录，及其未成功的依赖；都在等待依赖时返回 nil。
+// 已取消时不再等待依赖，由 runCmdsInDir 记为跳过
+func (b *batch) nextReady(ctx context.Context, q *jobQueue, finished map[*target]bool) (*target, *target) {
+	var held []*job
+	defer func() {
+		for _, j := range held {
+			heap.Push(q, j)
+		}
+	}()
+next:
+	for q.Len() > 0 {
+		j := heap.Pop(q).(*job)
+		if ctx.Err() != nil {
+			return j.t, nil
+		}
+		for _, dep := range j.t.Deps {
+			if !finished[dep] {
+				held = append(held, j)
+				continue next
+			}
+		}
+		for _, dep := range j.t.Deps {
+			if !dependsOK(b.perDir[dep.Index]) {
+				return j.t, dep
+			}
+		}
+		return j.t, nil
+	}
+	return nil, nil
+}
+
+// 固定数量的 worker 之一：依次执行分到的目录，结束后归还名额
+func (b *batch) work(ctx context.Context, cancel context.CancelCauseFunc, jobs <-chan dispatched, done chan<- *target) {
+	for d := range jobs {
+		t := d.t
+		b.perDir[t.Index] = runCmdsInDir(ctx, t, b.chain, nil)
+		if d.acquired {
+			b.running.Add(-1)
+			b.worker.Release(t.Weight)
+		}
+		n := b.finished.Add(1)
+		logger.Debug(fmt.Sprintf("进度: 完成 %d/%d，执行中 %d，排队 %d", n, len(b.order), b.running.Load(), b.queued.Load()),
+			"phase", "progress", "finished", n, "total", len(b.order))
+		if len(failedDirs(b.perDir[t.Index])) > 0 {
+			failed := int(b.failed.Add(1))
+			if b.failures.reached(failed, len(b.order)) && !b.tripped.Swap(true) {
+				logger.Warn(fmt.Sprintf("已有 %d 个目录失败，达到上限（%s），停止调度剩余目录", failed, b.failures),
+					"phase", "circuit_breaker", "failed", failed, "total", len(b.order))
+			}
+			if b.failFast && ctx.Err() == nil {
+				logger.Warn(fmt.Sprintf("%s[fail-fast] 执行失败，停止调度剩余目录", prefix(t.Dir)), "dir", t.Dir, "phase", "fail_fast")
+				cancel(errFailFast)
+			}
+		}
+		done <- t
+		b.wg.Done()
+	}
+}
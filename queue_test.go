@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobQueueOrder(t *testing.T) {
+	targets := newTargets([]string{"a", "b", "c", "d"})
+	targets[2].Priority = 5
+	targets[3].Priority = -1
+	q := newJobQueue(targets)
+	var got []string
+	for q.Len() > 0 {
+		got = append(got, heap.Pop(q).(*job).t.Dir)
+	}
+	// priority 大的先出队，相同时按调度顺序
+	if want := "c,a,b,d"; strings.Join(got, ",") != want {
+		t.Errorf("order = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+// 在临时目录中创建目录并用组 g 执行一次调度，返回按目标顺序的结果
+func runBatch(t *testing.T, ctx context.Context, config string, dirs []string, concurrency int, setup func([]*target)) (*batch, string) {
+	t.Helper()
+	root := t.TempDir()
+	var paths []string
+	for _, d := range dirs {
+		p := filepath.Join(root, d)
+		if err := os.Mkdir(p, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	cfg := parseConfig("[settings]\nshell = sh\n" + config)
+	opts, err := newRunOptions(cfg, "g", cfg.Groups["g"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := newTargets(paths)
+	for _, tg := range targets {
+		tg.buf = &lockedBuffer{}
+	}
+	if setup != nil {
+		setup(targets)
+	}
+	b := newBatch(targets, []*runOptions{opts}, concurrency, false)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	finished := make(chan struct{})
+	go func() {
+		b.start(ctx, cancel)
+		b.wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("调度没有结束")
+	}
+	return b, root
+}
+
+func TestBatchDependsOrder(t *testing.T) {
+	config := "[g]\nsleep 0.1\nbasename \"$PWD\" >> ../order\ntest \"$(basename \"$PWD\")\" != bad\n"
+	b, root := runBatch(t, context.Background(), config, []string{"a", "b", "c", "bad", "after_bad"}, 4, func(ts []*target) {
+		ts[1].Deps = []*target{ts[0]}        // b 依赖 a
+		ts[4].Deps = []*target{ts[2], ts[3]} // after_bad 依赖 c 和 bad
+	})
+	data, err := os.ReadFile(filepath.Join(root, "order"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := strings.Fields(string(data))
+	pos := make(map[string]int)
+	for i, d := range order {
+		pos[d] = i
+	}
+	if pos["a"] > pos["b"] {
+		t.Errorf("b 应在 a 之后执行: %q", order)
+	}
+	if _, ran := pos["after_bad"]; ran {
+		t.Errorf("依赖未成功的目录不应执行: %q", order)
+	}
+	want := []string{statusOK, statusOK, statusOK, statusFailed, statusSkipped}
+	for i, r := range b.results() {
+		if r.Status != want[i] {
+			t.Errorf("%s: status = %s, want %s", filepath.Base(r.Dir), r.Status, want[i])
+		}
+	}
+}
+
+func TestBatchZeroConcurrency(t *testing.T) {
+	b, _ := runBatch(t, context.Background(), "[g]\ntrue\n", []string{"a", "b"}, 0, nil)
+	for _, r := range b.results() {
+		if r.Status != statusOK {
+			t.Errorf("%s: status = %s", r.Dir, r.Status)
+		}
+	}
+}
+
+func TestBatchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b, _ := runBatch(t, ctx, "[g]\ntrue\n", []string{"a", "b", "c"}, 1, nil)
+	results := b.results()
+	if len(results) != 3 {
+		t.Fatalf("results = %d", len(results))
+	}
+	for _, r := range results {
+		if r.succeeded() {
+			t.Errorf("%s: 取消后不应执行，status = %s", r.Dir, r.Status)
+		}
+	}
+}
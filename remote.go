@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// 默认的 ssh 参数：禁止交互式输入密码，避免卡住
+const defaultSSHOptions = "-o BatchMode=yes"
+
+// 每台远程主机同时执行的目录数上限，0 表示只受全局并发限制
+var hostConcurrency int
+
+var (
+	hostSlotsMu sync.Mutex
+	hostSlots   = make(map[string]chan struct{})
+)
+
+// 获取主机的并发信号量
+func hostSlot(host string) chan struct{} {
+	hostSlotsMu.Lock()
+	defer hostSlotsMu.Unlock()
+	slot, ok := hostSlots[host]
+	if !ok {
+		slot = make(chan struct{}, hostConcurrency)
+		hostSlots[host] = slot
+	}
+	return slot
+}
+
+// 解析 user@host:/path 形式的远程目标；C:\dir 这样的盘符路径和 k8s:// 等 URL 不算
+func parseRemoteDir(dir string) (host, path string, ok bool) {
+	host, path, ok = strings.Cut(dir, ":")
+	if !ok || len(host) < 2 || path == "" || strings.ContainsAny(host, `/\`) || strings.HasPrefix(path, "//") {
+		return "", "", false
+	}
+	return host, path, true
+}
+
+// 按 POSIX shell 规则用单引号包裹
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./=:@,+%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// 是否在远程（ssh 主机或 k8s pod）执行
+func (t *target) remote() bool {
+	return t.Host != "" || t.Pod != ""
+}
+
+// 远程执行的 shell 脚本：进入目录、从 stdin 读取 [env] 变量的 export，再执行步骤。
+// 变量中可能有密钥，不放在 ssh、kubectl 的命令行上，避免两端的 ps 中可见
+func remoteScript(t *target, opts *runOptions, step cmdStep) string {
+	var parts []string
+	if t.RemoteDir != "" {
+		parts = append(parts, "cd "+shellQuote(t.RemoteDir))
+	}
+	if len(opts.ConfigEnv) > 0 {
+		parts = append(parts, `eval "$(cat)"`)
+	}
+	argv := step.Argv
+	if len(argv) == 0 {
+		argv = opts.Shell.scriptArgv(step.Script, opts.Args)
+	}
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
+	parts = append(parts, "exec "+strings.Join(quoted, " "))
+	return strings.Join(parts, " && ")
+}
+
+// remoteScript 从 stdin 读取的 export 语句，没有变量时为空
+func remoteEnvScript(opts *runOptions) string {
+	var b strings.Builder
+	for _, kv := range opts.ConfigEnv {
+		k, v, _ := strings.Cut(kv, "=")
+		fmt.Fprintf(&b, "export %s=%s\n", k, shellQuote(v))
+	}
+	return b.String()
+}
+
+// 把 export 语句交给远程命令的 stdin
+func setRemoteEnv(c *exec.Cmd, opts *runOptions) *exec.Cmd {
+	if script := remoteEnvScript(opts); script != "" {
+		c.Stdin = strings.NewReader(script)
+	}
+	return c
+}
+
+// 构造通过 ssh 在远程目录执行步骤的命令
+func sshCommand(ctx context.Context, t *target, opts *runOptions, step cmdStep) *exec.Cmd {
+	args := append([]string{}, opts.SSHOptions...)
+	if t.Port != "" {
+		args = append(args, "-p", t.Port)
+	}
+	args = append(args, "--", t.Host, remoteScript(t, opts, step))
+	return setRemoteEnv(exec.CommandContext(ctx, "ssh", args...), opts)
+}
+
+// 取出配置中 [env]、[secrets] 与 [env:group] 定义的变量（已展开），远程执行时需要显式传递；
+// secrets 为 buildEnv 返回的密钥变量
+func configEnv(cfg *Config, group string, env, secrets []string) []string {
+	keys := make(map[string]bool)
+	for _, scope := range []string{"", group} {
+		for k := range cfg.Env[scope] {
+			keys[k] = true
+		}
+	}
+	for _, kv := range secrets {
+		k, _, _ := strings.Cut(kv, "=")
+		keys[k] = true
+	}
+	var out []string
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); keys[k] {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
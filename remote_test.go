@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "''"},
+		{"plain", "plain"},
+		{"/srv/app-1.2/x=y:z@h,a+b%", "/srv/app-1.2/x=y:z@h,a+b%"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a\nb", "'a\nb'"},
+		{"中文", "'中文'"},
+	}
+	sh, err := exec.LookPath("sh")
+	for _, tt := range tests {
+		got := shellQuote(tt.in)
+		if got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		if err != nil {
+			continue
+		}
+		// 经过 shell 解析后应还原为原值
+		out, runErr := exec.Command(sh, "-c", "printf %s "+got).Output()
+		if runErr != nil || string(out) != tt.in {
+			t.Errorf("sh 解析 %s 得到 %q (%v), want %q", got, out, runErr, tt.in)
+		}
+	}
+}
+
+func TestRemoteScript(t *testing.T) {
+	sh, err := resolveShell("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		target    *target
+		env       []string
+		args      []string
+		step      cmdStep
+		want      string
+		wantStdin string
+	}{
+		{
+			name:   "脚本",
+			target: &target{Host: "web1", RemoteDir: "/srv/my app"},
+			step:   cmdStep{Script: "make && make install"},
+			want:   `cd '/srv/my app' && exec sh -c 'make && make install'`,
+		},
+		{
+			name:   "exec 形式",
+			target: &target{Host: "web1", RemoteDir: "/srv"},
+			step:   cmdStep{Argv: []string{"echo", "it's"}},
+			want:   `cd /srv && exec echo 'it'\''s'`,
+		},
+		{
+			name:   "带参数的脚本",
+			target: &target{Host: "web1", RemoteDir: "/srv"},
+			args:   []string{"--force"},
+			step:   cmdStep{Script: `deploy "$@"`},
+			want:   `cd /srv && exec sh -c 'deploy "$@"' runCmd --force`,
+		},
+		{
+			name:      "变量从 stdin 读取，不在命令行上",
+			target:    &target{Host: "web1", RemoteDir: "/srv"},
+			env:       []string{"TOKEN=s3cr3t", "MSG=a b'c"},
+			step:      cmdStep{Script: "echo $TOKEN"},
+			want:      `cd /srv && eval "$(cat)" && exec sh -c 'echo $TOKEN'`,
+			wantStdin: "export TOKEN=s3cr3t\nexport MSG='a b'\\''c'\n",
+		},
+		{
+			name:   "pod 中没有指定目录",
+			target: &target{Pod: "web-0"},
+			step:   cmdStep{Script: "hostname"},
+			want:   `exec sh -c hostname`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &runOptions{Shell: sh, ConfigEnv: tt.env, Args: tt.args}
+			if got := remoteScript(tt.target, opts, tt.step); got != tt.want {
+				t.Errorf("remoteScript = %s\nwant %s", got, tt.want)
+			}
+			if got := remoteEnvScript(opts); got != tt.wantStdin {
+				t.Errorf("remoteEnvScript = %q, want %q", got, tt.wantStdin)
+			}
+		})
+	}
+}
+
+func TestParseRemoteDir(t *testing.T) {
+	tests := []struct {
+		in         string
+		host, path string
+		ok         bool
+	}{
+		{"web1:/srv/app", "web1", "/srv/app", true},
+		{"deploy@web1.example.com:app", "deploy@web1.example.com", "app", true},
+		{"web1:", "", "", false},
+		{"./app", "", "", false},
+		{`C:\work\app`, "", "", false},
+		{"C:/work/app", "", "", false},
+		{"k8s://ns/app=web", "", "", false},
+		{"https://example.com/x", "", "", false},
+		{"dir/sub:x", "", "", false},
+	}
+	for _, tt := range tests {
+		host, path, ok := parseRemoteDir(tt.in)
+		if host != tt.host || path != tt.path || ok != tt.ok {
+			t.Errorf("parseRemoteDir(%q) = %q, %q, %v, want %q, %q, %v", tt.in, host, path, ok, tt.host, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestParseK8sTarget(t *testing.T) {
+	tests := []struct {
+		in                    string
+		ns, selector, workdir string
+		ok                    bool
+	}{
+		{"k8s://prod/app=web:/srv/app", "prod", "app=web", "/srv/app", true},
+		{"k8s://prod/web-0", "prod", "web-0", "", true},
+		{"k8s://prod", "", "", "", false},
+		{"k8s:///web-0", "", "", "", false},
+		{"web1:/srv", "", "", "", false},
+	}
+	for _, tt := range tests {
+		ns, selector, workdir, ok := parseK8sTarget(tt.in)
+		if ns != tt.ns || selector != tt.selector || workdir != tt.workdir || ok != tt.ok {
+			t.Errorf("parseK8sTarget(%q) = %q, %q, %q, %v", tt.in, ns, selector, workdir, ok)
+		}
+	}
+}
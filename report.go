@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// JSON 汇总中的单个目录
+type jsonDirReport struct {
+	Dir         string           `json:"dir"`
+	Group       string           `json:"group"`
+	Status      string           `json:"status"`
+	ExitCode    int              `json:"exit_code"`
+	DurationMs  int64            `json:"duration_ms"`
+	Commands    []string         `json:"commands"`
+	OutputBytes int64            `json:"output_bytes"`
+	Attempts    int              `json:"attempts"`
+	Warnings    int              `json:"warnings,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	LogFile     string           `json:"log_file,omitempty"`
+	ErrLogFile  string           `json:"err_log_file,omitempty"`
+	Steps       []jsonStepReport `json:"steps,omitempty"`
+}
+
+// JSON 汇总中的单条命令
+type jsonStepReport struct {
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// JSON 汇总
+type jsonReport struct {
+	Group      string          `json:"group"`
+	OK         bool            `json:"ok"`
+	DurationMs int64           `json:"duration_ms"`
+	Results    []jsonDirReport `json:"results"`
+}
+
+// 生成机器可读的运行汇总
+func newJSONReport(group string, results []*dirResult, elapsed time.Duration) jsonReport {
+	rep := jsonReport{Group: group, OK: true, DurationMs: elapsed.Milliseconds()}
+	for _, r := range results {
+		d := jsonDirReport{
+			Dir:         r.Dir,
+			Group:       r.Group,
+			Status:      r.Status,
+			ExitCode:    r.ExitCode,
+			DurationMs:  r.Duration.Milliseconds(),
+			Commands:    r.Cmds,
+			OutputBytes: r.OutputBytes,
+			Attempts:    r.Attempts,
+			Warnings:    r.Warnings,
+			LogFile:     r.LogFile,
+			ErrLogFile:  r.ErrLogFile,
+		}
+		if r.Err != nil {
+			d.Error = r.Err.Error()
+		}
+		for _, s := range r.Steps {
+			d.Steps = append(d.Steps, jsonStepReport{Command: s.Cmd, ExitCode: s.ExitCode, DurationMs: s.Duration.Milliseconds()})
+		}
+		if !r.succeeded() {
+			rep.OK = false
+		}
+		rep.Results = append(rep.Results, d)
+	}
+	return rep
+}
+
+// 输出机器可读的运行汇总
+func writeJSONReport(w io.Writer, group string, results []*dirResult, elapsed time.Duration) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newJSONReport(group, results, elapsed))
+}
+
+// 打印按耗时从长到短排序的汇总表
+func printSummaryTable(w io.Writer, results []*dirResult) {
+	sorted := append([]*dirResult{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Duration > sorted[j].Duration })
+
+	fmt.Fprintln(w, "\n===== 执行汇总 =====")
+	// 表头用英文，避免中文宽度导致列不对齐
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "DIR\tGROUP\t%s\tDURATION\tEXIT\n", plainCell("STATUS"))
+	for _, r := range sorted {
+		code := "-"
+		if r.ExitCode >= 0 {
+			code = fmt.Sprint(r.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Dir, r.Group, colorStatus(r.Status), r.Duration.Round(time.Millisecond), code)
+	}
+	tw.Flush()
+	printFailedSteps(w, sorted)
+}
+
+// 列出失败的目录中出错的那条命令
+func printFailedSteps(w io.Writer, results []*dirResult) {
+	header := false
+	for _, r := range results {
+		s := r.failedStep()
+		if !r.failed() || s == nil {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "失败的命令:")
+			header = true
+		}
+		code := "未完成"
+		if s.ExitCode >= 0 {
+			code = fmt.Sprintf("exit %d", s.ExitCode)
+		}
+		fmt.Fprintf(w, "  %s [%s]: %s (%s, %s)\n", r.Dir, r.Group, s.Cmd, code, s.Duration.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,1108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// 收到取消信号后等待进程退出的默认时长，超时后 SIGKILL
+const defaultGracePeriod = 5 * time.Second
+
+// 默认的首次重试等待时长
+const defaultRetryDelay = time.Second
+
+// parallel=true 时组内默认的并发上限
+const defaultParallelLimit = 4
+
+// 单行输出的默认长度上限，超出部分拆成多行输出
+const defaultMaxLineSize = 1 << 20
+
+// 进度信息与命令输出的目标，JSON 模式下改为 stderr 以保持 stdout 干净
+var logOut io.Writer = os.Stdout
+
+// output=buffered 时每个目录的输出在完成后整段打印
+var bufferedOutput bool
+
+// --output=gha：缓冲输出外包一层 ::group::，失败时输出 ::error:: 注解
+var ghaOutput bool
+
+// 单个组的执行参数
+type runOptions struct {
+	Group          string
+	Cmds           []string
+	Timeout        time.Duration     // 0 表示不限制
+	GracePeriod    time.Duration     // SIGTERM 之后等待多久再 SIGKILL
+	Retries        int               // 失败后的重试次数
+	RetryDelay     time.Duration     // 首次重试前的等待，之后每次翻倍
+	Vars           map[string]string // [vars] 中的模板变量
+	Params         map[string]string // 组参数（组头中的 name=value，可用 -p 覆盖）
+	Env            []string          // 子进程环境变量，KEY=VALUE 形式
+	DotenvFiles    []string          // 执行前从目标目录加载的 dotenv 文件
+	Shell          shellSpec         // 执行脚本的解释器
+	Steps          []cmdStep         // 实际执行的步骤
+	Parallel       bool              // 组内命令并发执行
+	ParallelLimit  int               // 组内并发上限
+	LogDir         string            // 每个目录的输出额外写入该目录下的日志文件
+	Timestamps     string            // 输出行的时间前缀：空、wall 或 elapsed
+	MaxLineSize    int               // 单行输出的长度上限（字节）
+	SplitStderr    bool              // stderr 单独读取并以 [err] 标注
+	StderrLog      bool              // 配合 log_dir 把 stderr 另写到 .err.log
+	Mask           *maskSpec         // 输出中需要遮盖的敏感内容
+	ConfigEnv      []string          // [env] 中定义的变量，远程或容器执行时显式传递
+	SSHOptions     []string          // 远程目标的 ssh 参数
+	Container      *containerSpec    // 在容器中执行，nil 表示直接在本机执行
+	KubectlOptions []string          // k8s 目标的 kubectl 参数，如 --context
+	K8sContainer   string            // k8s 目标 pod 中的容器名
+	Args           []string          // 命令行 -- 之后的参数，作为脚本的位置参数
+	When           []string          // 执行前的条件命令（--filter 与组内 when: 行），任一失败则跳过该组
+	Expect         []outputExpect    // 组内 expect: / expect-not: 行，执行成功后检查输出
+	Cache          bool              // 内容未变化时跳过执行，沿用上次成功的结果
+	CacheFiles     []string          // 参与缓存哈希的文件通配符，空表示 git 跟踪的文件或整个目录
+	Lock           string            // 目录锁被占用时：off、wait、skip、fail
+	LockTimeout    time.Duration     // wait 模式的最长等待，0 表示不限制
+	PTY            bool              // 在伪终端中执行，stdin 和输出直接连到当前终端
+	MaxOutputLines int64             // 每个目录每个组在终端显示的输出行数上限，0 表示不限制
+	MaxOutputBytes int64             // 同上，按字节计
+	Grep           *regexp.Regexp    // 终端只显示匹配的输出行，nil 表示不过滤
+	GrepV          *regexp.Regexp    // 终端不显示匹配的输出行
+	StepMarkers    bool              // per_command=markers：拼接的脚本中输出标记行，记录每条命令的结果
+	PerCommand     bool              // 每条命令独立进程执行（parallel 或 per_command=true）
+	LineConds      bool              // 有命令带 @linux、@if-exists 等条件前缀
+	Limits         resourceLimits    // nice、ionice、cpu_limit、mem_limit
+	User           string            // user 设置，以该用户执行命令
+	RunAs          *runUser          // 本机执行时切换的用户，容器中执行时为 nil（由 docker --user 处理）
+	Sandbox        *sandboxSpec      // sandbox=bwrap 时本机命令在 bubblewrap 中执行，nil 表示不隔离
+	Sync           *syncSpec         // sync=true 时 ssh 目标执行前后用 rsync 同步本机目录，nil 表示不同步
+
+	secrets *lazySecrets // 配置了密钥时非 nil，见 loadSecrets
+}
+
+// 设置命令行 -- 之后的参数：shell 脚本中为 $1 $2 ...，同时以 shell 转义后的形式放在 RUNCMD_ARGS 中
+func (opts *runOptions) setArgs(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	opts.Args = args
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	kv := "RUNCMD_ARGS=" + strings.Join(quoted, " ")
+	opts.Env = append(opts.Env, kv)
+	opts.ConfigEnv = append(opts.ConfigEnv, kv)
+}
+
+// 根据配置生成组的执行参数
+func newRunOptions(cfg *Config, group string, cmds []string) (*runOptions, error) {
+	opts := &runOptions{Group: group, Vars: cfg.Vars}
+	opts.When, cmds = splitWhen(cmds)
+	var err error
+	if opts.Expect, cmds, err = splitExpect(group, cmds); err != nil {
+		return nil, err
+	}
+	opts.Cmds = cmds
+	if opts.Timeout, err = cfg.durationSetting(group, "timeout", 0); err != nil {
+		return nil, err
+	}
+	if opts.GracePeriod, err = cfg.durationSetting(group, "grace_period", defaultGracePeriod); err != nil {
+		return nil, err
+	}
+	if opts.Retries, err = cfg.intSetting(group, "retries", 0); err != nil {
+		return nil, err
+	}
+	if opts.RetryDelay, err = cfg.durationSetting(group, "retry_delay", defaultRetryDelay); err != nil {
+		return nil, err
+	}
+	shellName, _ := cfg.groupSetting(group, "shell")
+	if v, ok := cfg.groupSetting(group, "container"); ok && v != "" {
+		spec := parseContainerSetting(v)
+		spec.Workdir = defaultContainerWorkdir
+		if w, ok := cfg.groupSetting(group, "container_workdir"); ok {
+			spec.Workdir = w
+		}
+		if o, ok := cfg.groupSetting(group, "container_options"); ok {
+			if spec.Options, err = splitArgs(o); err != nil {
+				return nil, fmt.Errorf("无效的 container_options 配置 %q: %w", o, err)
+			}
+		}
+		opts.Container = &spec
+		// 容器一般是 Linux 镜像，未指定 shell 时不使用宿主机的默认 shell
+		if shellName == "" {
+			shellName = "sh"
+		}
+	}
+	if opts.Shell, err = resolveShell(shellName); err != nil {
+		return nil, err
+	}
+	if opts.Parallel, err = cfg.boolSetting(group, "parallel", false); err != nil {
+		return nil, err
+	}
+	if opts.ParallelLimit, err = cfg.intSetting(group, "parallel_limit", defaultParallelLimit); err != nil {
+		return nil, err
+	}
+	if opts.ParallelLimit < 1 {
+		opts.ParallelLimit = 1
+	}
+	v, _ := cfg.groupSetting(group, "per_command")
+	perCommand, err := parsePerCommandSetting(v, opts.Shell)
+	if err != nil {
+		return nil, err
+	}
+	opts.StepMarkers = perCommand == perCommandMarkers
+	opts.PerCommand = opts.Parallel || perCommand == perCommandOn
+	// 带条件前缀时执行前按目录重新选出命令，这里先按全部命令检查格式
+	stepCmds, conds, err := stripLineConds(cmds)
+	if err != nil {
+		return nil, fmt.Errorf("组 [%s]: %w", group, err)
+	}
+	opts.LineConds = conds
+	if opts.Steps, err = buildSteps(group, stepCmds, opts.Shell, opts.PerCommand); err != nil {
+		return nil, err
+	}
+	cleanEnv, err := cfg.boolSetting(group, "clean_env", false)
+	if err != nil {
+		return nil, err
+	}
+	// secret:// 与 [secrets] 在第一次执行时才读取，--dry-run、validate 不会访问 Vault 等外部服务
+	if opts.Env, _, err = buildEnv(cfg, group, cleanEnv, false); err != nil {
+		return nil, err
+	}
+	opts.ConfigEnv = configEnv(cfg, group, opts.Env, nil)
+	if cfg.hasSecrets(group) {
+		opts.secrets = &lazySecrets{cfg: cfg, clean: cleanEnv, envLen: len(opts.Env), configEnvLen: len(opts.ConfigEnv)}
+	}
+	opts.Params = cfg.groupParams(group)
+	for _, k := range sortedKeys(opts.Params) {
+		opts.Env = append(opts.Env, k+"="+opts.Params[k])
+		opts.ConfigEnv = append(opts.ConfigEnv, k+"="+opts.Params[k])
+	}
+	sshOptions := defaultSSHOptions
+	if v, ok := cfg.groupSetting(group, "ssh_options"); ok {
+		sshOptions = v
+	}
+	if opts.SSHOptions, err = splitArgs(sshOptions); err != nil {
+		return nil, fmt.Errorf("无效的 ssh_options 配置 %q: %w", sshOptions, err)
+	}
+	if v, ok := cfg.groupSetting(group, "kubectl_options"); ok {
+		if opts.KubectlOptions, err = splitArgs(v); err != nil {
+			return nil, fmt.Errorf("无效的 kubectl_options 配置 %q: %w", v, err)
+		}
+	}
+	opts.K8sContainer, _ = cfg.groupSetting(group, "k8s_container")
+	if v, ok := cfg.groupSetting(group, "dotenv"); ok {
+		opts.DotenvFiles = parseDotenvSetting(v)
+	}
+	opts.LogDir, _ = cfg.groupSetting(group, "log_dir")
+	maxLine, err := cfg.sizeSetting(group, "max_line_size", defaultMaxLineSize)
+	if err != nil {
+		return nil, err
+	}
+	if maxLine < 1 {
+		maxLine = defaultMaxLineSize
+	}
+	opts.MaxLineSize = int(maxLine)
+	if v, ok := cfg.groupSetting(group, "stderr"); ok {
+		switch v {
+		case "merge":
+		case "separate":
+			opts.SplitStderr = true
+		default:
+			return nil, fmt.Errorf("无效的 stderr 配置 %q，可选 merge、separate", v)
+		}
+	}
+	if opts.StderrLog, err = cfg.boolSetting(group, "stderr_log", false); err != nil {
+		return nil, err
+	}
+	if opts.Limits, err = parseResourceLimits(cfg, group); err != nil {
+		return nil, err
+	}
+	if opts.Sandbox, err = parseSandbox(cfg, group); err != nil {
+		return nil, err
+	}
+	if opts.Sync, err = parseSync(cfg, group); err != nil {
+		return nil, err
+	}
+	if opts.User, _ = cfg.groupSetting(group, "user"); opts.User != "" && opts.Container == nil {
+		if opts.RunAs, err = lookupRunUser(opts.User); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := cfg.groupSetting(group, "mask"); ok {
+		if opts.Mask, err = parseMaskSetting(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := cfg.groupSetting(group, "timestamps"); ok {
+		if opts.Timestamps, err = parseTimestampsSetting(v); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Cache, err = cfg.boolSetting(group, "cache", false); err != nil {
+		return nil, err
+	}
+	if v, ok := cfg.groupSetting(group, "cache_files"); ok {
+		opts.CacheFiles = splitTags(v)
+	}
+	maxLines, err := cfg.intSetting(group, "max_output_lines", 0)
+	if err != nil {
+		return nil, err
+	}
+	opts.MaxOutputLines = int64(maxLines)
+	if opts.MaxOutputBytes, err = cfg.sizeSetting(group, "max_output_bytes", 0); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		key string
+		re  **regexp.Regexp
+	}{{"grep", &opts.Grep}, {"grep_v", &opts.GrepV}} {
+		if v, ok := cfg.groupSetting(group, f.key); ok && v != "" {
+			if *f.re, err = regexp.Compile(v); err != nil {
+				return nil, fmt.Errorf("无效的 %s 正则 %q: %w", f.key, v, err)
+			}
+		}
+	}
+	lock, _ := cfg.groupSetting(group, "lock")
+	if opts.Lock, err = parseLockSetting(lock); err != nil {
+		return nil, err
+	}
+	if opts.LockTimeout, err = cfg.durationSetting(group, "lock_timeout", 0); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// 生成子进程环境：继承（或 clean_env 时仅保留 PATH）+ [env] + [secrets] + [env:group]
+// 值中的 $VAR 按已生成的环境展开，如 PATH=$PATH:/opt/bin。resolve 为 true 时读取 secret://
+// 开头的值并解密 [secrets]，这些变量另外以 KEY=VALUE 返回，用于遮盖输出；为 false 时跳过它们
+func buildEnv(cfg *Config, group string, clean, resolve bool) ([]string, []string, error) {
+	env := make(map[string]string)
+	var order []string
+	set := func(k, v string) {
+		if _, ok := env[k]; !ok {
+			order = append(order, k)
+		}
+		env[k] = v
+	}
+	if clean {
+		if p, ok := os.LookupEnv("PATH"); ok {
+			set("PATH", p)
+		}
+	} else {
+		for _, kv := range os.Environ() {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				set(k, v)
+			}
+		}
+	}
+	var secrets []string
+	for _, scope := range []string{"", group} {
+		vars := cfg.Env[scope]
+		for _, k := range sortedKeys(vars) {
+			v := os.Expand(vars[k], func(name string) string { return env[name] })
+			if ref, ok := strings.CutPrefix(v, secretScheme); ok {
+				if !resolve {
+					continue
+				}
+				var err error
+				if v, err = resolveSecret(ref); err != nil {
+					return nil, nil, fmt.Errorf("[env] %s: %w", k, err)
+				}
+				secrets = append(secrets, k+"="+v)
+			}
+			set(k, v)
+		}
+		if scope == "" && resolve {
+			vars, err := cfg.secretEnv()
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, kv := range vars {
+				k, v, _ := strings.Cut(kv, "=")
+				set(k, v)
+				secrets = append(secrets, kv)
+			}
+		}
+	}
+
+	out := make([]string, 0, len(order))
+	for _, k := range order {
+		out = append(out, k+"="+env[k])
+	}
+	return out, secrets, nil
+}
+
+// 目录执行状态
+const (
+	statusOK        = "OK"
+	statusFailed    = "FAIL"
+	statusTimeout   = "TIMEOUT"
+	statusCancelled = "CANCELLED"
+	statusSkipped   = "SKIPPED"
+	statusCached    = "CACHED"
+)
+
+// 成功的状态：实际执行成功或命中缓存
+func okStatus(status string) bool {
+	return status == statusOK || status == statusCached
+}
+
+// 单个目录中一个组的执行结果
+type dirResult struct {
+	Dir         string
+	Group       string
+	Cmds        []string
+	Status      string
+	Err         error
+	ExitCode    int // 未启动或被信号终止时为 -1
+	Duration    time.Duration
+	OutputBytes int64
+	Attempts    int
+	Warnings    int          // warn 策略下失败的命令数
+	Steps       []stepResult // 每条命令的结果，整组拼成一个脚本且未开启 per_command=markers 时为空
+	OutputTail  []string     // 最后的若干行输出，--junit 时保留
+	LogFile     string       // log_dir 下的日志文件路径
+	ErrLogFile  string       // stderr_log=true 时的 stderr 日志路径
+}
+
+// 一个执行目标
+type target struct {
+	Dir         string
+	Index       int            // 在目标列表中的位置，从 0 开始
+	Host        string         // 远程目标的 ssh 主机（user@host），本地目录为空
+	Port        string         // [hosts] 清单中该主机的 ssh 端口，空表示默认
+	RemoteDir   string         // 远程主机或 pod 中的目录
+	Namespace   string         // k8s 目标的命名空间
+	Pod         string         // k8s 目标的 pod 名
+	Weight      int64          // 执行时占用的并发名额数
+	Priority    int            // 调度优先级，并发名额不足时大的先执行
+	Deps        []*target      // [depends_on] 中依赖的目标，它们成功后才开始执行
+	buf         *lockedBuffer  // 缓冲输出模式下收集该目录的全部输出
+	log         *dirLog        // 当前组的日志文件，未配置 log_dir 时为 nil
+	errLog      *dirLog        // stderr_log=true 时单独的 stderr 日志
+	start       time.Time      // 开始在该目录执行的时间
+	output      outputLimit    // 当前组已显示的输出，超过 max_output_* 后不再显示
+	captured    capturedOutput // --aggregate 时收集的输出
+	tail        outputTail     // 当前组最后的若干行输出，--junit 时使用
+	annotations string         // --output=gha 时随缓冲输出一起写出的注解
+	markers     *stepMarkers   // per_command=markers 时当前脚本的标记解析
+	expects     expectState    // 当前组的输出与 expect 的匹配情况
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// 单独取消该目录的执行（TUI 中使用）
+func (t *target) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// 目标的输出：缓冲模式下写入自己的缓冲区，否则经过 outputMu 输出
+func (t *target) w() io.Writer {
+	if t.buf != nil {
+		return t.buf
+	}
+	return consoleWriter{}
+}
+
+func newTargets(dirs []string) []*target {
+	out := make([]*target, len(dirs))
+	for i, d := range dirs {
+		// k8s 目标以 pod 名作为输出前缀
+		if ns, pod, workdir, ok := parseK8sTarget(d); ok {
+			out[i] = &target{Dir: pod, Index: i, Weight: 1, Namespace: ns, Pod: pod, RemoteDir: workdir}
+			continue
+		}
+		out[i] = &target{Dir: d, Index: i, Weight: 1}
+		out[i].Host, out[i].RemoteDir, _ = parseRemoteDir(d)
+	}
+	return out
+}
+
+func newDirResult(dir string, opts *runOptions) *dirResult {
+	return &dirResult{Dir: dir, Group: opts.Group, Cmds: opts.Cmds, ExitCode: -1}
+}
+
+// 组链中的组全部记为跳过
+func skippedResults(t *target, chain []*runOptions, err error) []*dirResult {
+	return abortedResults(t, chain, statusSkipped, err)
+}
+
+// 组链中各组都没有执行时的结果，status 为 SKIPPED 或 FAIL
+func abortedResults(t *target, chain []*runOptions, status string, err error) []*dirResult {
+	results := make([]*dirResult, 0, len(chain))
+	for _, opts := range chain {
+		res := newDirResult(t.Dir, opts)
+		res.Status, res.Err = status, err
+		results = append(results, res)
+		emit(runEvent{Kind: eventDirFinished, Dir: t.Dir, Group: opts.Group, Result: res})
+	}
+	return results
+}
+
+// 在目录依次执行组链，前一个组成功后才执行下一个
+func runCmdsInDir(ctx context.Context, t *target, chain []*runOptions, worker *semaphore.Weighted) []*dirResult {
+	results := make([]*dirResult, 0, len(chain))
+	skipRest := func(from int, err error) []*dirResult {
+		return append(results, skippedResults(t, chain[from:], err)...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	queued := time.Now()
+	// 远程目标先占用主机的并发名额
+	if t.Host != "" && hostConcurrency > 0 {
+		slot := hostSlot(t.Host)
+		select {
+		case slot <- struct{}{}:
+		case <-ctx.Done():
+			return skipRest(0, nil)
+		}
+		defer func() { <-slot }()
+	}
+
+	// 已取消时不再调度新目录；worker 为 nil 表示调用方已占用并发名额
+	if worker != nil {
+		if err := worker.Acquire(ctx, t.Weight); err != nil {
+			return skipRest(0, nil)
+		}
+		defer worker.Release(t.Weight)
+	}
+	if ctx.Err() != nil {
+		return skipRest(0, nil)
+	}
+	if worker != nil || t.Host != "" && hostConcurrency > 0 {
+		runDiagnostics.observe("slot_wait", queued)
+	}
+	if mode, timeout := chainLock(chain); mode != lockOff && !t.remote() {
+		locking := time.Now()
+		unlock, err := lockDir(ctx, t, mode, timeout)
+		runDiagnostics.observe("lock", locking)
+		if err != nil {
+			if ctx.Err() != nil {
+				return skipRest(0, nil)
+			}
+			t.logger().Warn(fmt.Sprintf("%s 未执行: %v", prefix(t.Dir), err), "phase", "lock", "error", err)
+			if mode == lockFail || !errors.Is(err, errDirLocked) {
+				return abortedResults(t, chain, statusFailed, err)
+			}
+			return skipRest(0, err)
+		}
+		defer unlock()
+	}
+	ctx, span := startDirSpan(ctx, t)
+	defer span.End()
+
+	t.start = time.Now()
+	if bufferedOutput {
+		t.buf = &lockedBuffer{}
+		defer t.flush()
+	}
+
+	for _, opts := range chain {
+		if err := opts.loadSecrets(); err != nil {
+			t.logger().Error(fmt.Sprintf("%s 未执行: %v", prefix(t.Dir), err), "group", opts.Group, "phase", "secrets", "error", err)
+			return abortedResults(t, chain, statusFailed, err)
+		}
+	}
+	if err := activeHooks.runInDir(ctx, t, chain[0], "pre_dir", "GROUP", chainName(chain)); err != nil {
+		return abortedResults(t, chain, statusFailed, err)
+	}
+	for i, opts := range chain {
+		res := runGroupInDir(ctx, t, opts)
+		results = append(results, res)
+		if !res.succeeded() && i+1 < len(chain) {
+			results = skipRest(i+1, fmt.Errorf("前置组 [%s] 未成功", opts.Group))
+			break
+		}
+	}
+	activeHooks.postDir(context.WithoutCancel(ctx), t, chain, results)
+	if ghaOutput {
+		t.annotations = ghaAnnotations(results)
+	}
+	return results
+}
+
+// 在目录执行单个组（含重试）
+func runGroupInDir(ctx context.Context, t *target, opts *runOptions) *dirResult {
+	dir := t.Dir
+	res := newDirResult(dir, opts)
+	log := t.logger().With("group", opts.Group)
+	checking := time.Now()
+	cond, err := checkWhen(ctx, t, opts)
+	if len(opts.When) > 0 {
+		runDiagnostics.observe("when", checking)
+	}
+	if err != nil {
+		res.Status, res.Err = statusSkipped, err
+		if ctx.Err() != nil {
+			res.Status = statusCancelled
+		}
+		log.Info(fmt.Sprintf("--- 跳过目录 %s 的组 [%s]: 条件不满足 (%s)", prefix(dir), opts.Group, cond), "phase", "skip", "condition", cond)
+		emit(runEvent{Kind: eventDirFinished, Dir: dir, Group: opts.Group, Result: res})
+		return res
+	}
+	var hash string
+	if opts.Cache && resultCacheStore != nil && !t.remote() {
+		hashing := time.Now()
+		h, err := dirContentHash(ctx, dir, opts)
+		runDiagnostics.observe("cache_hash", hashing)
+		switch {
+		case err != nil:
+			log.Warn(fmt.Sprintf("%s 计算缓存哈希失败，照常执行: %v", prefix(dir), err), "phase", "cache", "error", err)
+		case resultCacheStore.hit(dir, opts.Group, h):
+			res.Status, res.ExitCode = statusCached, 0
+			log.Info(fmt.Sprintf("=== 目录 %s 的组 [%s] 自上次成功后没有变化，使用缓存结果", prefix(dir), opts.Group), "phase", "cache", "hash", h)
+			emit(runEvent{Kind: eventDirFinished, Dir: dir, Group: opts.Group, Result: res})
+			return res
+		default:
+			hash = h
+		}
+	}
+	log.Info(fmt.Sprintf(">>> 开始在目录 %s 执行组 [%s]...", prefix(dir), opts.Group), "phase", "start")
+	emit(runEvent{Kind: eventDirStarted, Dir: dir, Group: opts.Group})
+	start := time.Now()
+	ctx, span := startGroupSpan(ctx, opts.Group)
+	defer endGroupSpan(span, res)
+
+	if opts.LogDir != "" {
+		logFile, err := openDirLog(opts.LogDir, opts.Group, dir, ".log")
+		if err != nil {
+			log.Warn(fmt.Sprintf("%s 创建日志文件失败，仅输出到终端: %v", prefix(dir), err), "phase", "log_file", "error", err)
+		} else {
+			res.LogFile = logFile.Path
+			t.log = logFile
+			defer func() {
+				t.log = nil
+				_ = logFile.Close()
+			}()
+			logFile.printf("开始在目录 %s 执行组 [%s]", dir, opts.Group)
+		}
+	}
+	if opts.LogDir != "" && opts.SplitStderr && opts.StderrLog {
+		errLog, err := openDirLog(opts.LogDir, opts.Group, dir, ".err.log")
+		if err != nil {
+			log.Warn(fmt.Sprintf("%s 创建 stderr 日志文件失败: %v", prefix(dir), err), "phase", "log_file", "error", err)
+		} else {
+			res.ErrLogFile = errLog.Path
+			t.errLog = errLog
+			defer func() {
+				t.errLog = nil
+				_ = errLog.Close()
+			}()
+		}
+	}
+
+	t.output.reset()
+	t.tail.take()
+	hookErr := activeHooks.runInDir(ctx, t, opts, "pre_group", "GROUP", opts.Group)
+	// sync=true 只对 ssh 目标生效：先把本机目录推到远程目录
+	rsync := opts.Sync
+	if t.Host == "" {
+		rsync = nil
+	}
+	if hookErr == nil && rsync != nil {
+		if hookErr = rsync.push(ctx, t, opts); hookErr != nil {
+			log.Error(fmt.Sprintf("%s %v", prefix(dir), hookErr), "phase", "sync", "error", hookErr)
+		}
+	}
+	if hookErr != nil {
+		res.Status, res.Err = statusFailed, hookErr
+	}
+	if hookErr == nil {
+		runWithRetries(ctx, t, opts, res)
+		// --interactive 时失败后询问，选择重试则再执行一轮
+		for res.failed() && ctx.Err() == nil && failurePrompter.ask(ctx, t, opts, res) {
+			log.Info(fmt.Sprintf("%s 按要求重新执行组 [%s]", prefix(dir), opts.Group), "phase", "retry")
+			runWithRetries(ctx, t, opts, res)
+		}
+	}
+	// 失败时也尝试拉回产物（如测试报告），只有成功的组因拉回失败而记为失败
+	if hookErr == nil && rsync != nil && ctx.Err() == nil {
+		if err := rsync.pull(ctx, t, opts); err != nil {
+			log.Warn(fmt.Sprintf("%s %v", prefix(dir), err), "phase", "sync", "error", err)
+			if res.Status == statusOK {
+				res.Status, res.Err = statusFailed, err
+			}
+		}
+	}
+	res.Duration = time.Since(start)
+	res.OutputTail = t.tail.take()
+	if n := t.output.suppressed.Load(); n > 0 {
+		where := "配置 log_dir 可保存完整输出"
+		if res.LogFile != "" {
+			where = "见日志文件 " + res.LogFile
+		}
+		log.Warn(fmt.Sprintf("%s … %d 行输出未显示（%s）", prefix(dir), n, where), "phase", "output", "suppressed_lines", n)
+	}
+	_ = activeHooks.runInDir(context.WithoutCancel(ctx), t, opts, "post_group", "GROUP", opts.Group,
+		"STATUS", res.Status, "EXIT_CODE", strconv.Itoa(res.ExitCode), "DURATION", seconds(res.Duration))
+	log.Info(fmt.Sprintf("<<< 完成目录 %s 的组 [%s]: %s", prefix(dir), opts.Group, colorStatus(res.Status)),
+		"phase", "finish", "status", res.Status, "exit_code", res.ExitCode, "duration_ms", res.Duration.Milliseconds())
+	consoleBlankLine(t.w())
+	t.log.printf("完成: %s，耗时 %s", res.Status, res.Duration.Round(time.Millisecond))
+	if hash != "" && res.Status == statusOK {
+		if err := resultCacheStore.store(dir, opts.Group, hash); err != nil {
+			log.Warn(fmt.Sprintf("%s 写入缓存失败: %v", prefix(dir), err), "phase", "cache", "error", err)
+		}
+	}
+	emit(runEvent{Kind: eventDirFinished, Dir: dir, Group: opts.Group, Result: res})
+	return res
+}
+
+// 执行一次组，失败时按 retries 重试，重试间隔每次翻倍
+func runWithRetries(ctx context.Context, t *target, opts *runOptions, res *dirResult) {
+	log := t.logger().With("group", opts.Group)
+	for attempt := 1; ; attempt++ {
+		res.Attempts++
+		running := time.Now()
+		runAttempt(ctx, t, opts, res)
+		runDiagnostics.observe("command", running)
+		if !res.failed() || attempt > opts.Retries {
+			return
+		}
+		delay := opts.RetryDelay << (attempt - 1)
+		log.Warn(fmt.Sprintf("%s[retry] 第 %d 次失败，%s 后重试 (%d/%d)", prefix(t.Dir), attempt, delay, attempt, opts.Retries),
+			"phase", "retry", "attempt", attempt, "delay", delay.String())
+		t.log.printf("[retry] 第 %d 次失败，%s 后重试 (%d/%d)", attempt, delay, attempt, opts.Retries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			res.Status, res.Err = statusCancelled, ctx.Err()
+			return
+		}
+	}
+}
+
+// 模板变量，如 {{dir}}、{{ base }}
+var templateVarRe = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// 展开模板变量，未知变量保持原样；用于 exec 命令的参数和文件名，值不加引号
+func expandTemplate(t *target, opts *runOptions, s string) string {
+	return expandTemplateWith(t, opts, s, func(v string) string { return v })
+}
+
+// 展开交给 shell 的脚本中的模板变量：目录、主机和 -p 传入的组参数可能含空格或
+// shell 元字符，按 shell 的规则加引号；[vars] 由配置作者编写，原样展开
+func expandShellTemplate(t *target, opts *runOptions, s string) string {
+	return expandTemplateWith(t, opts, s, opts.Shell.quote)
+}
+
+func expandTemplateWith(t *target, opts *runOptions, s string, quote func(string) string) string {
+	vars := map[string]string{
+		"dir":   t.Dir,
+		"base":  filepath.Base(filepath.Clean(t.Dir)),
+		"group": opts.Group,
+		"index": strconv.Itoa(t.Index),
+		"host":  t.Host,
+	}
+	return templateVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := templateVarRe.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return quote(v)
+		}
+		if v, ok := opts.Params[name]; ok {
+			return quote(v)
+		}
+		if v, ok := opts.Vars[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// 仅打印每个目录将执行的脚本，不启动 shell
+func printDryRun(targets []*target, chain []*runOptions) {
+	for _, t := range targets {
+		dir := t.Dir
+		if len(t.Deps) > 0 {
+			var deps []string
+			for _, d := range t.Deps {
+				deps = append(deps, d.Dir)
+			}
+			fmt.Fprintf(logOut, "%s # 依赖: %s\n", prefix(dir), strings.Join(deps, ", "))
+		}
+		for _, opts := range chain {
+			fmt.Fprintf(logOut, ">>> [dry-run] 目录 %s 组 [%s] 将执行 (%s):\n", prefix(dir), opts.Group, opts.Shell)
+			if len(opts.Args) > 0 {
+				fmt.Fprintf(logOut, "%s # 参数: %s\n", prefix(dir), strings.Join(opts.Args, " "))
+			}
+			for _, cond := range opts.When {
+				fmt.Fprintf(logOut, "%s # 条件: %s\n", prefix(dir), expandShellTemplate(t, opts, cond))
+			}
+			for _, e := range opts.Expect {
+				fmt.Fprintf(logOut, "%s # 检查输出: %s\n", prefix(dir), e)
+			}
+			steps, err := opts.stepsFor(t)
+			if err != nil {
+				fmt.Fprintf(logOut, "%s # %v\n", prefix(dir), err)
+			}
+			for i, step := range steps {
+				step = step.expand(t, opts)
+				if len(steps) > 1 {
+					tag := "exec"
+					if len(step.Argv) == 0 {
+						tag = opts.Shell.String()
+					}
+					fmt.Fprintf(logOut, "%s # 步骤 %d (%s, 失败策略 %s)\n", prefix(dir), i+1, tag, step.Policy)
+				}
+				for _, line := range strings.Split(step.String(), "\n") {
+					fmt.Fprintf(logOut, "%s %s\n", prefix(dir), line)
+				}
+			}
+			fmt.Fprintln(logOut)
+		}
+	}
+}
+
+// 用户在界面中取消了整个运行
+var errUserCancelled = errors.New("用户取消")
+
+// fail-fast 模式下因其他目录失败而取消
+var errFailFast = errors.New("fail-fast: 有目录执行失败")
+
+// 整个运行超过 max_run_time
+var errMaxRunTime = errors.New("超过 max_run_time")
+
+// 是否执行失败（含超时）
+func (r *dirResult) failed() bool {
+	return r.Status == statusFailed || r.Status == statusTimeout
+}
+
+// 不影响后续组和依赖它的目录：执行成功、命中缓存，或条件不满足而跳过
+func (r *dirResult) succeeded() bool {
+	return okStatus(r.Status) || errors.Is(r.Err, errConditionNotMet)
+}
+
+// 执行失败（含超时）的目录
+func failedDirs(results []*dirResult) []string {
+	var out []string
+	for _, r := range results {
+		if r.failed() {
+			out = append(out, r.Dir)
+		}
+	}
+	return out
+}
+
+// 打印取消汇总
+func printCancelSummary(results []*dirResult, cause error) {
+	// 组链时一个目录有多条结果：有中断算中断，全部跳过算未开始
+	var order []string
+	state := make(map[string]string)
+	for _, r := range results {
+		prev, seen := state[r.Dir]
+		if !seen {
+			order = append(order, r.Dir)
+		}
+		switch {
+		case r.Status == statusCancelled || prev == statusCancelled:
+			state[r.Dir] = statusCancelled
+		case r.Status == statusSkipped && (!seen || prev == statusSkipped):
+			state[r.Dir] = statusSkipped
+		default:
+			state[r.Dir] = statusOK
+		}
+	}
+	var done, cancelled, skipped []string
+	for _, dir := range order {
+		switch state[dir] {
+		case statusCancelled:
+			cancelled = append(cancelled, dir)
+		case statusSkipped:
+			skipped = append(skipped, dir)
+		default:
+			done = append(done, dir)
+		}
+	}
+	reason := "运行已取消"
+	switch {
+	case errors.Is(cause, errFailFast):
+		reason = "fail-fast 已停止运行"
+	case errors.Is(cause, errMaxRunTime):
+		reason = "超过 max_run_time 已停止运行"
+	}
+	fmt.Fprintf(logOut, "\n%s: 已完成 %d 个，中断 %d 个，未开始 %d 个\n", reason, len(done), len(cancelled), len(skipped))
+	if len(cancelled) > 0 {
+		fmt.Fprintf(logOut, "  中断: %s\n", strings.Join(cancelled, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(logOut, "  未开始: %s\n", strings.Join(skipped, ", "))
+	}
+}
+
+// 执行一次命令脚本，结果写入 res
+func runAttempt(ctx context.Context, t *target, opts *runOptions, res *dirResult) {
+	dir := t.Dir
+	log := t.logger().With("group", opts.Group)
+	res.ExitCode, res.Err, res.Steps = -1, nil, nil
+
+	runCtx := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	env := opts.Env
+	if len(opts.DotenvFiles) > 0 && !t.remote() {
+		// 目录内 dotenv 最后追加，同名变量以它为准
+		dotenv, err := loadDotenvFiles(dir, opts.DotenvFiles)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s 加载 dotenv 失败: %v", prefix(dir), err), "phase", "dotenv", "error", err)
+			t.log.printf("加载 dotenv 失败: %v", err)
+			res.Status, res.Err = statusFailed, err
+			return
+		}
+		env = append(append([]string{}, opts.Env...), dotenv...)
+	}
+
+	t.expects.reset(opts)
+	err := runSteps(runCtx, t, env, opts, res)
+	if err == nil {
+		err = t.expects.check(opts)
+	}
+
+	switch {
+	case err == nil:
+		res.Status, res.ExitCode = statusOK, 0
+	case ctx.Err() != nil:
+		log.Warn(fmt.Sprintf("%s[cancel] 已取消执行", prefix(dir)), "phase", "cancel")
+		t.log.printf("[cancel] 已取消执行")
+		res.Status, res.Err = statusCancelled, ctx.Err()
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		log.Warn(fmt.Sprintf("%s[timeout] 执行超时 (%s)，已终止进程组", prefix(dir), opts.Timeout), "phase", "timeout", "timeout", opts.Timeout.String())
+		t.log.printf("[timeout] 执行超时 (%s)，已终止进程组", opts.Timeout)
+		res.Status, res.Err = statusTimeout, runCtx.Err()
+	default:
+		log.Warn(fmt.Sprintf("%s 执行错误: %v", prefix(dir), err), "phase", "error", "error", err)
+		t.log.printf("执行错误: %v", err)
+		res.Status, res.Err = statusFailed, err
+	}
+}
+
+// 按目标类型构造执行步骤的命令：k8s、ssh、容器、exec 形式或本机 shell，sandbox=bwrap 时本机命令包在 bwrap 中
+func stepCommand(ctx context.Context, t *target, opts *runOptions, step cmdStep, env []string) *exec.Cmd {
+	switch {
+	case t.Pod != "":
+		return kubectlCommand(ctx, t, opts, step)
+	case t.Host != "":
+		return sshCommand(ctx, t, opts, step)
+	case opts.Container != nil:
+		// env 的前半部分是宿主机环境，只把配置变量和 dotenv 变量传进容器
+		return containerCommand(ctx, t, opts, step, append(append([]string{}, opts.ConfigEnv...), env[len(opts.Env):]...))
+	}
+	var c *exec.Cmd
+	if len(step.Argv) > 0 {
+		c = exec.CommandContext(ctx, step.Argv[0], step.Argv[1:]...)
+	} else {
+		c = opts.Shell.command(ctx, step.Script, opts.Args)
+	}
+	if opts.Sandbox != nil {
+		return opts.Sandbox.wrap(ctx, c, t.Dir)
+	}
+	return c
+}
+
+// 执行组内各步骤，按失败策略决定是否继续；parallel=true 时并发执行
+func runSteps(ctx context.Context, t *target, env []string, opts *runOptions, res *dirResult) error {
+	var mu sync.Mutex
+	// 第一个导致组失败的步骤决定退出码，并发执行时后结束的步骤不能覆盖它
+	var firstErr error
+	run := func(step cmdStep, label string, stepNo int) error {
+		step = step.expand(t, opts)
+		// 伪终端中输出不按行读取，无法识别标记行
+		markers := opts.StepMarkers && len(step.Cmds) > 1 && !opts.PTY
+		if markers {
+			t.markers = &stepMarkers{cmds: step.Cmds, res: res}
+			step.Script = markerScript(step.Cmds)
+		}
+		c := stepCommand(ctx, t, opts, step, env)
+		t.logger().Debug(fmt.Sprintf("%s 执行命令: %s", prefix(label), step), "group", opts.Group, "phase", "command", "command", step.String())
+		_, span := startCommandSpan(ctx, step)
+		start := time.Now()
+		n, code, err := runProcess(c, t, label, env, opts)
+		endCommandSpan(span, code, n, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		res.OutputBytes += n
+		stops := err != nil && (ctx.Err() != nil || step.Policy == policyStop)
+		if firstErr == nil {
+			// 成功或按 allow_failure、warn 忽略的失败都不改变组的退出码
+			res.ExitCode = 0
+			if stops {
+				res.ExitCode, firstErr = code, err
+				if stepNo > 0 {
+					firstErr = fmt.Errorf("步骤 %d: %w", stepNo, err)
+				}
+			}
+		}
+		switch {
+		case markers:
+			t.markers.finish(code)
+			t.markers = nil
+		case len(step.Cmds) <= 1:
+			res.Steps = append(res.Steps, stepResult{Cmd: step.String(), ExitCode: code, Duration: time.Since(start)})
+		}
+		if err == nil {
+			return nil
+		}
+		if stops {
+			return err
+		}
+		if step.Policy == policyWarn {
+			t.logger().Warn(fmt.Sprintf("%s[warn] 命令失败，继续执行: %s (%v)", prefix(label), step, err),
+				"group", opts.Group, "phase", "warn", "command", step.String(), "error", err)
+			t.log.printf("[warn] 命令失败，继续执行: %s (%v)", step, err)
+			res.Warnings++
+		}
+		return nil
+	}
+
+	steps, err := opts.stepsFor(t)
+	if err != nil {
+		return err
+	}
+	if !opts.Parallel || len(steps) < 2 {
+		for _, step := range steps {
+			if err := run(step, t.Dir, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// 并发执行时输出前缀带上步骤序号，如 [dir#2]
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.ParallelLimit)
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step cmdStep) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			_ = run(step, fmt.Sprintf("%s#%d", t.Dir, i+1), i+1)
+		}(i, step)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// 启动单个进程并实时输出，返回输出字节数、退出码和 Wait 的结果
+func runProcess(c *exec.Cmd, t *target, label string, env []string, opts *runOptions) (int64, int, error) {
+	if !t.remote() {
+		c.Dir = filepath.Clean(t.Dir)
+	}
+	c.Env = env
+
+	// 先 SIGTERM 整个进程组，宽限期后仍未退出则 SIGKILL
+	var killTimer *time.Timer
+	c.Cancel = func() error {
+		killTimer = time.AfterFunc(opts.GracePeriod, func() { _ = killProcessGroup(c) })
+		return terminateProcessGroup(c)
+	}
+	defer func() {
+		if killTimer != nil {
+			killTimer.Stop()
+		}
+	}()
+	// 资源限制只对本机进程生效，容器中执行时已转为 docker run 的参数
+	if !t.remote() && opts.Container == nil {
+		limits, err := prepareLimits(c, opts.Limits)
+		if err != nil {
+			return 0, -1, err
+		}
+		defer limits.close()
+	}
+	if u := opts.localUser(t); u != nil {
+		if err := setCredential(c, u); err != nil {
+			return 0, -1, err
+		}
+		c.Env = slices.Concat(env, u.env())
+	}
+	// 伪终端中的进程自成会话，进程组 id 即 pid
+	if opts.PTY && !t.remote() {
+		return runInPTY(c, t, opts)
+	}
+	setProcessGroup(c)
+
+	// 默认合并 stdout 和 stderr；stderr=separate 时分开读取
+	stdout, _ := c.StdoutPipe()
+	var stderr io.Reader
+	if opts.SplitStderr {
+		stderr, _ = c.StderrPipe()
+	} else {
+		c.Stderr = c.Stdout
+	}
+
+	if err := c.Start(); err != nil {
+		return 0, -1, startError(err, t, opts)
+	}
+
+	// 实时读取输出，打印和写日志前先遮盖敏感内容
+	var n atomic.Int64
+	mask := opts.Mask.forEnv(env)
+	stream := func(r io.Reader, isErr bool) {
+		readErr := readLines(r, opts.MaxLineSize, func(line string) {
+			if t.markers != nil && !isErr {
+				var show bool
+				if line, show = t.markers.scan(line); !show {
+					return
+				}
+			}
+			n.Add(int64(len(line)) + 1)
+			t.writeLine(label, mask.apply(line), isErr, opts)
+		})
+		if readErr != nil {
+			// 读取出错时丢弃剩余输出，避免子进程因管道写满而阻塞
+			t.logger().Warn(fmt.Sprintf("%s 读取输出失败: %v", prefix(label), readErr), "group", opts.Group, "phase", "output", "error", readErr)
+			t.log.printf("读取输出失败: %v", readErr)
+			_, _ = io.Copy(io.Discard, r)
+		}
+	}
+	if stderr != nil {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			stream(stderr, true)
+		}()
+		stream(stdout, false)
+		<-done
+	} else {
+		stream(stdout, false)
+	}
+
+	err := c.Wait()
+	return n.Load(), c.ProcessState.ExitCode(), err
+}
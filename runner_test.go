@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestRunStepsExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("用例中的命令需要 POSIX shell")
+	}
+	tests := []struct {
+		name         string
+		config       string
+		wantErr      bool
+		wantCode     int
+		wantWarnings int
+		wantStatus   string
+	}{
+		{
+			name:       "全部成功",
+			config:     "[g per_command=true]\ntrue\ntrue\n",
+			wantStatus: statusOK,
+		},
+		{
+			name:       "失败的步骤停止该组",
+			config:     "[g per_command=true]\nexit 3\nexit 4\n",
+			wantErr:    true,
+			wantCode:   3,
+			wantStatus: statusFailed,
+		},
+		{
+			name:       "最后的 allow_failure 步骤不改变退出码",
+			config:     "[g per_command=true]\ntrue\n- exit 1\n",
+			wantStatus: statusOK,
+		},
+		{
+			name:       "allow_failure 之后的失败决定退出码",
+			config:     "[g per_command=true]\n- exit 1\nexit 5\n",
+			wantErr:    true,
+			wantCode:   5,
+			wantStatus: statusFailed,
+		},
+		{
+			name:         "warn 计数但不失败",
+			config:       "[g per_command=true]\n!exit 2\ntrue\n",
+			wantWarnings: 1,
+			wantStatus:   statusOK,
+		},
+		{
+			name:       "! 加空格是 shell 的取反",
+			config:     "[g]\n! false\n! true\n",
+			wantErr:    true,
+			wantCode:   1,
+			wantStatus: statusFailed,
+		},
+		{
+			name:       "整组一个脚本",
+			config:     "[g]\ntrue\nexit 7\n",
+			wantErr:    true,
+			wantCode:   7,
+			wantStatus: statusFailed,
+		},
+		{
+			name:       "并发时先失败的步骤决定退出码",
+			config:     "[g parallel=true]\nexit 3\nsleep 0.3; exit 0\n",
+			wantErr:    true,
+			wantCode:   3,
+			wantStatus: statusFailed,
+		},
+		{
+			name:       "并发时后结束的失败不覆盖退出码",
+			config:     "[g parallel=true]\nexit 3\nsleep 0.3; exit 9\n",
+			wantErr:    true,
+			wantCode:   3,
+			wantStatus: statusFailed,
+		},
+		{
+			name:       "并发时 allow_failure 步骤不改变退出码",
+			config:     "[g parallel=true]\ntrue\n- sleep 0.3; exit 1\n",
+			wantStatus: statusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseConfig("[settings]\nshell = sh\n" + tt.config)
+			opts, err := newRunOptions(cfg, "g", cfg.Groups["g"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := &target{Dir: t.TempDir(), Weight: 1, buf: &lockedBuffer{}}
+			res := newDirResult(dir.Dir, opts)
+			err = runSteps(context.Background(), dir, opts.Env, opts, res)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if res.ExitCode != tt.wantCode {
+				t.Errorf("ExitCode = %d, want %d", res.ExitCode, tt.wantCode)
+			}
+			if res.Warnings != tt.wantWarnings {
+				t.Errorf("Warnings = %d, want %d", res.Warnings, tt.wantWarnings)
+			}
+
+			// 组在目录中的结果：状态与退出码一致
+			res = runGroupInDir(context.Background(), &target{Dir: dir.Dir, Weight: 1, buf: &lockedBuffer{}}, opts)
+			if res.Status != tt.wantStatus || res.ExitCode != tt.wantCode {
+				t.Errorf("runGroupInDir = %s exit %d, want %s exit %d", res.Status, res.ExitCode, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
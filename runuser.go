@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// user 设置：以该用户的身份执行命令，以 root 运行 runCmd 时为项目脚本降低权限。
+// 对 ssh、k8s 目标不生效；容器中执行时转为 docker 的 --user
+type runUser struct {
+	Name   string
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32 // 附加组
+	Home   string
+}
+
+// 按用户名或 uid 查找用户
+func lookupRunUser(name string) (*runUser, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			u, err = user.LookupId(name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无效的 user 配置 %q: %w", name, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("用户 %s 的 uid %q 不是数字，当前平台不支持 user 设置", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("用户 %s 的 gid %q 不是数字", name, u.Gid)
+	}
+	ru := &runUser{Name: u.Username, Uid: uint32(uid), Gid: uint32(gid), Home: u.HomeDir}
+	ids, _ := u.GroupIds()
+	for _, id := range ids {
+		if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+			ru.Groups = append(ru.Groups, uint32(g))
+		}
+	}
+	return ru, nil
+}
+
+// 本机执行时切换的用户，ssh、k8s 和容器目标为 nil
+func (opts *runOptions) localUser(t *target) *runUser {
+	if t.remote() || opts.Container != nil {
+		return nil
+	}
+	return opts.RunAs
+}
+
+// 启动失败的错误，切换了用户时带上用户名
+func startError(err error, t *target, opts *runOptions) error {
+	if u := opts.localUser(t); u != nil {
+		return fmt.Errorf("以用户 %s 启动失败: %w", u.Name, err)
+	}
+	return fmt.Errorf("启动失败: %w", err)
+}
+
+// 切换用户后覆盖的环境变量
+func (u *runUser) env() []string {
+	return []string{"HOME=" + u.Home, "USER=" + u.Name, "LOGNAME=" + u.Name}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sandbox 设置的取值
+const (
+	sandboxOff   = "off"
+	sandboxBwrap = "bwrap" // 用 bubblewrap 执行：目标目录可写，其余文件系统只读
+)
+
+// sandbox=bwrap 时的隔离参数
+type sandboxSpec struct {
+	Network  bool     // 是否保留网络，sandbox_network=false 时隔离
+	Writable []string // sandbox_writable 中额外可写的路径，如缓存目录
+}
+
+func parseSandbox(cfg *Config, group string) (*sandboxSpec, error) {
+	v, _ := cfg.groupSetting(group, "sandbox")
+	switch v {
+	case "", sandboxOff:
+		return nil, nil
+	case sandboxBwrap:
+	default:
+		return nil, fmt.Errorf("无效的 sandbox 配置 %q，可选 %s、%s", v, sandboxOff, sandboxBwrap)
+	}
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		return nil, fmt.Errorf("组 [%s] 配置了 sandbox=bwrap，但没有找到 bwrap（需要安装 bubblewrap）", group)
+	}
+	network, err := cfg.boolSetting(group, "sandbox_network", true)
+	if err != nil {
+		return nil, err
+	}
+	spec := &sandboxSpec{Network: network}
+	if w, ok := cfg.groupSetting(group, "sandbox_writable"); ok {
+		for _, p := range strings.Split(w, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				if rest, ok := strings.CutPrefix(p, "~/"); ok {
+					home, err := os.UserHomeDir()
+					if err != nil {
+						return nil, err
+					}
+					p = filepath.Join(home, rest)
+				}
+				spec.Writable = append(spec.Writable, p)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// 把本机命令包在 bwrap 中：根目录只读挂载，目标目录和 sandbox_writable 可写，
+// /tmp 为空的 tmpfs；runCmd 退出时沙箱内的进程一并结束
+func (s *sandboxSpec) wrap(ctx context.Context, c *exec.Cmd, dir string) *exec.Cmd {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	args := []string{"--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+	for _, p := range s.Writable {
+		args = append(args, "--bind-try", p, p)
+	}
+	args = append(args, "--bind", abs, abs, "--chdir", abs, "--die-with-parent")
+	if !s.Network {
+		args = append(args, "--unshare-net")
+	}
+	args = append(args, "--")
+	return exec.CommandContext(ctx, "bwrap", append(append(args, c.Path), c.Args[1:]...)...)
+}
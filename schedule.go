@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// schedule 设置的取值
+const (
+	scheduleLongestFirst = "longest_first" // 按历史耗时从长到短调度
+	scheduleOrder        = "order"         // 按命令行中的顺序调度（默认）
+	scheduleAlphabetical = "alphabetical"  // 按目录路径的字母顺序调度
+)
+
+// 估算耗时时最多读取的历史运行数
+const scheduleHistoryRuns = 50
+
+func parseScheduleSetting(v string) (string, error) {
+	switch v {
+	case "", scheduleOrder:
+		return scheduleOrder, nil
+	case scheduleLongestFirst, scheduleAlphabetical:
+		return v, nil
+	}
+	return "", fmt.Errorf("无效的 schedule 配置 %q，可选 %s、%s、%s", v, scheduleOrder, scheduleLongestFirst, scheduleAlphabetical)
+}
+
+// 从运行历史估算每个目录执行组链的耗时：各组取最近一次记录的耗时相加
+func historyDurations(cfg *Config, groups []string) map[string]time.Duration {
+	path, err := historyPath(cfg)
+	if err != nil || path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	db, err := openHistory(path)
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+
+	wanted := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		wanted[g] = true
+	}
+	seen := make(map[[2]string]bool)
+	out := make(map[string]time.Duration)
+	n := 0
+	_ = eachHistoryRun(db, func(run *historyRun) bool {
+		for _, r := range run.Results {
+			key := [2]string{filepath.Clean(r.Dir), r.Group}
+			if !wanted[r.Group] || seen[key] || r.Status == statusSkipped || r.Status == statusCancelled {
+				continue
+			}
+			seen[key] = true
+			out[key[0]] += msDuration(r.DurationMs)
+		}
+		n++
+		return n < scheduleHistoryRuns
+	})
+	return out
+}
+
+// 按 schedule 设置决定目标的调度顺序；优先级（priority）不同的目录由调度队列先按优先级排列，
+// 这里的顺序只决定同一优先级内的先后
+func scheduleTargets(cfg *Config, groups []string, targets []*target) ([]*target, error) {
+	mode, err := parseScheduleSetting(cfg.Settings["schedule"])
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case scheduleOrder:
+		return targets, nil
+	case scheduleAlphabetical:
+		ordered := append([]*target{}, targets...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return filepath.ToSlash(filepath.Clean(ordered[i].Dir)) < filepath.ToSlash(filepath.Clean(ordered[j].Dir))
+		})
+		return ordered, nil
+	}
+	return orderLongestFirst(targets, historyDurations(cfg, groups)), nil
+}
+
+// 按估算耗时从长到短排列目标；没有历史的目录排在最前面，其余保持原顺序
+func orderLongestFirst(targets []*target, durations map[string]time.Duration) []*target {
+	ordered := append([]*target{}, targets...)
+	if len(durations) == 0 {
+		return ordered
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		di, oki := durations[filepath.Clean(ordered[i].Dir)]
+		dj, okj := durations[filepath.Clean(ordered[j].Dir)]
+		if oki != okj {
+			return !oki
+		}
+		return di > dj
+	})
+	return ordered
+}
+
+// --shuffle[=SEED]：打乱调度顺序，暴露目录之间隐含的依赖，也让共用网络资源的目录错开；
+// 不写种子时随机生成，日志中打印种子以便复现同样的顺序
+type shuffleFlag struct {
+	on   bool
+	seed uint64
+}
+
+func (f *shuffleFlag) IsBoolFlag() bool { return true }
+
+func (f *shuffleFlag) String() string {
+	if f == nil || !f.on {
+		return ""
+	}
+	return strconv.FormatUint(f.seed, 10)
+}
+
+func (f *shuffleFlag) Set(v string) error {
+	switch v {
+	case "false":
+		f.on = false
+		return nil
+	case "true":
+		f.on, f.seed = true, rand.Uint64()
+		return nil
+	}
+	seed, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("--shuffle 的种子需要是非负整数: %s", v)
+	}
+	f.on, f.seed = true, seed
+	return nil
+}
+
+// 按种子打乱调度顺序；优先级（priority）不同的目录仍按优先级先后调度
+func shuffleTargets(targets []*target, seed uint64) []*target {
+	shuffled := append([]*target{}, targets...)
+	r := rand.New(rand.NewPCG(seed, seed))
+	r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return shuffled
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// [env] 中以 secret:// 开头的值在执行前从外部读取：
+//
+//	TOKEN = secret://env/CI_TOKEN            # runCmd 自身的环境变量
+//	DB_PASS = secret://vault/kv/ci#password  # vault kv get -field=password kv/ci
+//	API_KEY = secret://ssm/prod/api-key      # aws ssm get-parameter --name /prod/api-key
+//
+// 读到的值只传给子进程，并在所有输出和日志中遮盖
+const secretScheme = "secret://"
+
+// 同一个引用在一次运行中只读取一次
+var secretCache sync.Map
+
+func resolveSecret(ref string) (string, error) {
+	if v, ok := secretCache.Load(ref); ok {
+		return v.(string), nil
+	}
+	provider, path, _ := strings.Cut(ref, "/")
+	var v string
+	var err error
+	switch provider {
+	case "env":
+		var ok bool
+		if v, ok = os.LookupEnv(path); !ok {
+			err = fmt.Errorf("环境变量 %s 未设置", path)
+		}
+	case "vault":
+		p, field, ok := strings.Cut(path, "#")
+		if !ok || field == "" {
+			return "", fmt.Errorf("无效的密钥引用 %s%s，vault 需要写作 secret://vault/路径#字段", secretScheme, ref)
+		}
+		v, err = secretCommand("vault", "kv", "get", "-field="+field, p)
+	case "ssm":
+		v, err = secretCommand("aws", "ssm", "get-parameter", "--name", "/"+path, "--with-decryption", "--query", "Parameter.Value", "--output", "text")
+	default:
+		return "", fmt.Errorf("无效的密钥引用 %s%s，可选 env、vault、ssm", secretScheme, ref)
+	}
+	if err != nil {
+		return "", fmt.Errorf("读取密钥 %s%s 失败: %w", secretScheme, ref, err)
+	}
+	secretCache.Store(ref, v)
+	return v, nil
+}
+
+// 执行读取密钥的命令，返回去掉末尾换行的 stdout
+func secretCommand(name string, args ...string) (string, error) {
+	return secretCommandInput("", nil, name, args...)
+}
+
+// 同 secretCommand，stdin 为 input；env 为 nil 时继承当前环境
+func secretCommandInput(input string, env []string, name string, args ...string) (string, error) {
+	c := exec.Command(name, args...)
+	c.Stdin, c.Env = strings.NewReader(input), env
+	out, err := c.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// 组的环境中是否有需要在执行前读取的密钥
+func (c *Config) hasSecrets(group string) bool {
+	if len(c.Secrets) > 0 {
+		return true
+	}
+	for _, scope := range []string{"", group} {
+		for _, v := range c.Env[scope] {
+			if strings.Contains(v, secretScheme) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 延迟读取的密钥：newRunOptions 生成的环境中没有密钥变量，第一次在目录中执行前重新生成
+type lazySecrets struct {
+	once         sync.Once
+	err          error
+	cfg          *Config
+	clean        bool
+	envLen       int // buildEnv 生成的部分，之后追加的组参数、RUNCMD_ARGS 保留
+	configEnvLen int
+}
+
+// 读取密钥并补进组的环境和遮盖列表，同一组只执行一次；并发的目录等待同一次读取
+func (opts *runOptions) loadSecrets() error {
+	s := opts.secrets
+	if s == nil {
+		return nil
+	}
+	s.once.Do(func() {
+		env, vars, err := buildEnv(s.cfg, opts.Group, s.clean, true)
+		if err != nil {
+			s.err = err
+			return
+		}
+		values := make([]string, len(vars))
+		for i, kv := range vars {
+			_, values[i], _ = strings.Cut(kv, "=")
+		}
+		opts.ConfigEnv = append(configEnv(s.cfg, opts.Group, env, vars), opts.ConfigEnv[s.configEnvLen:]...)
+		opts.Env = append(env, opts.Env[s.envLen:]...)
+		opts.Mask = opts.Mask.withValues(values)
+	})
+	return s.err
+}
+
+// [secrets] 区块是 age 加密的内容时的首行
+const ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+
+// [secrets] 区块解密后的 KEY=VALUE，按区块内容缓存，一次运行只解密一次
+var decryptedSecrets sync.Map
+
+// 解密 [secrets] 区块：明文为 dotenv 格式，其中的变量加在 [env] 之后、[env:group] 之前。
+// 内容以 age 的 ASCII armor 开头时用 age -d 解密，身份文件依次取 age_identity 设置、
+// SOPS_AGE_KEY_FILE、SOPS_AGE_KEY（身份本身）和 ~/.config/sops/age/keys.txt；
+// 含 sops_version= 时按 sops 加密的 dotenv 用 sops -d 解密
+func (c *Config) secretEnv() ([]string, error) {
+	if len(c.Secrets) == 0 {
+		return nil, nil
+	}
+	block := strings.Join(c.Secrets, "\n") + "\n"
+	if v, ok := decryptedSecrets.Load(block); ok {
+		return v.([]string), nil
+	}
+	identity := c.Settings["age_identity"]
+	if rest, ok := strings.CutPrefix(identity, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		identity = filepath.Join(home, rest)
+	}
+	var plain string
+	var err error
+	switch {
+	case strings.HasPrefix(block, ageArmorHeader):
+		plain, err = decryptAge(block, identity)
+	case strings.Contains(block, "sops_version="):
+		plain, err = decryptSops(block, identity)
+	default:
+		return nil, errors.New("[secrets] 区块既不是 age 加密的内容（" + ageArmorHeader + "），也不是 sops 加密的 dotenv")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解密 [secrets] 失败: %w", err)
+	}
+	vars, err := parseDotenv(strings.NewReader(plain))
+	if err != nil {
+		return nil, fmt.Errorf("解密后的 [secrets] 不是有效的 dotenv: %w", err)
+	}
+	decryptedSecrets.Store(block, vars)
+	return vars, nil
+}
+
+func decryptAge(block, identity string) (string, error) {
+	if identity == "" {
+		identity = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+	if identity == "" {
+		if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+			f, err := os.CreateTemp("", "runcmd-age-*.txt")
+			if err != nil {
+				return "", err
+			}
+			defer os.Remove(f.Name())
+			_, err = f.WriteString(key + "\n")
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return "", err
+			}
+			identity = f.Name()
+		}
+	}
+	if identity == "" {
+		cfgDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		identity = filepath.Join(cfgDir, "sops", "age", "keys.txt")
+	}
+	return secretCommandInput(block, nil, "age", "--decrypt", "-i", identity)
+}
+
+// sops 需要从文件读取，明文不落盘，只有密文写入临时文件
+func decryptSops(block, identity string) (string, error) {
+	f, err := os.CreateTemp("", "runcmd-secrets-*.env")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(block)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	var env []string
+	if identity != "" {
+		env = append(os.Environ(), "SOPS_AGE_KEY_FILE="+identity)
+	}
+	return secretCommandInput("", env, "sops", "--decrypt", "--input-type", "dotenv", "--output-type", "dotenv", f.Name())
+}
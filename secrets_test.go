@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("RUNCMD_TEST_SECRET", "s3cr3t")
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "env/RUNCMD_TEST_SECRET", want: "s3cr3t"},
+		{ref: "env/RUNCMD_TEST_UNSET", wantErr: "未设置"},
+		{ref: "vault/kv/ci", wantErr: "路径#字段"},
+		{ref: "gcp/x", wantErr: "可选 env、vault、ssm"},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.ref)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveSecret(%q) err = %v, want %q", tt.ref, err, tt.wantErr)
+			}
+		case err != nil || got != tt.want:
+			t.Errorf("resolveSecret(%q) = %q, %v, want %q", tt.ref, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// serve 模式的默认监听地址，只监听本机
+const defaultServeAddr = "127.0.0.1:8080"
+
+// 排队中的运行数上限
+const serveQueueSize = 100
+
+// 内嵌的网页面板
+//
+//go:embed web/index.html
+var dashboardHTML []byte
+
+// 服务端运行的状态
+const (
+	runQueued    = "queued"
+	runRunning   = "running"
+	runFinished  = "finished"
+	runCancelled = "cancelled"
+	runError     = "error"
+)
+
+// 一次运行的输出，支持多个客户端边写边读
+type runLog struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+	notify chan struct{} // 有新内容或结束时关闭并替换
+}
+
+func newRunLog() *runLog {
+	return &runLog{notify: make(chan struct{})}
+}
+
+func (l *runLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.buf.Write(p)
+	close(l.notify)
+	l.notify = make(chan struct{})
+	return n, err
+}
+
+func (l *runLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.notify)
+	}
+}
+
+// 读取 off 之后的内容，返回新内容、是否已结束以及下次等待用的通道
+func (l *runLog) readFrom(off int) ([]byte, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data := append([]byte{}, l.buf.Bytes()[off:]...)
+	return data, l.closed, l.notify
+}
+
+// POST /run 的请求体
+type runRequest struct {
+	Group    string   `json:"group"`
+	Dirs     []string `json:"dirs"`
+	FailFast bool     `json:"fail_fast"`
+	Confirm  string   `json:"confirm"` // 需要确认的组名，逗号分隔
+}
+
+// 服务端的一次运行
+type serverRun struct {
+	req    runRequest
+	id     string
+	output *runLog
+
+	mu       sync.Mutex
+	status   string
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	err      string
+	report   *jsonReport
+	progress map[string]*dirProgress // 执行中各目录的实时状态
+	dirOrder []string
+	cancel   context.CancelCauseFunc
+	stopped  bool // 开始前就被取消
+}
+
+// 执行中目录的实时状态
+type dirProgress struct {
+	Dir        string    `json:"dir"`
+	Group      string    `json:"group"`
+	Status     string    `json:"status"` // 执行中为 RUNNING
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// 接口返回的运行信息
+type runView struct {
+	ID         string        `json:"id"`
+	Group      string        `json:"group"`
+	Dirs       []string      `json:"dirs"`
+	Status     string        `json:"status"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Progress   []dirProgress `json:"progress,omitempty"`
+	Report     *jsonReport   `json:"report,omitempty"`
+}
+
+func (r *serverRun) view() runView {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := runView{ID: r.id, Group: r.req.Group, Dirs: r.req.Dirs, Status: r.status, CreatedAt: r.created, Error: r.err, Report: r.report}
+	if !r.started.IsZero() {
+		started := r.started
+		v.StartedAt = &started
+	}
+	if !r.finished.IsZero() {
+		finished := r.finished
+		v.FinishedAt = &finished
+	}
+	for _, dir := range r.dirOrder {
+		p := *r.progress[dir]
+		if p.Status == "RUNNING" {
+			p.DurationMs = time.Since(p.StartedAt).Milliseconds()
+		}
+		v.Progress = append(v.Progress, p)
+	}
+	return v
+}
+
+// 根据运行事件更新目录的实时状态
+func (r *serverRun) apply(ev runEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.progress[ev.Dir]
+	if p == nil {
+		p = &dirProgress{Dir: ev.Dir}
+		r.progress[ev.Dir] = p
+		r.dirOrder = append(r.dirOrder, ev.Dir)
+	}
+	switch ev.Kind {
+	case eventDirStarted:
+		p.Group, p.Status, p.StartedAt = ev.Group, "RUNNING", time.Now()
+	case eventDirFinished:
+		p.Group, p.Status = ev.Group, ev.Result.Status
+		p.DurationMs = ev.Result.Duration.Milliseconds()
+	}
+}
+
+// 常驻服务：配置只在启动时加载一次，运行按提交顺序逐个执行
+type server struct {
+	cfg   *Config
+	queue chan *serverRun
+
+	mu      sync.Mutex
+	runs    map[string]*serverRun
+	order   []string
+	nextID  int
+	current *serverRun // 正在执行的运行
+	metrics *serverMetrics
+	token   string // 非空时 POST 接口要求 Authorization: Bearer <token>
+}
+
+func newServer(cfg *Config) *server {
+	s := &server{cfg: cfg, queue: make(chan *serverRun, serveQueueSize), runs: make(map[string]*serverRun), token: os.Getenv("RUNCMD_SERVE_TOKEN")}
+	s.metrics = newServerMetrics(s)
+	return s
+}
+
+func (s *server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("POST /run", s.guard(s.handleRun))
+	mux.HandleFunc("GET /runs", s.handleList)
+	mux.HandleFunc("GET /runs/{id}", s.handleGet)
+	mux.HandleFunc("GET /runs/{id}/output", s.handleOutput)
+	mux.HandleFunc("GET /runs/{id}/events", s.handleEvents)
+	mux.HandleFunc("POST /runs/{id}/cancel", s.guard(s.handleCancel))
+	mux.Handle("GET /metrics", s.metrics.handler())
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) *serverRun {
+	s.mu.Lock()
+	run := s.runs[r.PathValue("id")]
+	s.mu.Unlock()
+	if run == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("运行 %s 不存在", r.PathValue("id")))
+	}
+	return run
+}
+
+// 会触发操作的接口：拒绝其他网站发来的请求（Origin 与 Host 不同），
+// 设置了 RUNCMD_SERVE_TOKEN 时还要求匹配的 Bearer token
+func (s *server) guard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeError(w, http.StatusForbidden, fmt.Errorf("拒绝来自 %s 的跨站请求", origin))
+				return
+			}
+		}
+		if s.token != "" {
+			auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, errors.New("缺少或错误的 token"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (s *server) handleRun(w http.ResponseWriter, r *http.Request) {
+	// 只接受 JSON，浏览器跨站发送 JSON 需要预检，服务不响应预检
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, errors.New("请求体必须是 application/json"))
+		return
+	}
+	var req runRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("无效的请求: %w", err))
+		return
+	}
+	if strings.TrimSpace(req.Group) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("group 不能为空"))
+		return
+	}
+	if len(req.Dirs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("dirs 不能为空"))
+		return
+	}
+	// 提交时先检查组是否存在，避免排队后才失败
+	names, err := s.cfg.resolveGroupChain(strings.Split(req.Group, ","))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// 与命令行的确认相同：confirm=true 或 protected_groups 中的组必须在 confirm 中写出组名
+	protected, err := protectedGroups(s.cfg, names)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	confirmed := splitTags(req.Confirm)
+	for _, name := range protected {
+		if !slices.Contains(confirmed, name) {
+			writeJSON(w, http.StatusForbidden, map[string]any{
+				"error":     fmt.Sprintf("组 [%s] 需要确认，请在 confirm 中写出组名", strings.Join(protected, "], [")),
+				"protected": protected,
+			})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	run := &serverRun{req: req, id: strconv.Itoa(s.nextID), output: newRunLog(), status: runQueued, created: time.Now(), progress: make(map[string]*dirProgress)}
+	select {
+	case s.queue <- run:
+		s.runs[run.id] = run
+		s.order = append(s.order, run.id)
+		s.mu.Unlock()
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, errors.New("排队的运行过多，请稍后再试"))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.view())
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	views := make([]runView, 0, len(s.order))
+	for _, id := range s.order {
+		views = append(views, s.runs[id].view())
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *server) handleGet(w http.ResponseWriter, r *http.Request) {
+	if run := s.lookup(w, r); run != nil {
+		writeJSON(w, http.StatusOK, run.view())
+	}
+}
+
+// 以纯文本流式返回运行输出，运行结束后关闭连接；?follow=false 时只返回当前内容
+func (s *server) handleOutput(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	follow := r.URL.Query().Get("follow") != "false"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	off := 0
+	for {
+		data, closed, notify := run.output.readFrom(off)
+		off += len(data)
+		if len(data) > 0 {
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if closed || !follow {
+			return
+		}
+		select {
+		case <-notify:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardHTML)
+}
+
+// 以 SSE 推送运行输出：output 事件的 data 为 {"text": "..."}，结束时发送 done 事件
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("不支持流式响应"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	off := 0
+	for {
+		data, closed, notify := run.output.readFrom(off)
+		off += len(data)
+		if len(data) > 0 {
+			chunk, _ := json.Marshal(map[string]string{"text": string(data)})
+			if _, err := fmt.Fprintf(w, "event: output\ndata: %s\n\n", chunk); err != nil {
+				return
+			}
+		}
+		if closed {
+			fmt.Fprintf(w, "event: done\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-notify:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// 运行事件转给正在执行的运行
+func (s *server) onEvent(ev runEvent) {
+	if ev.Kind == eventLine {
+		return
+	}
+	s.metrics.observe(ev)
+	s.mu.Lock()
+	run := s.current
+	s.mu.Unlock()
+	if run != nil {
+		run.apply(ev)
+	}
+}
+
+func (s *server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	run := s.lookup(w, r)
+	if run == nil {
+		return
+	}
+	run.mu.Lock()
+	switch {
+	case run.cancel != nil:
+		run.cancel(errUserCancelled)
+	case run.status == runQueued:
+		run.stopped = true
+	}
+	run.mu.Unlock()
+	writeJSON(w, http.StatusOK, run.view())
+}
+
+// 逐个执行排队的运行，ctx 结束时取消正在执行的运行并返回
+func (s *server) work(ctx context.Context) {
+	for {
+		select {
+		case run := <-s.queue:
+			s.execute(ctx, run)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *server) execute(parent context.Context, run *serverRun) {
+	defer run.output.Close()
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+
+	run.mu.Lock()
+	if run.stopped {
+		run.status, run.finished = runCancelled, time.Now()
+		run.mu.Unlock()
+		return
+	}
+	run.status, run.started, run.cancel = runRunning, time.Now(), cancel
+	run.mu.Unlock()
+	s.metrics.runsStarted.WithLabelValues(run.req.Group).Inc()
+
+	s.mu.Lock()
+	s.current = run
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.current = nil
+		s.mu.Unlock()
+	}()
+
+	// 运行逐个执行，期间把全局输出切换到该运行的日志
+	out := logOut
+	logOut = run.output
+	defer func() { logOut = out }()
+
+	report, err := s.runOnce(ctx, cancel, run.req)
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.cancel, run.finished, run.report = nil, time.Now(), report
+	switch {
+	case err != nil:
+		fmt.Fprintln(run.output, err)
+		run.status, run.err = runError, err.Error()
+	case ctx.Err() != nil:
+		run.status = runCancelled
+	default:
+		run.status = runFinished
+	}
+	s.metrics.runFinished(run.req.Group, run.status, report)
+}
+
+// 执行一次运行，流程与命令行模式相同
+func (s *server) runOnce(ctx context.Context, cancel context.CancelCauseFunc, req runRequest) (*jsonReport, error) {
+	names, err := s.cfg.resolveGroupChain(strings.Split(req.Group, ","))
+	if err != nil {
+		return nil, err
+	}
+	chain, concurrency, err := newRunChain(s.cfg, names)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := resolveTargetDirs(s.cfg, req.Dirs, false, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, errors.New("没有找到需要执行的目录")
+	}
+	failFast := req.FailFast
+	if !failFast {
+		if failFast, err = chainFailFast(s.cfg, names); err != nil {
+			return nil, err
+		}
+	}
+
+	maxRunTime, err := parseMaxRunTime(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if maxRunTime > 0 {
+		var stopDeadline context.CancelFunc
+		ctx, stopDeadline = context.WithTimeoutCause(ctx, maxRunTime, errMaxRunTime)
+		defer stopDeadline()
+	}
+
+	start := time.Now()
+	ctx, span := startRunSpan(ctx, strings.Join(names, ","), len(dirs))
+	defer span.End()
+	targets := newTargets(dirs)
+	if err := applyHosts(s.cfg, targets); err != nil {
+		return nil, err
+	}
+	if err := checkChainLimits(chain, targets); err != nil {
+		return nil, err
+	}
+	if err := assignWeights(s.cfg, names, targets, concurrency); err != nil {
+		return nil, err
+	}
+	if err := assignDepends(s.cfg, targets); err != nil {
+		return nil, err
+	}
+	if err := assignPriority(s.cfg, targets); err != nil {
+		return nil, err
+	}
+	b := newBatch(targets, chain, concurrency, failFast)
+	if b.order, err = scheduleTargets(s.cfg, names, targets); err != nil {
+		return nil, err
+	}
+	if b.throttle, err = newLoadThrottle(s.cfg, names); err != nil {
+		return nil, err
+	}
+	if b.failures, err = parseFailureLimit(s.cfg); err != nil {
+		return nil, err
+	}
+	// 钩子与命令行模式相同；运行逐个执行，结束后恢复
+	hooks, err := newHookSet(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	prevHooks := activeHooks
+	activeHooks = hooks
+	defer func() { activeHooks = prevHooks }()
+	if err := hooks.runGlobal(ctx, "pre_run", "GROUP", strings.Join(names, ",")); err != nil {
+		return nil, err
+	}
+	b.start(ctx, cancel)
+	b.wait()
+	results := b.results()
+	printSummaryTable(logOut, results)
+	if ctx.Err() != nil {
+		printCancelSummary(results, context.Cause(ctx))
+	}
+	elapsed := time.Since(start)
+	rep := newJSONReport(strings.Join(names, ","), results, elapsed)
+	endRunSpan(span, rep)
+	recordHistory(s.cfg, dirs, start, rep)
+	sendNotifications(context.Background(), s.cfg, rep)
+	var failed []string
+	for _, r := range results {
+		if !r.succeeded() && !slices.Contains(failed, r.Dir) {
+			failed = append(failed, r.Dir)
+		}
+	}
+	if err := hooks.runGlobal(context.Background(), "post_run", "GROUP", rep.Group,
+		"STATUS", runStatusText(rep.OK), "DURATION", seconds(elapsed), "FAILED", strings.Join(failed, ",")); err != nil {
+		logger.Warn(err.Error(), "phase", "hook")
+	}
+	return &rep, nil
+}
+
+// runCmd serve：常驻并通过 HTTP 接口触发运行
+//
+//	POST /run                {"group": "build", "dirs": ["./a", "./b"]}
+//	GET  /runs               运行列表
+//	GET  /runs/{id}          运行状态与汇总
+//	GET  /                   网页面板
+//	GET  /runs/{id}/output   流式输出
+//	GET  /runs/{id}/events   SSE 推送输出
+//	POST /runs/{id}/cancel   取消运行
+//
+// POST 接口只接受同源请求，设置了环境变量 RUNCMD_SERVE_TOKEN 时还要求 Bearer token；
+// 需要确认的组要在请求中写 "confirm": "deploy"
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addConfigFlag(fs)
+	addr := fs.String("addr", "", "监听地址，默认读取 serve_addr 设置或 "+defaultServeAddr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: ./runCmd serve [flags]")
+		fs.PrintDefaults()
+	}
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitConfigError
+	}
+	modes, err := parseOutputModes(cfg.Settings["output"])
+	if err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitConfigError
+	}
+	bufferedOutput = modes.Buffered
+	if bufferMemoryLimit, err = parseBufferMemory(cfg); err != nil {
+		fmt.Fprintln(logOut, err)
+		return exitConfigError
+	}
+	setupColor(true, logOut)
+
+	listen := *addr
+	if listen == "" {
+		listen = cfg.Settings["serve_addr"]
+	}
+	if listen == "" {
+		listen = defaultServeAddr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := newServer(cfg)
+	onEvent(s.onEvent)
+	srv := &http.Server{Addr: listen, Handler: s.routes()}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.work(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "runCmd serve 正在监听 http://%s（浏览器打开即可查看面板）\n", listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "启动服务失败: %v\n", err)
+		return exitUsage
+	}
+	<-done
+	return exitOK
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleRunRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		body    string
+		headers map[string]string
+		want    int
+	}{
+		{"没有 Content-Type", "", `{"group":"build","dirs":["./a"]}`, nil, http.StatusUnsupportedMediaType},
+		{"text/plain", "", `{"group":"build","dirs":["./a"]}`, map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"跨站请求", "", `{"group":"build","dirs":["./a"]}`, map[string]string{"Content-Type": "application/json", "Origin": "https://evil.example.com"}, http.StatusForbidden},
+		{"缺少 token", "s3cr3t", `{"group":"build","dirs":["./a"]}`, map[string]string{"Content-Type": "application/json"}, http.StatusUnauthorized},
+		{"错误的 token", "s3cr3t", `{"group":"build","dirs":["./a"]}`, map[string]string{"Content-Type": "application/json", "Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		{"空组", "", `{"group":"","dirs":["./a"]}`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest},
+		{"只有逗号", "", `{"group":" , ","dirs":["./a"]}`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest},
+		{"未知组", "", `{"group":"deploy","dirs":["./a"]}`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest},
+		{"没有目录", "", `{"group":"build"}`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(parseConfig("[build]\necho hi\n"))
+			s.token = tt.token
+			req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("状态码 = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if len(s.queue) != 0 {
+				t.Fatalf("被拒绝的请求不应排队")
+			}
+		})
+	}
+}
+
+func TestHandleRunAccepts(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		headers map[string]string
+	}{
+		{"同源", "", map[string]string{"Content-Type": "application/json; charset=utf-8", "Origin": "http://example.com"}},
+		{"没有 Origin", "", map[string]string{"Content-Type": "application/json"}},
+		{"正确的 token", "s3cr3t", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer s3cr3t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(parseConfig("[build]\necho hi\n"))
+			s.token = tt.token
+			req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"group":"build","dirs":["./a"]}`))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, req)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("状态码 = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+			}
+			if len(s.queue) != 1 {
+				t.Fatalf("排队的运行数 = %d, want 1", len(s.queue))
+			}
+		})
+	}
+}
+
+func TestHandleRunProtected(t *testing.T) {
+	config := "[settings]\nprotected_groups = clean\n[build]\necho hi\n[deploy confirm=true]\necho deploy\n[clean]\necho clean\n"
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"普通组", `{"group":"build","dirs":["./a"]}`, http.StatusAccepted},
+		{"confirm=true 未确认", `{"group":"deploy","dirs":["./a"]}`, http.StatusForbidden},
+		{"protected_groups 未确认", `{"group":"build,clean","dirs":["./a"]}`, http.StatusForbidden},
+		{"确认错误的组", `{"group":"deploy","dirs":["./a"],"confirm":"build"}`, http.StatusForbidden},
+		{"只确认了一部分", `{"group":"deploy,clean","dirs":["./a"],"confirm":"deploy"}`, http.StatusForbidden},
+		{"已确认", `{"group":"deploy,clean","dirs":["./a"],"confirm":"clean, deploy"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(parseConfig(config))
+			s.token = ""
+			req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			s.routes().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("状态码 = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRunOnceHooks(t *testing.T) {
+	dir := cliWorkdir(t, "")
+	t.Chdir(dir)
+	config := "[hooks]\npre_run = echo \"pre $RUNCMD_GROUP\" >> hooks.log\npre_dir = echo \"dir $RUNCMD_DIR\" >> ../hooks.log\npost_run = echo \"post $RUNCMD_STATUS\" >> hooks.log\n[build]\necho hi\n"
+	s := newServer(parseConfig(config))
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	out := logOut
+	logOut = io.Discard
+	defer func() { logOut = out }()
+	rep, err := s.runOnce(ctx, cancel, runRequest{Group: "build", Dirs: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK {
+		t.Fatalf("运行失败: %+v", rep)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "hooks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "pre build\ndir a\npost OK\n"; got != want {
+		t.Fatalf("钩子输出 = %q, want %q", got, want)
+	}
+	if activeHooks != nil {
+		t.Fatalf("运行结束后应恢复 activeHooks")
+	}
+}
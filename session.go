@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// 默认的最大并发数
+const defaultConcurrency = 3
+
+// 加载配置：先内嵌配置，再用按查找顺序找到的外部配置覆盖（见 findConfigFile），
+// 然后依次叠加 --profile 和命令行的 -s 覆盖
+func loadConfig() (*Config, error) {
+	data, _ := embeddedConfig.ReadFile("config.txt")
+	cfg := parseConfig(string(data))
+	cfg.setSource("embedded")
+
+	name, from, err := findConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		logger.Info("未找到外部配置，使用内嵌默认配置", "config", "embedded")
+	} else {
+		logger.Info(fmt.Sprintf("检测到外部配置 %s（%s），将覆盖默认配置", name, from), "config", name, "config_source", from)
+		var override *Config
+		if isConfigURL(name) {
+			override, err = readConfigURL(name)
+		} else {
+			override, err = readConfigFile(name, nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("加载外部配置 %s 失败: %w", name, err)
+		}
+		// extends_url：外部配置叠加在远程的团队配置之上
+		if u := override.Settings["extends_url"]; u != "" {
+			if !isConfigURL(u) {
+				return nil, fmt.Errorf("无效的 extends_url 配置 %q，需要 http:// 或 https:// 地址", u)
+			}
+			base, err := readConfigURL(u)
+			if err != nil {
+				return nil, fmt.Errorf("加载 extends_url 配置失败: %w", err)
+			}
+			cfg = mergeConfig(cfg, base)
+		}
+		cfg = mergeConfig(cfg, override)
+	}
+	if profileFlag != "" {
+		if err := cfg.applyProfile(profileFlag); err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("使用 profile %s", profileFlag), "profile", profileFlag)
+	}
+	// 先继承再应用命令行覆盖，-s key.child 才能覆盖从父组继承来的选项
+	if err := cfg.resolveExtends(); err != nil {
+		return nil, err
+	}
+	if len(settingFlags) > 0 {
+		cfg.applyOverrides(settingFlags)
+		logger.Info("命令行覆盖设置: "+settingFlags.String(), "overrides", settingFlags.String())
+	}
+
+	if err := cfg.expandIncludes(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// 生成组链中各组的执行参数，并发数默认 3，可按组覆盖（auto 为 CPU 核数）；组链取各组中最小的值
+func newRunChain(cfg *Config, names []string) ([]*runOptions, int, error) {
+	concurrency := 0
+	chain := make([]*runOptions, 0, len(names))
+	for _, name := range names {
+		n := defaultConcurrency
+		if v, ok := cfg.groupSetting(name, "concurrency"); ok && v == "auto" {
+			n = runtime.NumCPU()
+		} else if ok {
+			if v, err := strconv.Atoi(v); err == nil && v > 0 {
+				n = v
+			}
+		}
+		if concurrency == 0 || n < concurrency {
+			concurrency = n
+		}
+		h, err := cfg.intSetting(name, "host_concurrency", 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if h > 0 && (hostConcurrency == 0 || h < hostConcurrency) {
+			hostConcurrency = h
+		}
+
+		opts, err := newRunOptions(cfg, name, cfg.Groups[name])
+		if err != nil {
+			return nil, 0, err
+		}
+		chain = append(chain, opts)
+	}
+	return chain, concurrency, nil
+}
+
+// 资源限制只对本机进程生效：有本机目标时才检查 nice、ionice 和 cgroup。
+// 在 dry-run 之后调用，避免只打印脚本或只有 ssh、k8s 目标时移动 runCmd 自身的 cgroup
+func checkChainLimits(chain []*runOptions, targets []*target) error {
+	if !slices.ContainsFunc(targets, func(t *target) bool { return !t.remote() }) {
+		return nil
+	}
+	for _, opts := range chain {
+		if opts.Container != nil {
+			continue
+		}
+		if err := opts.Limits.check(); err != nil {
+			return fmt.Errorf("组 [%s] %w", opts.Group, err)
+		}
+	}
+	return nil
+}
+
+// 把命令行中的目录参数展开为最终的目录列表（目录集合、通配符、k8s 选择器、递归扫描）
+func resolveTargetDirs(cfg *Config, args []string, recursive bool, match string) ([]string, error) {
+	dirs, err := resolveDirSets(cfg, args)
+	if err == nil {
+		dirs, err = expandDirArgs(dirs)
+	}
+	if err == nil {
+		var kubectlOpts []string
+		if kubectlOpts, err = splitArgs(cfg.Settings["kubectl_options"]); err == nil {
+			dirs, err = expandK8sTargets(dirs, kubectlOpts)
+		}
+	}
+	if err == nil && recursive {
+		dirs, err = scanDirs(dirs, match)
+	}
+	return dirs, err
+}
+
+// 组链中任一组配置了 fail_fast=true 即开启
+func chainFailFast(cfg *Config, names []string) (bool, error) {
+	for _, name := range names {
+		on, err := cfg.boolSetting(name, "fail_fast", false)
+		if err != nil || on {
+			return on, err
+		}
+	}
+	return false, nil
+}
+
+// 整个运行的时长上限，0 表示不限制
+func parseMaxRunTime(cfg *Config) (time.Duration, error) {
+	v, ok := cfg.Settings["max_run_time"]
+	if !ok {
+		return 0, nil
+	}
+	d, err := parseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的 max_run_time 配置 %q", v)
+	}
+	return d, nil
+}
+
+// 一次运行：按并发上限在所有目标上执行组链
+type batch struct {
+	targets  []*target
+	order    []*target // 调度顺序，默认与 targets 相同
+	chain    []*runOptions
+	worker   *semaphore.Weighted // 按目标权重占用并发名额
+	failFast bool
+	throttle *loadThrottle // concurrency=auto 时按系统负载暂停调度
+	failures failureLimit  // 失败的目录达到上限后不再调度剩余目录
+
+	failed  atomic.Int64 // 已失败的目录数
+	tripped atomic.Bool  // 已达到 failures 上限
+
+	concurrency int // worker 数
+
+	wg       sync.WaitGroup
+	queued   atomic.Int64 // 还未调度的目录数
+	running  atomic.Int64 // 已占用名额、正在执行的目录数
+	finished atomic.Int64
+	perDir   [][]*dirResult
+}
+
+func newBatch(targets []*target, chain []*runOptions, concurrency int, failFast bool) *batch {
+	concurrency = max(concurrency, 1)
+	return &batch{
+		targets:     targets,
+		order:       targets,
+		chain:       chain,
+		worker:      semaphore.NewWeighted(int64(concurrency)),
+		failFast:    failFast,
+		concurrency: concurrency,
+		perDir:      make([][]*dirResult, len(targets)),
+	}
+}
+
+// 启动调度和 worker 池：worker 数为并发上限（不超过目录数，至少 1 个），fail-fast 时任一目录失败即以 errFailFast 取消 ctx
+func (b *batch) start(ctx context.Context, cancel context.CancelCauseFunc) {
+	b.wg.Add(len(b.order))
+	b.queued.Store(int64(len(b.order)))
+	done := make(chan *target, len(b.order))
+	jobs := make(chan dispatched)
+	for range max(1, min(b.concurrency, len(b.order))) {
+		go b.work(ctx, cancel, jobs, done)
+	}
+	go b.dispatch(ctx, jobs, done)
+}
+
+func (b *batch) wait() {
+	b.wg.Wait()
+}
+
+// 按目标顺序展开的全部结果，需在 wait 之后调用
+func (b *batch) results() []*dirResult {
+	var out []*dirResult
+	for _, rs := range b.perDir {
+		out = append(out, rs...)
+	}
+	return out
+}
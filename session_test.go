@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestCheckChainLimits(t *testing.T) {
+	// 找不到 nice 命令时，只有本机执行的组才报错
+	t.Setenv("PATH", t.TempDir())
+	nice := &runOptions{Group: "build", Limits: resourceLimits{Nice: 5}}
+	tests := []struct {
+		name    string
+		chain   []*runOptions
+		targets []*target
+		wantErr bool
+	}{
+		{"本机目标", []*runOptions{nice}, []*target{{Dir: "a"}}, true},
+		{"本机和远程目标", []*runOptions{nice}, []*target{{Dir: "a"}, {Dir: "b", Host: "web1"}}, true},
+		{"只有 ssh 目标", []*runOptions{nice}, []*target{{Dir: "a", Host: "web1"}}, false},
+		{"只有 k8s 目标", []*runOptions{nice}, []*target{{Dir: "a", Pod: "api-0"}}, false},
+		{"容器中执行", []*runOptions{{Group: "build", Limits: resourceLimits{Nice: 5}, Container: &containerSpec{}}}, []*target{{Dir: "a"}}, false},
+		{"没有限制", []*runOptions{{Group: "build"}}, []*target{{Dir: "a"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkChainLimits(tt.chain, tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkChainLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDryRunSkipsLimits(t *testing.T) {
+	dir := cliWorkdir(t, "[build nice=5]\necho hi\n")
+	t.Setenv("PATH", t.TempDir())
+	if _, stderr, code := runCLI(t, dir, "--dry-run", "build", "a"); code != exitOK {
+		t.Fatalf("退出码 = %d, want %d: %s", code, exitOK, stderr)
+	}
+}
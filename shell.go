@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// 执行脚本所用的解释器
+type shellSpec struct {
+	Name string
+	Argv []string // 脚本作为最后一个参数追加
+	Join string   // 多条命令的连接方式
+}
+
+// 内置的解释器
+var builtinShells = map[string]shellSpec{
+	"sh":         {Name: "sh", Argv: []string{"sh", "-c"}, Join: "\n"},
+	"bash":       {Name: "bash", Argv: []string{"bash", "-c"}, Join: "\n"},
+	"zsh":        {Name: "zsh", Argv: []string{"zsh", "-c"}, Join: "\n"},
+	"cmd":        {Name: "cmd", Argv: []string{"cmd", "/C"}, Join: " & "},
+	"powershell": {Name: "powershell", Argv: []string{"powershell", "-NoProfile", "-NonInteractive", "-Command"}, Join: "; "},
+	"pwsh":       {Name: "pwsh", Argv: []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command"}, Join: "; "},
+}
+
+// 当前平台的默认解释器：Windows 用 cmd，其余用 sh
+func defaultShellName() string {
+	if runtime.GOOS == "windows" {
+		return "cmd"
+	}
+	return "sh"
+}
+
+// 根据 shell 设置选择解释器，支持附加参数（bash -euo pipefail）
+// 或任意解释器（python3 -c），未写执行参数时默认追加 -c
+func resolveShell(value string) (shellSpec, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		fields = []string{defaultShellName()}
+	}
+	prog, extra := fields[0], fields[1:]
+	base := strings.TrimSuffix(strings.ToLower(filepath.Base(prog)), ".exe")
+
+	if spec, ok := builtinShells[base]; ok {
+		execFlag := spec.Argv[len(spec.Argv)-1]
+		if len(extra) > 0 && strings.EqualFold(extra[len(extra)-1], execFlag) {
+			extra = extra[:len(extra)-1]
+		}
+		argv := append([]string{prog}, spec.Argv[1:len(spec.Argv)-1]...)
+		argv = append(append(argv, extra...), execFlag)
+		return shellSpec{Name: spec.Name, Argv: argv, Join: spec.Join}, nil
+	}
+
+	if len(extra) == 0 {
+		extra = []string{"-c"}
+	}
+	if _, err := exec.LookPath(prog); err != nil {
+		return shellSpec{}, fmt.Errorf("找不到 shell 解释器 %q: %w", prog, err)
+	}
+	return shellSpec{Name: base, Argv: append([]string{prog}, extra...), Join: "\n"}, nil
+}
+
+// 命令行展示形式，如 sh -c
+func (s shellSpec) String() string {
+	return strings.Join(s.Argv, " ")
+}
+
+// 在解释器中执行脚本的完整参数，args 作为脚本的位置参数追加（sh 类为 $1 $2 ...）；
+// cmd 和 PowerShell 不支持，只能从 RUNCMD_ARGS 读取
+func (s shellSpec) scriptArgv(script string, args []string) []string {
+	argv := append(append([]string{}, s.Argv...), script)
+	switch {
+	case len(args) == 0 || s.Name == "cmd" || s.Name == "powershell" || s.Name == "pwsh":
+		return argv
+	case strings.HasSuffix(s.Name, "sh"):
+		argv = append(argv, "runCmd") // $0
+	}
+	return append(argv, args...)
+}
+
+// 按解释器的规则给模板变量的值加引号，只含安全字符时原样返回
+func (s shellSpec) quote(v string) string {
+	if v != "" && strings.Trim(v, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./=:@,+") == "" {
+		return v
+	}
+	switch s.Name {
+	case "cmd":
+		return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+	case "powershell", "pwsh":
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return shellQuote(v)
+}
+
+// 构造在解释器中执行脚本的命令
+func (s shellSpec) command(ctx context.Context, script string, args []string) *exec.Cmd {
+	argv := s.scriptArgv(script, args)
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	setShellCmdLine(c, s, script)
+	return c
+}
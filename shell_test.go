@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScriptArgv(t *testing.T) {
+	tests := []struct {
+		shell string
+		args  []string
+		want  []string
+	}{
+		{"sh", nil, []string{"sh", "-c", "echo hi"}},
+		{"bash", []string{"a b", "c"}, []string{"bash", "-c", "echo hi", "runCmd", "a b", "c"}},
+		{"cmd", []string{"a"}, []string{"cmd", "/C", "echo hi"}},
+		{"pwsh", []string{"a"}, []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}},
+		{"python3", []string{"a"}, []string{"python3", "-c", "echo hi", "a"}},
+	}
+	for _, tt := range tests {
+		sh, err := resolveShell(tt.shell)
+		if err != nil {
+			t.Fatalf("resolveShell(%q): %v", tt.shell, err)
+		}
+		if got := sh.scriptArgv("echo hi", tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: scriptArgv = %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+}
+
+func TestShellSpecQuote(t *testing.T) {
+	tests := []struct {
+		shell string
+		in    string
+		want  string
+	}{
+		{"sh", "./svc/api", "./svc/api"},
+		{"sh", "a b", "'a b'"},
+		{"bash", "x; rm -rf ~", "'x; rm -rf ~'"},
+		{"sh", "$(id)", "'$(id)'"},
+		{"sh", "it's", `'it'\''s'`},
+		{"sh", "", "''"},
+		{"cmd", "a & b", `"a & b"`},
+		{"cmd", `say "hi"`, `"say ""hi"""`},
+		{"pwsh", "a; b", "'a; b'"},
+		{"powershell", "it's", "'it''s'"},
+	}
+	for _, tt := range tests {
+		sh, err := resolveShell(tt.shell)
+		if err != nil {
+			t.Fatalf("resolveShell(%q): %v", tt.shell, err)
+		}
+		if got := sh.quote(tt.in); got != tt.want {
+			t.Errorf("%s: quote(%q) = %s, want %s", tt.shell, tt.in, got, tt.want)
+		}
+	}
+}
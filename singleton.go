@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errAlreadyRunning = errors.New("上一次运行仍在进行")
+
+// 组链中任一组设置了 singleton 即开启：true 时拒绝启动，wait 时排队等待
+func chainSingleton(cfg *Config, names []string) (on, wait bool, err error) {
+	for _, name := range names {
+		v, ok := cfg.groupSetting(name, "singleton")
+		if !ok {
+			continue
+		}
+		if v == "wait" {
+			return true, true, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, false, fmt.Errorf("无效的 singleton 配置 %q，可选 true、false、wait", v)
+		}
+		if b {
+			return true, false, nil
+		}
+	}
+	return false, false, nil
+}
+
+// 同一配置文件中同一组链共用的锁文件，放在 $XDG_RUNTIME_DIR/runcmd（未设置时为临时目录）下
+func singletonLockPath(cfg *Config, names []string) (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		base = os.TempDir()
+	}
+	dir := filepath.Join(base, "runcmd")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("创建锁目录 %s 失败: %w", dir, err)
+	}
+	chain := strings.Join(names, ",")
+	// 内嵌配置或命令行中的组按当前目录区分
+	source := cfg.Sources[names[0]]
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		source, _ = filepath.Abs(source)
+	} else if wd, err := os.Getwd(); err == nil {
+		source = wd
+	}
+	sum := sha256.Sum256([]byte(source + "\n" + chain))
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, chain)
+	return filepath.Join(dir, name+"-"+hex.EncodeToString(sum[:6])+".lock"), nil
+}
+
+// 获取组链的全局锁，返回的函数用于释放
+func acquireSingleton(ctx context.Context, cfg *Config, names []string, wait bool) (func(), error) {
+	path, err := singletonLockPath(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+	chain := strings.Join(names, ",")
+	unlock, err := acquireLock(ctx, path, wait, 0, errAlreadyRunning, func() {
+		logger.Info(fmt.Sprintf("组 [%s] 的上一次运行%s仍在进行，排队等待...", chain, lockHolder(path)), "lock", path)
+	})
+	if errors.Is(err, errAlreadyRunning) {
+		return nil, fmt.Errorf("组 [%s] 的上一次运行%s仍在进行，本次不启动 (singleton=true)", chain, lockHolder(path))
+	}
+	return unlock, err
+}
+
+// 锁文件中记录的持有者，如 "（pid 1234）"
+func lockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	pid := strings.TrimSpace(string(data))
+	if err != nil || pid == "" {
+		return ""
+	}
+	return "（pid " + pid + "）"
+}
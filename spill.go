@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 单个输出缓冲在内存中的默认上限，超过后转存到临时文件
+const defaultBufferMemory = 4 << 20
+
+// buffer_memory 设置，buffered 输出和 --aggregate 收集的输出共用
+var bufferMemoryLimit int64 = defaultBufferMemory
+
+// 读取 buffer_memory 设置（如 16MB）
+func parseBufferMemory(cfg *Config) (int64, error) {
+	n, err := cfg.sizeSetting("", "buffer_memory", defaultBufferMemory)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("无效的 buffer_memory 配置 %q，需要大于 0", cfg.Settings["buffer_memory"])
+	}
+	return n, nil
+}
+
+// 内存中最多保留 limit 字节，超过后把全部内容转存到临时文件并继续追加，
+// 避免个别目录的超大输出占满内存；调用方负责加锁，用完后 Close 删除临时文件
+type spillBuffer struct {
+	limit  int64
+	mem    bytes.Buffer
+	file   *os.File
+	size   int64
+	failed bool // 创建临时文件失败，之后只能留在内存中
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	if b.limit == 0 {
+		b.limit = bufferMemoryLimit
+	}
+	if b.file == nil && !b.failed && int64(b.mem.Len()+len(p)) > b.limit {
+		b.spill()
+	}
+	b.size += int64(len(p))
+	if b.file != nil {
+		return b.file.Write(p)
+	}
+	return b.mem.Write(p)
+}
+
+func (b *spillBuffer) spill() {
+	f, err := os.CreateTemp("", "runcmd-*.out")
+	if err == nil {
+		if _, err = f.Write(b.mem.Bytes()); err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		b.failed = true
+		logger.Warn(fmt.Sprintf("输出超过 %s，转存临时文件失败，继续保留在内存中: %v", formatBytes(uint64(b.limit)), err), "phase", "output", "error", err)
+		return
+	}
+	logger.Debug(fmt.Sprintf("输出超过 %s，转存到临时文件 %s", formatBytes(uint64(b.limit)), f.Name()), "phase", "output", "file", f.Name())
+	b.file = f
+	b.mem = bytes.Buffer{}
+}
+
+// 从 off 开始的 n 字节
+func (b *spillBuffer) section(off, n int64) io.Reader {
+	if b.file != nil {
+		return io.NewSectionReader(b.file, off, n)
+	}
+	return bytes.NewReader(b.mem.Bytes()[off : off+n])
+}
+
+func (b *spillBuffer) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, b.section(0, b.size))
+}
+
+// 删除临时文件
+func (b *spillBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	_ = b.file.Close()
+	b.file = nil
+	return os.Remove(name)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 命令失败时的处理策略
+const (
+	policyStop  = "stop"          // 默认：失败即停止该组
+	policyAllow = "allow_failure" // "- " 前缀：忽略失败继续执行
+	policyWarn  = "warn"          // "!" 前缀（后面不跟空白）：打印警告后继续执行
+)
+
+// 组内的一个执行步骤
+type cmdStep struct {
+	Script string   // 交给 shell 的脚本
+	Argv   []string // exec 形式的命令，不为空时不经过 shell
+	Policy string
+	Cmds   []string // 整组拼成一个脚本时的各条命令
+}
+
+// 单条命令的执行结果
+type stepResult struct {
+	Cmd      string
+	ExitCode int // 未执行完（被终止、超时或脚本中途 exit）时为 -1
+	Duration time.Duration
+}
+
+// per_command 设置
+const (
+	perCommandOff     = "false"   // 默认：整组拼成一个脚本
+	perCommandOn      = "true"    // 每条命令独立进程
+	perCommandMarkers = "markers" // 仍在同一个 shell 中执行，用标记行区分每条命令
+)
+
+func parsePerCommandSetting(v string, sh shellSpec) (string, error) {
+	switch v {
+	case "", perCommandOff:
+		return perCommandOff, nil
+	case perCommandOn:
+		return v, nil
+	case perCommandMarkers:
+		switch sh.Name {
+		case "sh", "bash", "zsh", "dash", "ash", "ksh":
+			return v, nil
+		}
+		return "", fmt.Errorf("per_command=markers 只支持 sh、bash、zsh 等 POSIX shell，当前为 %s", sh.Name)
+	}
+	return "", fmt.Errorf("无效的 per_command 配置 %q，可选 true、false、markers", v)
+}
+
+// 拆出命令行的失败策略前缀。"!cmd" 为 warn；"! cmd" 是 POSIX shell 的取反，原样交给 shell
+func parsePolicy(line string) (string, string) {
+	switch {
+	case strings.HasPrefix(line, "- "):
+		return policyAllow, strings.TrimSpace(line[2:])
+	case len(line) > 1 && line[0] == '!' && line[1] != ' ' && line[1] != '\t':
+		return policyWarn, line[1:]
+	}
+	return policyStop, line
+}
+
+// 命令行是否让整组改为逐条执行：失败策略前缀或 exec 形式
+func splitsGroup(line string) bool {
+	policy, cmd := parsePolicy(line)
+	return policy != policyStop || strings.HasPrefix(cmd, "exec:")
+}
+
+// 把组的命令拆成执行步骤。perCommand 或含 exec 命令、策略前缀时逐条执行（每条
+// 独立进程，cd 和 shell 变量不会延续到下一条）；否则整组拼成一个脚本交给 shell，与以往一致
+func buildSteps(group string, cmds []string, sh shellSpec, perCommand bool) ([]cmdStep, error) {
+	steps := make([]cmdStep, 0, len(cmds))
+	for _, line := range cmds {
+		policy, cmd := parsePolicy(line)
+		argv, isExec, err := parseExecLine(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("组 [%s]: %w", group, err)
+		}
+		if isExec || policy != policyStop {
+			perCommand = true
+		}
+		steps = append(steps, cmdStep{Script: cmd, Argv: argv, Policy: policy})
+	}
+	if perCommand || len(cmds) == 0 {
+		return steps, nil
+	}
+	return []cmdStep{{Script: strings.Join(cmds, sh.Join), Policy: policyStop, Cmds: cmds}}, nil
+}
+
+// 展开步骤中的模板变量：脚本中的值按 shell 加引号，exec 命令的参数原样替换
+func (s cmdStep) expand(t *target, opts *runOptions) cmdStep {
+	out := cmdStep{Script: expandShellTemplate(t, opts, s.Script), Policy: s.Policy}
+	for _, arg := range s.Argv {
+		out.Argv = append(out.Argv, expandTemplate(t, opts, arg))
+	}
+	for _, cmd := range s.Cmds {
+		out.Cmds = append(out.Cmds, expandShellTemplate(t, opts, cmd))
+	}
+	return out
+}
+
+// 标记行以 ASCII RS 开头，不会出现在普通输出中
+const stepMarkerPrefix = "\x1erunCmd-step:"
+
+// per_command=markers 时执行的脚本：每条命令前后输出标记行，命令之间的
+// cd 和变量照常延续；与直接拼接相同，脚本的退出码是最后一条命令的退出码
+func markerScript(cmds []string) string {
+	var b strings.Builder
+	for i, cmd := range cmds {
+		fmt.Fprintf(&b, "printf '\\036runCmd-step:%d:start\\n'\n%s\n", i, cmd)
+		fmt.Fprintf(&b, "__runcmd_rc=$?\nprintf '\\036runCmd-step:%d:end:%%d\\n' \"$__runcmd_rc\"\n", i)
+	}
+	b.WriteString("exit $__runcmd_rc\n")
+	return b.String()
+}
+
+// 从标记行记录每条命令的退出码和耗时
+type stepMarkers struct {
+	cmds    []string
+	res     *dirResult
+	started time.Time
+}
+
+// 处理一行输出：返回去掉标记后需要显示的部分，整行都是标记时 ok 为 false
+func (m *stepMarkers) scan(line string) (string, bool) {
+	i := strings.Index(line, stepMarkerPrefix)
+	if i < 0 {
+		return line, true
+	}
+	fields := strings.Split(line[i+len(stepMarkerPrefix):], ":")
+	if n, err := strconv.Atoi(fields[0]); err == nil && n >= 0 && n < len(m.cmds) && len(fields) >= 2 {
+		switch {
+		case fields[1] == "start":
+			m.res.Steps = append(m.res.Steps, stepResult{Cmd: m.cmds[n], ExitCode: -1})
+			m.started = time.Now()
+		case fields[1] == "end" && len(fields) == 3 && len(m.res.Steps) > 0:
+			last := &m.res.Steps[len(m.res.Steps)-1]
+			last.ExitCode, _ = strconv.Atoi(fields[2])
+			last.Duration = time.Since(m.started)
+		}
+	}
+	return line[:i], i > 0
+}
+
+// 进程结束后补全最后一条未输出结束标记的命令（如脚本中途 exit）
+func (m *stepMarkers) finish(code int) {
+	if n := len(m.res.Steps); n > 0 && m.res.Steps[n-1].Duration == 0 {
+		m.res.Steps[n-1].ExitCode = code
+		m.res.Steps[n-1].Duration = time.Since(m.started)
+	}
+}
+
+// 最后一条失败的命令，未记录逐条结果时为 nil
+func (r *dirResult) failedStep() *stepResult {
+	for i := len(r.Steps) - 1; i >= 0; i-- {
+		if r.Steps[i].ExitCode != 0 {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// 日志中展示的步骤内容
+func (s cmdStep) String() string {
+	if len(s.Argv) > 0 {
+		return fmt.Sprintf("%q", s.Argv)
+	}
+	return s.Script
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		wantPolicy string
+		wantCmd    string
+	}{
+		{"普通命令", "make", policyStop, "make"},
+		{"allow_failure", "- make lint", policyAllow, "make lint"},
+		{"warn", "!npm audit", policyWarn, "npm audit"},
+		{"shell 取反", "! grep -q x file", policyStop, "! grep -q x file"},
+		{"制表符后的取反", "!\tfalse", policyStop, "!\tfalse"},
+		{"单独的 !", "!", policyStop, "!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, cmd := parsePolicy(tt.line)
+			if policy != tt.wantPolicy || cmd != tt.wantCmd {
+				t.Errorf("parsePolicy(%q) = %q, %q, want %q, %q", tt.line, policy, cmd, tt.wantPolicy, tt.wantCmd)
+			}
+		})
+	}
+}
+
+func TestBuildStepsSingleScript(t *testing.T) {
+	sh, err := resolveShell("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		cmds      []string
+		wantSteps int
+	}{
+		{"取反仍在同一个脚本中", []string{"cd sub", "! test -f x", "export A=1"}, 1},
+		{"warn 前缀逐条执行", []string{"cd sub", "!make"}, 2},
+		{"allow_failure 前缀逐条执行", []string{"- make", "true"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := buildSteps("g", tt.cmds, sh, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(steps) != tt.wantSteps {
+				t.Errorf("步骤数 = %d, want %d", len(steps), tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestCmdStepExpandQuotes(t *testing.T) {
+	sh, err := resolveShell("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &runOptions{
+		Group:  "deploy",
+		Shell:  sh,
+		Params: map[string]string{"env": "prod; rm -rf /"},
+		Vars:   map[string]string{"flags": "-v -race"},
+	}
+	tgt := &target{Dir: "./my svc"}
+	step := cmdStep{Script: "go test {{flags}} --env {{env}} {{dir}} {{base}}", Argv: []string{"echo", "{{env}}", "{{dir}}"}}
+	got := step.expand(tgt, opts)
+	if want := `go test -v -race --env 'prod; rm -rf /' './my svc' 'my svc'`; got.Script != want {
+		t.Errorf("Script = %s, want %s", got.Script, want)
+	}
+	if want := []string{"echo", "prod; rm -rf /", "./my svc"}; !slices.Equal(got.Argv, want) {
+		t.Errorf("Argv = %q, want %q", got.Argv, want)
+	}
+}
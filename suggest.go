@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 按名称查找用户指定的组：完全匹配优先，否则接受唯一的前缀匹配（./runCmd bu ... 即 build）
+func (c *Config) matchGroup(name string) (string, error) {
+	if _, ok := c.Groups[name]; ok {
+		return name, nil
+	}
+	var prefixed []string
+	for _, g := range sortedKeys(c.Groups) {
+		if strings.HasPrefix(g, name) {
+			prefixed = append(prefixed, g)
+		}
+	}
+	switch len(prefixed) {
+	case 0:
+		return "", c.groupNotFound(name)
+	case 1:
+		return prefixed[0], nil
+	}
+	return "", fmt.Errorf("%w [%s]，有多个组以它开头: %s", errGroupNotFound, name, strings.Join(prefixed, ", "))
+}
+
+// 组不存在的错误，附带编辑距离相近的组和全部可用的组
+func (c *Config) groupNotFound(name string) error {
+	var hint string
+	if s := c.suggestGroups(name); len(s) > 0 {
+		hint = fmt.Sprintf("，是否要找 [%s]？", strings.Join(s, "] 或 ["))
+	} else if len(c.Groups) > 0 {
+		hint = "，"
+	}
+	if len(c.Groups) > 0 {
+		hint += "可用的组: " + strings.Join(sortedKeys(c.Groups), ", ")
+	}
+	return fmt.Errorf("%w [%s]%s", errGroupNotFound, name, hint)
+}
+
+// 编辑距离不超过名称长度三分之一（至少 1）的组，按距离排序，最多 3 个
+func (c *Config) suggestGroups(name string) []string {
+	limit := max(1, len([]rune(name))/3)
+	type candidate struct {
+		name string
+		dist int
+	}
+	var cands []candidate
+	for g := range c.Groups {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(g)); d <= limit {
+			cands = append(cands, candidate{g, d})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].dist != cands[j].dist {
+			return cands[i].dist < cands[j].dist
+		}
+		return cands[i].name < cands[j].name
+	})
+	var names []string
+	for i := 0; i < len(cands) && i < 3; i++ {
+		names = append(names, cands[i].name)
+	}
+	return names
+}
+
+// 编辑距离（相邻字符互换算一次，即 OSA 距离），按 rune 计算
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sync=true：ssh 目标执行组之前，把本机目录 rsync 到远程目录，执行后把
+// sync_artifacts 中的路径拉回本机，本地的检出可以直接在远程主机上构建
+type syncSpec struct {
+	Source    string   // sync_src 本机目录，空表示与远程目录相同的路径
+	Exclude   []string // sync_exclude 不同步的路径，.git 和 .runcmd 总是排除
+	Artifacts []string // sync_artifacts 远程目录中的相对路径，执行后拉回本机目录
+}
+
+func parseSync(cfg *Config, group string) (*syncSpec, error) {
+	on, err := cfg.boolSetting(group, "sync", false)
+	if err != nil || !on {
+		return nil, err
+	}
+	if _, err := exec.LookPath("rsync"); err != nil {
+		return nil, fmt.Errorf("组 [%s] 配置了 sync=true，但没有找到 rsync", group)
+	}
+	s := &syncSpec{}
+	s.Source, _ = cfg.groupSetting(group, "sync_src")
+	if v, ok := cfg.groupSetting(group, "sync_exclude"); ok {
+		s.Exclude = splitTags(v)
+	}
+	if v, ok := cfg.groupSetting(group, "sync_artifacts"); ok {
+		for _, p := range splitTags(v) {
+			if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+				return nil, fmt.Errorf("无效的 sync_artifacts 路径 %q，需要远程目录中的相对路径", p)
+			}
+			s.Artifacts = append(s.Artifacts, path.Clean(p))
+		}
+	}
+	return s, nil
+}
+
+// 同步的本机目录
+func (s *syncSpec) local(t *target) string {
+	if s.Source != "" {
+		return s.Source
+	}
+	return t.RemoteDir
+}
+
+// 与 sshCommand 相同的 ssh 参数，交给 rsync -e
+func (s *syncSpec) rsh(t *target, opts *runOptions) string {
+	args := append([]string{"ssh"}, opts.SSHOptions...)
+	if t.Port != "" {
+		args = append(args, "-p", t.Port)
+	}
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// 执行前把本机目录同步到远程目录
+func (s *syncSpec) push(ctx context.Context, t *target, opts *runOptions) error {
+	args := []string{"-az", "-e", s.rsh(t, opts), "--exclude=.git/", "--exclude=.runcmd/"}
+	for _, p := range s.Exclude {
+		args = append(args, "--exclude="+p)
+	}
+	src := strings.TrimSuffix(filepath.ToSlash(s.local(t)), "/") + "/"
+	args = append(args, src, t.Host+":"+strings.TrimSuffix(t.RemoteDir, "/")+"/")
+	start := time.Now()
+	if err := runRsync(ctx, args); err != nil {
+		return fmt.Errorf("同步本机目录 %s 失败: %w", src, err)
+	}
+	t.logger().Info(fmt.Sprintf("%s 已同步本机目录 %s (%s)", prefix(t.Dir), src, time.Since(start).Round(time.Millisecond)),
+		"phase", "sync", "source", src)
+	return nil
+}
+
+// 执行后把 sync_artifacts 拉回本机目录，保留相对路径
+func (s *syncSpec) pull(ctx context.Context, t *target, opts *runOptions) error {
+	if len(s.Artifacts) == 0 {
+		return nil
+	}
+	dest := strings.TrimSuffix(filepath.ToSlash(s.local(t)), "/") + "/"
+	for _, p := range s.Artifacts {
+		// /./ 之后的部分在本机目录中按原样的相对路径创建
+		src := t.Host + ":" + strings.TrimSuffix(t.RemoteDir, "/") + "/./" + p
+		if err := runRsync(ctx, []string{"-azR", "-e", s.rsh(t, opts), src, dest}); err != nil {
+			return fmt.Errorf("拉回 %s 失败: %w", p, err)
+		}
+	}
+	t.logger().Info(fmt.Sprintf("%s 已拉回 %s 到 %s", prefix(t.Dir), strings.Join(s.Artifacts, ", "), dest),
+		"phase", "sync", "artifacts", s.Artifacts)
+	return nil
+}
+
+func runRsync(ctx context.Context, args []string) error {
+	out, err := exec.CommandContext(ctx, "rsync", args...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 拆分 --tags / --exclude-tags 的逗号分隔列表
+func splitTags(v string) []string {
+	var tags []string
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// 按 [dirs] 清单中的标签选择目录：带任一 include 标签且不带任何 exclude 标签；
+// include 为空时不限制。没有目录参数时从清单中的全部目录里选
+func selectByTags(cfg *Config, dirs, include, exclude []string) []string {
+	tagsOf := make(map[string][]string, len(cfg.DirTags))
+	for dir, tags := range cfg.DirTags {
+		tagsOf[filepath.Clean(dir)] = tags
+	}
+	if len(dirs) == 0 {
+		dirs = sortedKeys(cfg.DirTags)
+	}
+	hasAny := func(tags, want []string) bool {
+		return slices.ContainsFunc(want, func(w string) bool { return slices.Contains(tags, w) })
+	}
+	var out []string
+	for _, dir := range dirs {
+		tags := tagsOf[filepath.Clean(dir)]
+		if len(include) > 0 && !hasAny(tags, include) || hasAny(tags, exclude) {
+			continue
+		}
+		out = append(out, dir)
+	}
+	return out
+}
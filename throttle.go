@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 负载超过阈值时重新检查的间隔
+const throttleInterval = time.Second
+
+// 默认最少保留 10% 的可用内存
+const defaultMinFreeMemory = "10%"
+
+// concurrency=auto 时的调度限流：负载或内存压力超过阈值时暂停启动新目录
+type loadThrottle struct {
+	MaxLoad        float64 // 1 分钟平均负载上限
+	MinFreePercent float64 // 可用内存占比下限，与 MinFreeBytes 二选一
+	MinFreeBytes   int64
+}
+
+// 组链中是否有组配置了 concurrency=auto
+func autoConcurrency(cfg *Config, names []string) bool {
+	for _, name := range names {
+		if v, ok := cfg.groupSetting(name, "concurrency"); ok && v == "auto" {
+			return true
+		}
+	}
+	return false
+}
+
+// 生成限流参数，未使用 concurrency=auto 时返回 nil
+// max_load 默认为 CPU 核数，min_free_memory 可写 10% 或 2G
+func newLoadThrottle(cfg *Config, names []string) (*loadThrottle, error) {
+	if !autoConcurrency(cfg, names) {
+		return nil, nil
+	}
+	th := &loadThrottle{MaxLoad: float64(runtime.NumCPU())}
+	if v, ok := cfg.Settings["max_load"]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("无效的 max_load 配置 %q", v)
+		}
+		th.MaxLoad = f
+	}
+	mem := defaultMinFreeMemory
+	if v, ok := cfg.Settings["min_free_memory"]; ok {
+		mem = v
+	}
+	if p, ok := strings.CutSuffix(strings.TrimSpace(mem), "%"); ok {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 || f >= 100 {
+			return nil, fmt.Errorf("无效的 min_free_memory 配置 %q", mem)
+		}
+		th.MinFreePercent = f
+	} else {
+		n, err := parseSize(mem)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 min_free_memory 配置 %q", mem)
+		}
+		th.MinFreeBytes = n
+	}
+	return th, nil
+}
+
+// 当前是否超过阈值，返回原因
+func (th *loadThrottle) overloaded() (string, bool) {
+	if load, ok := loadAverage(); ok && load > th.MaxLoad {
+		return fmt.Sprintf("系统负载 %.2f 超过 max_load=%.2f", load, th.MaxLoad), true
+	}
+	avail, total, ok := memoryAvailable()
+	if !ok {
+		return "", false
+	}
+	if th.MinFreeBytes > 0 && avail < th.MinFreeBytes {
+		return fmt.Sprintf("可用内存 %dM 低于 min_free_memory", avail>>20), true
+	}
+	if pct := float64(avail) * 100 / float64(total); th.MinFreePercent > 0 && pct < th.MinFreePercent {
+		return fmt.Sprintf("可用内存 %.1f%% 低于 min_free_memory=%.0f%%", pct, th.MinFreePercent), true
+	}
+	return "", false
+}
+
+// 等到负载回落后返回；running 为 0 时不等待，保证总能有目录在执行
+func (th *loadThrottle) wait(ctx context.Context, running func() int) {
+	if th == nil {
+		return
+	}
+	logged := false
+	for running() > 0 {
+		reason, over := th.overloaded()
+		if !over {
+			return
+		}
+		if !logged {
+			logger.Info(fmt.Sprintf("[auto] %s，暂停调度新目录", reason), "phase", "throttle")
+			logged = true
+		}
+		select {
+		case <-time.After(throttleInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
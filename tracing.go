@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 退出前等待导出剩余 span 的时长
+const tracingShutdownTimeout = 5 * time.Second
+
+// 未配置导出时为 noop，span 不产生开销
+var tracer = otel.Tracer("runCmd")
+
+// 设置了 OTEL_EXPORTER_OTLP_ENDPOINT（或 _TRACES_ENDPOINT）时通过 OTLP/HTTP 导出 span，
+// 其余参数（headers、超时等）按 OTel 标准环境变量读取；返回退出前调用的 flush 函数
+func setupTracing() func() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() {}
+	}
+	ctx := context.Background()
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "初始化 OTLP 导出失败: %v\n", err)
+		return func() {}
+	}
+	res, _ := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("runCmd")))
+	if env, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		res, _ = resource.Merge(res, env)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	tracer = tp.Tracer("runCmd")
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "导出 trace 失败: %v\n", err)
+		}
+	}
+}
+
+// 整个运行的 span
+func startRunSpan(ctx context.Context, group string, dirs int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "run "+group, trace.WithAttributes(
+		attribute.String("runcmd.group", group),
+		attribute.Int("runcmd.dirs", dirs),
+	))
+}
+
+func endRunSpan(span trace.Span, rep jsonReport) {
+	failed := 0
+	for _, r := range rep.Results {
+		if !okStatus(r.Status) {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Bool("runcmd.ok", rep.OK), attribute.Int("runcmd.failed_dirs", failed))
+	if !rep.OK {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d 个目录未成功", failed))
+	}
+	span.End()
+}
+
+// 单个目录（执行整个组链）的 span
+func startDirSpan(ctx context.Context, t *target) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("runcmd.dir", t.Dir)}
+	if t.Host != "" {
+		attrs = append(attrs, attribute.String("runcmd.host", t.Host))
+	}
+	if t.Pod != "" {
+		attrs = append(attrs, attribute.String("runcmd.pod", t.Pod), attribute.String("runcmd.namespace", t.Namespace))
+	}
+	return tracer.Start(ctx, "dir "+t.Dir, trace.WithAttributes(attrs...))
+}
+
+// 组在目录中执行（含重试）的 span
+func startGroupSpan(ctx context.Context, group string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "group "+group, trace.WithAttributes(attribute.String("runcmd.group", group)))
+}
+
+// 组在目录中执行结束时记录结果
+func endGroupSpan(span trace.Span, res *dirResult) {
+	span.SetAttributes(
+		attribute.String("runcmd.status", res.Status),
+		attribute.Int("runcmd.exit_code", res.ExitCode),
+		attribute.Int64("runcmd.output_bytes", res.OutputBytes),
+		attribute.Int("runcmd.attempts", res.Attempts),
+	)
+	if !okStatus(res.Status) {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	span.End()
+}
+
+// 单条命令的 span，parallel 时各步骤的 span 并列
+func startCommandSpan(ctx context.Context, step cmdStep) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "command", trace.WithAttributes(attribute.String("runcmd.command", step.String())))
+}
+
+// 单条命令结束时记录退出码和输出大小
+func endCommandSpan(span trace.Span, code int, n int64, err error) {
+	span.SetAttributes(attribute.Int("runcmd.exit_code", code), attribute.Int64("runcmd.output_bytes", n))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
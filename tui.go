@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// 每个目录在 TUI 中保留的日志行数
+const tuiMaxLogLines = 2000
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// TUI 中的一行（一个目录）
+type tuiRow struct {
+	target  *target
+	group   string
+	status  string // 空表示等待中
+	running bool
+	start   time.Time
+	elapsed time.Duration
+	last    string
+	log     []string
+}
+
+type (
+	tuiEventMsg runEvent
+	tuiTickMsg  struct{}
+	tuiDoneMsg  struct{}
+)
+
+type tuiModel struct {
+	title     string
+	rows      []*tuiRow
+	byDir     map[string]*tuiRow
+	cursor    int
+	expanded  bool
+	frame     int
+	done      bool
+	stopping  bool
+	width     int
+	height    int
+	cancelAll func()
+}
+
+func newTUIModel(title string, targets []*target, cancelAll func()) *tuiModel {
+	m := &tuiModel{title: title, byDir: make(map[string]*tuiRow), cancelAll: cancelAll, width: 80, height: 24}
+	for _, t := range targets {
+		row := &tuiRow{target: t}
+		m.rows = append(m.rows, row)
+		m.byDir[t.Dir] = row
+	}
+	return m
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(time.Time) tea.Msg { return tuiTickMsg{} })
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tuiTick()
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tuiTickMsg:
+		m.frame++
+		for _, row := range m.rows {
+			if row.running {
+				row.elapsed = time.Since(row.start)
+			}
+		}
+		if !m.done {
+			return m, tuiTick()
+		}
+	case tuiEventMsg:
+		m.applyEvent(runEvent(msg))
+	case tuiDoneMsg:
+		m.done = true
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *tuiModel) applyEvent(ev runEvent) {
+	row := m.byDir[ev.Dir]
+	if row == nil {
+		return
+	}
+	switch ev.Kind {
+	case eventDirStarted:
+		if row.start.IsZero() {
+			row.start = time.Now()
+		}
+		row.group, row.status, row.running = ev.Group, "", true
+	case eventLine:
+		row.last = ev.Line
+		row.log = append(row.log, ev.Line)
+		if len(row.log) > tuiMaxLogLines {
+			row.log = row.log[len(row.log)-tuiMaxLogLines:]
+		}
+	case eventDirFinished:
+		row.group, row.status, row.running = ev.Group, ev.Result.Status, false
+		if !row.start.IsZero() {
+			row.elapsed = time.Since(row.start)
+		}
+	}
+}
+
+func (m *tuiModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.rows)-1 {
+			m.cursor++
+		}
+	case "enter", " ":
+		m.expanded = !m.expanded
+	case "esc":
+		m.expanded = false
+	case "c":
+		if len(m.rows) > 0 {
+			m.rows[m.cursor].target.Cancel()
+		}
+	case "q", "ctrl+c":
+		// 运行中第一次按下取消全部，结束后再按退出
+		if m.done {
+			return tea.Quit
+		}
+		if !m.stopping {
+			m.stopping = true
+			m.cancelAll()
+		}
+	}
+	return nil
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	finished := 0
+	for _, row := range m.rows {
+		if row.status != "" && !row.running {
+			finished++
+		}
+	}
+	state := "运行中"
+	switch {
+	case m.done:
+		state = "全部完成，按 q 退出"
+	case m.stopping:
+		state = "正在取消..."
+	}
+	fmt.Fprintf(&b, "runCmd [%s]  %d/%d  %s\n", m.title, finished, len(m.rows), state)
+	fmt.Fprintln(&b, runewidth.Truncate("↑/↓ 选择  enter 展开/收起日志  c 取消当前目录  q 取消全部/退出", m.width, "…"))
+	fmt.Fprintln(&b)
+
+	if m.expanded && len(m.rows) > 0 {
+		row := m.rows[m.cursor]
+		fmt.Fprintf(&b, "%s %s 日志 (esc 返回)\n", m.statusIcon(row), prefix(row.target.Dir))
+		lines := row.log
+		if max := m.height - 5; max > 0 && len(lines) > max {
+			lines = lines[len(lines)-max:]
+		}
+		for _, line := range lines {
+			fmt.Fprintln(&b, runewidth.Truncate(line, m.width, "…"))
+		}
+		return b.String()
+	}
+
+	// 行数超过屏幕时让光标所在行保持可见
+	visible := m.rows
+	offset := 0
+	if max := m.height - 4; max > 0 && len(m.rows) > max {
+		if m.cursor >= max {
+			offset = m.cursor - max + 1
+		}
+		visible = m.rows[offset : offset+max]
+	}
+	for i, row := range visible {
+		cursor := "  "
+		if offset+i == m.cursor {
+			cursor = "> "
+		}
+		status := row.status
+		if row.running {
+			status = "RUNNING"
+		} else if status == "" {
+			status = "PENDING"
+		}
+		line := fmt.Sprintf("%s%s %-24s %-10s %-9s %7s  %s", cursor, m.statusIcon(row),
+			runewidth.Truncate(row.target.Dir, 24, "…"), row.group, status,
+			row.elapsed.Round(100*time.Millisecond), row.last)
+		fmt.Fprintln(&b, colorize(m.statusColor(row), runewidth.Truncate(line, m.width, "…")))
+	}
+	return b.String()
+}
+
+func (m *tuiModel) statusIcon(row *tuiRow) string {
+	switch {
+	case row.running:
+		return spinnerFrames[m.frame%len(spinnerFrames)]
+	case okStatus(row.status):
+		return "✓"
+	case row.status == statusFailed || row.status == statusTimeout:
+		return "✗"
+	case row.status == "":
+		return "·"
+	}
+	return "-"
+}
+
+func (m *tuiModel) statusColor(row *tuiRow) string {
+	switch {
+	case row.running:
+		return ""
+	case okStatus(row.status):
+		return "32"
+	case row.status == statusFailed || row.status == statusTimeout:
+		return "31"
+	case row.status == "":
+		return "90"
+	}
+	return "33"
+}
+
+// 以 TUI 方式展示运行：start 启动各目录的执行，wait 等待全部结束
+func runTUI(title string, targets []*target, cancelAll func(), start, wait func()) error {
+	m := newTUIModel(title, targets, cancelAll)
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	onEvent(func(ev runEvent) { p.Send(tuiEventMsg(ev)) })
+
+	start()
+	go func() {
+		wait()
+		p.Send(tuiDoneMsg{})
+	}()
+	_, err := p.Run()
+	if !m.done {
+		// 界面异常退出时不留下还在运行的目录
+		cancelAll()
+	}
+	wait()
+	return err
+}
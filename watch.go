@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sync/semaphore"
+)
+
+// 文件变化后等待多久再重新执行，合并短时间内的多次保存
+const defaultWatchDebounce = 300 * time.Millisecond
+
+// 默认忽略的路径，按路径中的每一段匹配
+const defaultWatchIgnore = ".git,node_modules"
+
+// watch 模式的参数
+type watchOptions struct {
+	Debounce time.Duration
+	Ignore   []string // 通配符，如 .git、*.log
+}
+
+func newWatchOptions(cfg *Config) (watchOptions, error) {
+	opts := watchOptions{Debounce: defaultWatchDebounce}
+	if v, ok := cfg.Settings["watch_debounce"]; ok {
+		d, err := parseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("无效的 watch_debounce 配置 %q: %w", v, err)
+		}
+		opts.Debounce = d
+	}
+	ignore := defaultWatchIgnore
+	if v, ok := cfg.Settings["watch_ignore"]; ok {
+		ignore = v
+	}
+	for _, p := range strings.Split(ignore, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			if _, err := filepath.Match(p, ""); err != nil {
+				return opts, fmt.Errorf("无效的 watch_ignore 配置 %q: %w", p, err)
+			}
+			opts.Ignore = append(opts.Ignore, p)
+		}
+	}
+	return opts, nil
+}
+
+// 相对目标目录的路径中是否有一段匹配忽略规则
+func (o watchOptions) ignored(rel string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		for _, p := range o.Ignore {
+			if ok, _ := filepath.Match(p, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 被监听的目录
+type watchedTarget struct {
+	t       *target
+	root    string // 绝对路径
+	changed chan struct{}
+	timer   *time.Timer
+}
+
+// 监听各目标目录，先执行一次，之后目录内文件变化时重新执行该目录；
+// 变化时若该目录仍在执行，先取消再重新开始。ctx 结束时返回
+func watchTargets(ctx context.Context, targets []*target, chain []*runOptions, worker *semaphore.Weighted, opts watchOptions) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建文件监听失败: %w", err)
+	}
+	defer w.Close()
+
+	var watched []*watchedTarget
+	for _, t := range targets {
+		if t.remote() {
+			logger.Warn(fmt.Sprintf("%s[watch] 远程目标不支持监听，只执行一次", prefix(t.Dir)), "dir", t.Dir, "phase", "watch")
+		}
+		root, err := filepath.Abs(t.Dir)
+		if err != nil {
+			return err
+		}
+		wt := &watchedTarget{t: t, root: root, changed: make(chan struct{}, 1)}
+		if !t.remote() {
+			if err := addWatchTree(w, root, opts); err != nil {
+				return fmt.Errorf("监听目录 %s 失败: %w", t.Dir, err)
+			}
+		}
+		watched = append(watched, wt)
+	}
+
+	var mu sync.Mutex
+	go func() {
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				wt := matchWatchedTarget(watched, ev.Name)
+				if wt == nil {
+					continue
+				}
+				rel, _ := filepath.Rel(wt.root, ev.Name)
+				if opts.ignored(rel) {
+					continue
+				}
+				// 新建的子目录也要加入监听
+				if ev.Has(fsnotify.Create) {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						_ = addWatchTree(w, ev.Name, opts)
+					}
+				}
+				mu.Lock()
+				if wt.timer != nil {
+					wt.timer.Stop()
+				}
+				wt.timer = time.AfterFunc(opts.Debounce, func() {
+					select {
+					case wt.changed <- struct{}{}:
+					default:
+					}
+				})
+				mu.Unlock()
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn(fmt.Sprintf("[watch] 监听出错: %v", err), "phase", "watch", "error", err)
+			}
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("[watch] 正在监听 %d 个目录，按 Ctrl-C 退出", len(watched)), "phase", "watch", "dirs", len(watched))
+	var wg sync.WaitGroup
+	for _, wt := range watched {
+		wg.Add(1)
+		go func(wt *watchedTarget) {
+			defer wg.Done()
+			watchLoop(ctx, wt, chain, worker)
+		}(wt)
+	}
+	wg.Wait()
+	return nil
+}
+
+// 单个目录的执行循环
+func watchLoop(ctx context.Context, wt *watchedTarget, chain []*runOptions, worker *semaphore.Weighted) {
+	t := wt.t
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			results := runCmdsInDir(runCtx, t, chain, worker)
+			if runCtx.Err() == nil {
+				status := statusOK
+				if len(failedDirs(results)) > 0 {
+					status = statusFailed
+				}
+				logger.Info(fmt.Sprintf("%s[watch] 本次执行 %s，等待文件变化...", prefix(t.Dir), colorStatus(status)), "dir", t.Dir, "phase", "watch", "status", status)
+			}
+		}()
+
+		select {
+		case <-done:
+			select {
+			case <-wt.changed:
+			case <-ctx.Done():
+				cancel()
+				return
+			}
+		case <-wt.changed:
+			logger.Info(fmt.Sprintf("%s[watch] 检测到文件变化，取消正在进行的执行", prefix(t.Dir)), "dir", t.Dir, "phase", "watch")
+			cancel()
+			<-done
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		}
+		cancel()
+		logger.Info(fmt.Sprintf("%s[watch] 文件已变化，重新执行", prefix(t.Dir)), "dir", t.Dir, "phase", "watch")
+	}
+}
+
+// 递归监听目录（fsnotify 本身不递归），跳过忽略的子目录
+func addWatchTree(w *fsnotify.Watcher, root string, opts watchOptions) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && opts.ignored(d.Name()) {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
+
+// 找到事件路径所属的目标（取最长的目录前缀，兼容嵌套目录）
+func matchWatchedTarget(watched []*watchedTarget, path string) *watchedTarget {
+	var best *watchedTarget
+	for _, wt := range watched {
+		if wt.t.remote() {
+			continue
+		}
+		if path != wt.root && !strings.HasPrefix(path, wt.root+string(filepath.Separator)) {
+			continue
+		}
+		if best == nil || len(wt.root) > len(best.root) {
+			best = wt
+		}
+	}
+	return best
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// 为每个目标设置调度权重，即执行时占用的并发名额数，默认 1：
+//
+//	[weights]
+//	services/api=3     # 按目录匹配，支持通配符，也可只写目录名
+//	[build weight=2]   # 不匹配 [weights] 时取组链中最大的组选项 weight
+//
+// 权重超过并发上限时按上限计，否则该目录永远无法调度
+func assignWeights(cfg *Config, names []string, targets []*target, concurrency int) error {
+	groupWeight := 1
+	for _, name := range names {
+		w, err := cfg.intSetting(name, "weight", 1)
+		if err != nil {
+			return err
+		}
+		if w > groupWeight {
+			groupWeight = w
+		}
+	}
+	patterns := sortedKeys(cfg.Weights)
+	for _, t := range targets {
+		w := groupWeight
+		for _, p := range patterns {
+			if !matchWeightPattern(p, t.Dir) {
+				continue
+			}
+			n, err := strconv.Atoi(cfg.Weights[p])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("无效的权重配置 %s=%s", p, cfg.Weights[p])
+			}
+			w = n
+			break
+		}
+		t.Weight = int64(min(w, concurrency))
+	}
+	return nil
+}
+
+// 目录路径或目录名匹配 [weights] 中的键
+func matchWeightPattern(pattern, dir string) bool {
+	clean := filepath.ToSlash(filepath.Clean(dir))
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	for _, s := range []string{clean, path.Base(clean)} {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
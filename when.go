@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 因 --filter 或 when: 条件不满足而跳过
+var errConditionNotMet = errors.New("条件不满足")
+
+// 拆出组内以 when: 开头的条件行，其余为命令
+func splitWhen(cmds []string) (when, rest []string) {
+	for _, line := range cmds {
+		if cond, ok := strings.CutPrefix(line, "when:"); ok {
+			if cond = strings.TrimSpace(cond); cond != "" {
+				when = append(when, cond)
+			}
+			continue
+		}
+		rest = append(rest, line)
+	}
+	return when, rest
+}
+
+// 在目录中依次执行条件命令（不输出），返回第一个失败的条件
+func checkWhen(ctx context.Context, t *target, opts *runOptions) (string, error) {
+	for _, cond := range opts.When {
+		step := cmdStep{Script: cond, Policy: policyStop}.expand(t, opts)
+		c := stepCommand(ctx, t, opts, step, opts.Env)
+		if !t.remote() {
+			c.Dir = t.Dir
+		}
+		c.Env = opts.Env
+		if err := c.Run(); err != nil {
+			return cond, fmt.Errorf("%w: %s (%v)", errConditionNotMet, cond, err)
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML 配置中的单个组，支持两种写法：
+//
+//	build:
+//	  - make
+//
+//	build:
+//	  description: 编译全部模块
+//	  options: {timeout: 10m}
+//	  env: {GOFLAGS: -mod=mod}
+//	  commands:
+//	    - make
+type yamlGroup struct {
+	Commands    []string
+	Description string
+	Options     map[string]string
+	Env         map[string]string
+	Merge       string // append 或 replace，同 INI 组头的 +append / =replace
+}
+
+func (g *yamlGroup) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&g.Commands)
+	}
+	var full struct {
+		Commands    []string          `yaml:"commands"`
+		Description string            `yaml:"description"`
+		Options     map[string]string `yaml:"options"`
+		Env         map[string]string `yaml:"env"`
+		Merge       string            `yaml:"merge"`
+	}
+	if err := node.Decode(&full); err != nil {
+		return err
+	}
+	g.Commands = full.Commands
+	g.Description = full.Description
+	g.Options = full.Options
+	g.Env = full.Env
+	g.Merge = full.Merge
+	return nil
+}
+
+// hosts 中的一台主机
+type yamlHost struct {
+	User string   `yaml:"user"`
+	Port string   `yaml:"port"`
+	Tags []string `yaml:"tags"`
+}
+
+type yamlConfig struct {
+	Settings map[string]string     `yaml:"settings"`
+	Groups   map[string]yamlGroup  `yaml:"groups"`
+	Dirs     map[string][]string   `yaml:"dirs"`
+	Vars     map[string]string     `yaml:"vars"`
+	Env      map[string]string     `yaml:"env"`
+	Notify   map[string]string     `yaml:"notify"`
+	Weights  map[string]string     `yaml:"weights"`
+	Depends  map[string]string     `yaml:"depends_on"`
+	Hooks    map[string]string     `yaml:"hooks"`
+	Tags     map[string][]string   `yaml:"tags"`     // 同 INI 的 [dirs] 清单：目录 -> 标签
+	Priority map[string]string     `yaml:"priority"` // 同 [dirs] 清单中的 priority=N：目录 -> 优先级
+	Hosts    map[string]yamlHost   `yaml:"hosts"`    // 同 INI 的 [hosts] 清单
+	Include  []string              `yaml:"include"`
+	Secrets  string                `yaml:"secrets"`  // 同 INI 的 [secrets] 加密区块
+	Profiles map[string]yamlConfig `yaml:"profiles"` // 与顶层结构相同，--profile 时叠加
+}
+
+// 解析 YAML 格式的配置内容
+func parseYAMLConfig(content string) (*Config, error) {
+	var yc yamlConfig
+	if err := yaml.Unmarshal([]byte(content), &yc); err != nil {
+		return nil, fmt.Errorf("解析 YAML 配置失败: %w", err)
+	}
+	cfg := yc.toConfig()
+	for name, p := range yc.Profiles {
+		cfg.Profiles[name] = p.toConfig()
+	}
+	return cfg, nil
+}
+
+func (yc yamlConfig) toConfig() *Config {
+	cfg := newConfig()
+	for k, v := range yc.Settings {
+		cfg.Settings[k] = v
+	}
+	for name, g := range yc.Groups {
+		cfg.Groups[name] = append([]string{}, g.Commands...)
+		if g.Description != "" {
+			cfg.Descs[name] = g.Description
+		}
+		if len(g.Options) > 0 {
+			cfg.Options[name] = g.Options
+		}
+		if len(g.Env) > 0 {
+			cfg.Env[name] = g.Env
+		}
+		if g.Merge != "" {
+			cfg.Merge[name] = g.Merge
+		}
+	}
+	if len(yc.Env) > 0 {
+		cfg.Env[""] = yc.Env
+	}
+	for k, v := range yc.Vars {
+		cfg.Vars[k] = v
+	}
+	for k, v := range yc.Notify {
+		cfg.Notify[k] = v
+	}
+	for k, v := range yc.Weights {
+		cfg.Weights[k] = v
+	}
+	for k, v := range yc.Depends {
+		cfg.Depends[k] = v
+	}
+	for k, v := range yc.Hooks {
+		cfg.Hooks[k] = v
+	}
+	for dir, tags := range yc.Tags {
+		cfg.DirTags[dir] = tags
+	}
+	for dir, prio := range yc.Priority {
+		cfg.Priority[dir] = prio
+	}
+	for host, h := range yc.Hosts {
+		cfg.Hosts[host] = hostEntry{User: h.User, Port: h.Port, Tags: h.Tags}
+	}
+	cfg.Includes = yc.Include
+	if s := strings.TrimSpace(yc.Secrets); s != "" {
+		cfg.Secrets = strings.Split(s, "\n")
+	}
+	for name, dirs := range yc.Dirs {
+		cfg.DirSets[name] = append([]string{}, dirs...)
+	}
+	return cfg
+}
+
+// 是否为 YAML 配置文件（按扩展名判断）
+func isYAMLFile(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".yml")
+}
+
+// 按文件扩展名选择解析器
+func parseConfigFile(path, content string) (*Config, error) {
+	if isYAMLFile(path) {
+		return parseYAMLConfig(content)
+	}
+	return parseConfig(content), nil
+}